@@ -0,0 +1,85 @@
+package dbhandler
+
+import (
+	"context"
+	"time"
+)
+
+// Fields kept by handlers on collections with Timestamps or Audit
+const (
+	CreatedAtField = "createdAt"
+	UpdatedAtField = "updatedAt"
+	CreatedByField = "createdBy"
+	UpdatedByField = "updatedBy"
+)
+
+// now returns the time of a write, tests replace it
+var now = time.Now
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx carrying the actor of the writes made with it,
+// like the id of the signed in user
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor set by WithActor, ok is false when there is none
+func ActorFrom(ctx context.Context) (actor string, ok bool) {
+	actor, ok = ctx.Value(actorKey{}).(string)
+	return actor, ok
+}
+
+// Stamp returns the audit fields of a write made with ctx. created holds the fields
+// set once on new items and updated the fields set on every write, both are empty
+// when the collection keeps no audit fields. Times have millisecond precision like
+// mongo stores them, the by fields are nil when ctx has no actor.
+func (o CollectionOptions) Stamp(ctx context.Context) (created map[string]interface{}, updated map[string]interface{}) {
+	created = map[string]interface{}{}
+	updated = map[string]interface{}{}
+	if o.Timestamps {
+		at := now().Truncate(time.Millisecond)
+		created[CreatedAtField] = at
+		updated[UpdatedAtField] = at
+	}
+	if o.Audit {
+		var by interface{}
+		if actor, ok := ActorFrom(ctx); ok {
+			by = actor
+		}
+		created[CreatedByField] = by
+		updated[UpdatedByField] = by
+	}
+	return created, updated
+}
+
+// StampNewItem replaces the managed fields of an item about to be inserted:
+// version 1 in versioned collections and the audit fields of a write made with ctx
+func (o CollectionOptions) StampNewItem(ctx context.Context, item map[string]interface{}) {
+	o.StripManaged(item)
+	if o.Versioned {
+		item[VersionField] = int64(1)
+	}
+	created, updated := o.Stamp(ctx)
+	for key, value := range created {
+		item[key] = value
+	}
+	for key, value := range updated {
+		item[key] = value
+	}
+}
+
+// StampReplacement replaces the audit fields of an item about to replace current,
+// the created fields of current are kept. The version is left to the handler.
+func (o CollectionOptions) StampReplacement(ctx context.Context, item map[string]interface{}, current map[string]interface{}) {
+	o.StripManaged(item)
+	_, updated := o.Stamp(ctx)
+	for key, value := range updated {
+		item[key] = value
+	}
+	for _, field := range o.CreatedFields() {
+		if value, ok := current[field]; ok {
+			item[field] = value
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package dbhandler
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestActor(t *testing.T) {
+	if _, ok := ActorFrom(context.Background()); ok {
+		t.Fatalf("Context without actor must not have one")
+	}
+	actor, ok := ActorFrom(WithActor(context.Background(), "doctor-1"))
+	if !ok || actor != "doctor-1" {
+		t.Fatalf("Expected actor doctor-1 but got %q, %v", actor, ok)
+	}
+}
+
+func TestStamp(t *testing.T) {
+	at := time.Date(2018, 3, 4, 5, 6, 7, 8999999, time.UTC)
+	now = func() time.Time { return at }
+	defer func() { now = time.Now }()
+	truncated := time.Date(2018, 3, 4, 5, 6, 7, 8000000, time.UTC)
+	ctx := WithActor(context.Background(), "doctor-1")
+	tests := []struct {
+		name    string
+		opts    CollectionOptions
+		ctx     context.Context
+		created map[string]interface{}
+		updated map[string]interface{}
+	}{
+		{"none", CollectionOptions{Versioned: true}, ctx, map[string]interface{}{}, map[string]interface{}{}},
+		{"timestamps", CollectionOptions{Timestamps: true}, ctx,
+			map[string]interface{}{CreatedAtField: truncated},
+			map[string]interface{}{UpdatedAtField: truncated}},
+		{"audit", CollectionOptions{Audit: true}, ctx,
+			map[string]interface{}{CreatedByField: "doctor-1"},
+			map[string]interface{}{UpdatedByField: "doctor-1"}},
+		{"audit without actor", CollectionOptions{Audit: true}, context.Background(),
+			map[string]interface{}{CreatedByField: nil},
+			map[string]interface{}{UpdatedByField: nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created, updated := tt.opts.Stamp(tt.ctx)
+			if !reflect.DeepEqual(created, tt.created) || !reflect.DeepEqual(updated, tt.updated) {
+				t.Fatalf("Expected %v, %v but got %v, %v", tt.created, tt.updated, created, updated)
+			}
+		})
+	}
+}
+
+func TestStripManaged(t *testing.T) {
+	item := map[string]interface{}{
+		"name": "Anna", VersionField: 3, CreatedAtField: 1, UpdatedAtField: 2, CreatedByField: "x", UpdatedByField: "y",
+	}
+	CollectionOptions{Versioned: true, Timestamps: true}.StripManaged(item)
+	expected := map[string]interface{}{"name": "Anna", CreatedByField: "x", UpdatedByField: "y"}
+	if !reflect.DeepEqual(item, expected) {
+		t.Fatalf("Expected %v but got %v", expected, item)
+	}
+}
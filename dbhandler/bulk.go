@@ -0,0 +1,86 @@
+package dbhandler
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// BulkItemResult is the outcome of one item of a bulk operation
+type BulkItemResult struct {
+	// Index is the position of the item in the request
+	Index int
+	// ID is the hex id of the item, empty when the item has no usable id
+	ID string
+	// Err is the reason the item failed, nil when it was written
+	Err error
+}
+
+// MarshalJSON reports the error message of a failed item
+func (r BulkItemResult) MarshalJSON() ([]byte, error) {
+	out := struct {
+		Index int    `json:"index"`
+		ID    string `json:"id,omitempty"`
+		Error string `json:"error,omitempty"`
+	}{Index: r.Index, ID: r.ID}
+	if r.Err != nil {
+		out.Error = r.Err.Error()
+	}
+	return json.Marshal(out)
+}
+
+// BulkResult holds a result for every item of a bulk operation, in request order
+type BulkResult struct {
+	Items     []BulkItemResult `json:"items"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+}
+
+// NewBulkResult creates the result of count items, all of them succeeded
+func NewBulkResult(count int) BulkResult {
+	result := BulkResult{Items: make([]BulkItemResult, count), Succeeded: count}
+	for index := range result.Items {
+		result.Items[index].Index = index
+	}
+	return result
+}
+
+// Fail marks the item at index as failed
+func (r *BulkResult) Fail(index int, err error) {
+	if index < 0 || index >= len(r.Items) || err == nil {
+		return
+	}
+	if r.Items[index].Err == nil {
+		r.Succeeded--
+		r.Failed++
+	}
+	r.Items[index].Err = err
+}
+
+// Err returns a *BulkError when some items failed
+func (r BulkResult) Err() error {
+	if r.Failed == 0 {
+		return nil
+	}
+	bulkErr := &BulkError{Total: len(r.Items)}
+	for _, item := range r.Items {
+		if item.Err != nil {
+			bulkErr.Failed = append(bulkErr.Failed, item)
+		}
+	}
+	return bulkErr
+}
+
+// BulkError is returned by bulk operations when some items failed.
+// The other items were written.
+type BulkError struct {
+	Total  int
+	Failed []BulkItemResult
+}
+
+func (e *BulkError) Error() string {
+	if len(e.Failed) == 0 {
+		return "bulk operation failed"
+	}
+	return fmt.Sprintf("bulk operation: %d of %d items failed, item %d: %s",
+		len(e.Failed), e.Total, e.Failed[0].Index, e.Failed[0].Err)
+}
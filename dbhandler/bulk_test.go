@@ -0,0 +1,35 @@
+package dbhandler
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestBulkResult(t *testing.T) {
+	result := NewBulkResult(3)
+	if result.Succeeded != 3 || result.Err() != nil {
+		t.Fatalf("New result must be succeeded but got %+v", result)
+	}
+	failure := errors.New("duplicate key")
+	result.Fail(1, failure)
+	result.Fail(1, failure)
+	result.Fail(5, failure)
+	if result.Succeeded != 2 || result.Failed != 1 {
+		t.Fatalf("Expected 2 succeeded and 1 failed but got %+v", result)
+	}
+	bulkErr, ok := result.Err().(*BulkError)
+	if !ok || bulkErr.Total != 3 || len(bulkErr.Failed) != 1 || bulkErr.Failed[0].Index != 1 {
+		t.Fatalf("Unexpected error %v", result.Err())
+	}
+	if bulkErr.Error() != "bulk operation: 1 of 3 items failed, item 1: duplicate key" {
+		t.Errorf("Unexpected error message %q", bulkErr.Error())
+	}
+	data, err := json.Marshal(result.Items[:2])
+	if err != nil {
+		t.Fatalf("Marshal must not return error but got %v", err)
+	}
+	if string(data) != `[{"index":0},{"index":1,"error":"duplicate key"}]` {
+		t.Errorf("Unexpected JSON %s", data)
+	}
+}
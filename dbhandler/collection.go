@@ -0,0 +1,54 @@
+package dbhandler
+
+// CollectionOptions configures how a handler writes the items of a collection.
+// Configure collections once at startup, before using them.
+type CollectionOptions struct {
+	// Versioned collections keep the version of every item in VersionField,
+	// see UpdateByIDIfVersion and RemoveItemByIDIfVersion
+	Versioned bool
+	// Timestamps keeps CreatedAtField and UpdatedAtField of every item
+	Timestamps bool
+	// Audit keeps CreatedByField and UpdatedByField of every item,
+	// the actor is taken from the context of the write, see WithActor
+	Audit bool
+	// SoftDelete collections keep removed items with DeletedAtField set.
+	// Reads skip them unless asked otherwise, see RestoreItemByID and PurgeDeleted.
+	SoftDelete bool
+}
+
+// ManagedFields returns the fields the handler writes itself, callers cannot set them
+func (o CollectionOptions) ManagedFields() []string {
+	var fields []string
+	if o.Versioned {
+		fields = append(fields, VersionField)
+	}
+	if o.Timestamps {
+		fields = append(fields, CreatedAtField, UpdatedAtField)
+	}
+	if o.Audit {
+		fields = append(fields, CreatedByField, UpdatedByField)
+	}
+	if o.SoftDelete {
+		fields = append(fields, DeletedAtField)
+	}
+	return fields
+}
+
+// CreatedFields returns the managed fields which keep the value they got when the item was created
+func (o CollectionOptions) CreatedFields() []string {
+	var fields []string
+	if o.Timestamps {
+		fields = append(fields, CreatedAtField)
+	}
+	if o.Audit {
+		fields = append(fields, CreatedByField)
+	}
+	return fields
+}
+
+// StripManaged removes the managed fields from an item a caller wants to write
+func (o CollectionOptions) StripManaged(item map[string]interface{}) {
+	for _, field := range o.ManagedFields() {
+		delete(item, field)
+	}
+}
@@ -0,0 +1,115 @@
+package dbhandler
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidConfig is returned when a database config cannot be used
+var ErrInvalidConfig = errors.New("invalid database config")
+
+// ReadPreferences lists the accepted values of DatabaseConfig.ReadPreference
+var ReadPreferences = []string{"primary", "primaryPreferred", "secondary", "secondaryPreferred", "nearest"}
+
+// defaultPort is the port of hosts listed without one
+const defaultPort = 27017
+
+// Validate checks the config and reports every problem in one error of kind ErrInvalidConfig
+func (c DatabaseConfig) Validate() error {
+	var problems []string
+	if len(c.Hosts) > 0 && (c.Host != "" || c.Port != 0) {
+		problems = append(problems, "set either host and port or hosts")
+	}
+	if len(c.Hosts) == 0 {
+		if c.Host == "" {
+			problems = append(problems, "no host")
+		}
+		if c.Port < 0 || c.Port > 65535 {
+			problems = append(problems, "port "+strconv.Itoa(c.Port)+" is out of range")
+		}
+	}
+	for _, host := range c.Hosts {
+		if err := checkAddress(host); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if c.Database == "" {
+		problems = append(problems, "no database")
+	}
+	if c.User == "" && c.Pass != "" {
+		problems = append(problems, "password without user")
+	}
+	if !c.TLS && (c.TLSCAFile != "" || c.TLSSkipVerify) {
+		problems = append(problems, "TLS options without TLS")
+	}
+	if c.ConnectTimeout < 0 || c.SocketTimeout < 0 || c.WriteTimeout < 0 {
+		problems = append(problems, "negative timeout")
+	}
+	if c.PoolLimit < 0 {
+		problems = append(problems, "negative pool limit")
+	}
+	if c.ReadPreference != "" && !contains(ReadPreferences, c.ReadPreference) {
+		problems = append(problems, "read preference "+strconv.Quote(c.ReadPreference)+
+			" is not one of "+strings.Join(ReadPreferences, ", "))
+	}
+	if c.WriteConcern != "" && c.WriteConcern != "majority" {
+		if w, err := strconv.Atoi(c.WriteConcern); err != nil || w < 0 {
+			problems = append(problems, "write concern "+strconv.Quote(c.WriteConcern)+" is neither majority nor a number")
+		}
+	}
+	if len(problems) > 0 {
+		return Errorf(ErrInvalidConfig, "%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Addresses returns the "host:port" address of every configured host
+func (c DatabaseConfig) Addresses() []string {
+	if len(c.Hosts) == 0 {
+		port := c.Port
+		if port == 0 {
+			port = defaultPort
+		}
+		return []string{net.JoinHostPort(c.Host, strconv.Itoa(port))}
+	}
+	addresses := make([]string, len(c.Hosts))
+	for index, host := range c.Hosts {
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), strconv.Itoa(defaultPort))
+		}
+		addresses[index] = host
+	}
+	return addresses
+}
+
+// checkAddress checks a "host" or "host:port" address, IPv6 hosts are written in brackets
+func checkAddress(address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		// No port
+		host, port = address, strconv.Itoa(defaultPort)
+		if strings.HasPrefix(address, "[") && strings.HasSuffix(address, "]") {
+			host = address[1 : len(address)-1]
+		} else if strings.Contains(address, ":") {
+			return errors.New("bad host " + strconv.Quote(address))
+		}
+	}
+	if host == "" || strings.ContainsAny(host, "/@?,[] ") {
+		return errors.New("bad host " + strconv.Quote(address))
+	}
+	if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+		return errors.New("bad port in host " + strconv.Quote(address))
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, listed := range values {
+		if listed == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package dbhandler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDatabaseConfigValidate(t *testing.T) {
+	valid := DatabaseConfig{Host: "localhost", Port: 27017, Database: "doctors"}
+	tests := []struct {
+		name   string
+		change func(c *DatabaseConfig)
+		want   string
+	}{
+		{"valid", func(c *DatabaseConfig) {}, ""},
+		{"replica set", func(c *DatabaseConfig) {
+			c.Host, c.Port = "", 0
+			c.Hosts = []string{"db1:27017", "db2", "[::1]:27018", "[::1]"}
+			c.ReplicaSet = "rs0"
+		}, ""},
+		{"full", func(c *DatabaseConfig) {
+			c.User, c.Pass, c.TLS, c.TLSSkipVerify = "admin", "secret", true, true
+			c.ConnectTimeout, c.SocketTimeout, c.WriteTimeout = time.Second, time.Minute, time.Second
+			c.PoolLimit, c.ReadPreference, c.WriteConcern, c.Journal = 10, "secondaryPreferred", "majority", true
+		}, ""},
+		{"no host", func(c *DatabaseConfig) { c.Host = "" }, "no host"},
+		{"both", func(c *DatabaseConfig) { c.Hosts = []string{"db1"} }, "either host and port or hosts"},
+		{"port", func(c *DatabaseConfig) { c.Port = 70000 }, "port 70000 is out of range"},
+		{"bad host", func(c *DatabaseConfig) { c.Host, c.Port, c.Hosts = "", 0, []string{"db1,db2"} }, `bad host "db1,db2"`},
+		{"bad port", func(c *DatabaseConfig) { c.Host, c.Port, c.Hosts = "", 0, []string{"db1:0"} }, `bad port in host "db1:0"`},
+		{"ipv6", func(c *DatabaseConfig) { c.Host, c.Port, c.Hosts = "", 0, []string{"::1"} }, `bad host "::1"`},
+		{"database", func(c *DatabaseConfig) { c.Database = "" }, "no database"},
+		{"password", func(c *DatabaseConfig) { c.Pass = "secret" }, "password without user"},
+		{"tls", func(c *DatabaseConfig) { c.TLSCAFile = "ca.pem" }, "TLS options without TLS"},
+		{"timeout", func(c *DatabaseConfig) { c.SocketTimeout = -time.Second }, "negative timeout"},
+		{"pool", func(c *DatabaseConfig) { c.PoolLimit = -1 }, "negative pool limit"},
+		{"read preference", func(c *DatabaseConfig) { c.ReadPreference = "any" }, `read preference "any" is not one of`},
+		{"write concern", func(c *DatabaseConfig) { c.WriteConcern = "all" }, `write concern "all" is neither majority nor a number`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			tt.change(&config)
+			err := config.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("Config must be valid but got %v", err)
+				}
+				return
+			}
+			if KindOf(err) != ErrInvalidConfig || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Expected error %q but got %v", tt.want, err)
+			}
+		})
+	}
+	err := DatabaseConfig{Port: -1}.Validate()
+	if err == nil || !strings.Contains(err.Error(), "no host; port -1 is out of range; no database") {
+		t.Fatalf("Validate must report every problem but got %v", err)
+	}
+}
+
+func TestDatabaseConfigAddresses(t *testing.T) {
+	tests := []struct {
+		config DatabaseConfig
+		want   []string
+	}{
+		{DatabaseConfig{Host: "localhost", Port: 27018}, []string{"localhost:27018"}},
+		{DatabaseConfig{Host: "localhost"}, []string{"localhost:27017"}},
+		{DatabaseConfig{Hosts: []string{"db1", "db2:27018", "[::1]"}}, []string{"db1:27017", "db2:27018", "[::1]:27017"}},
+	}
+	for _, tt := range tests {
+		if got := tt.config.Addresses(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Expected %v but got %v", tt.want, got)
+		}
+	}
+}
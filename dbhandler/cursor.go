@@ -0,0 +1,51 @@
+package dbhandler
+
+import (
+	"errors"
+	"reflect"
+)
+
+var (
+	// ErrInvalidCursor is returned when a cursor cannot be decoded or
+	// was not created for the requested sort
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrInvalidLimit is returned when a cursor listing is asked for no items
+	ErrInvalidLimit = errors.New("limit must be greater than zero")
+)
+
+// CursorResults a page of items read after a cursor
+type CursorResults struct {
+	PageSize    int                      `json:"pageSize"`
+	NextCursor  string                   `json:"nextCursor,omitempty"`
+	HasNextPage bool                     `json:"hasNextPage,omitempty"`
+	Items       []map[string]interface{} `json:"items"`
+}
+
+// Cursor is the position of the last item of a page: the values of its sort keys.
+// The sort always ends with _id, so a cursor points at exactly one item.
+// A cursor without values points before the first item. The backends encode
+// cursors into the opaque tokens handed to clients.
+type Cursor struct {
+	Sort   []SortKey     `bson:"k"`
+	Values []interface{} `bson:"v,omitempty"`
+}
+
+// IsStart tells whether the cursor points before the first item
+func (c Cursor) IsStart() bool {
+	return len(c.Values) == 0
+}
+
+// Check makes sure a decoded cursor was created for the normalized sort and only holds
+// plain values. The values are compared to the items as they are, a client crafting its
+// own token must not be able to put operators in the query.
+func (c Cursor) Check(sort []SortKey) error {
+	if c.IsStart() || len(c.Values) != len(c.Sort) || !reflect.DeepEqual(c.Sort, sort) {
+		return ErrInvalidCursor
+	}
+	for _, value := range c.Values {
+		if !isScalar(value) {
+			return ErrInvalidCursor
+		}
+	}
+	return nil
+}
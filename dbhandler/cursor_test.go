@@ -0,0 +1,31 @@
+package dbhandler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCursorCheck(t *testing.T) {
+	sort := []SortKey{{Field: "createdAt"}, {Field: "_id"}}
+	valid := Cursor{Sort: sort, Values: []interface{}{time.Now(), "5a0b1c2d3e4f5a6b7c8d9e01"}}
+	if err := valid.Check(sort); err != nil {
+		t.Fatalf("Cursor with plain values must be accepted but got %v", err)
+	}
+	tests := []struct {
+		name   string
+		cursor Cursor
+	}{
+		{"start", Cursor{Sort: sort}},
+		{"another sort", Cursor{Sort: []SortKey{{Field: "name"}, {Field: "_id"}}, Values: []interface{}{"Anna", "id"}}},
+		{"missing value", Cursor{Sort: sort, Values: []interface{}{time.Now()}}},
+		{"operator document", Cursor{Sort: sort, Values: []interface{}{map[string]interface{}{"$ne": nil}, "id"}}},
+		{"array", Cursor{Sort: sort, Values: []interface{}{[]interface{}{1}, "id"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cursor.Check(sort); err != ErrInvalidCursor {
+				t.Fatalf("Cursor with %s must be rejected but got %v", tt.name, err)
+			}
+		})
+	}
+}
@@ -1,5 +1,10 @@
 package dbhandler
 
+import (
+	"context"
+	"time"
+)
+
 // PagedResults paged results from db
 type PagedResults struct {
 	Total           int                      `json:"total"`
@@ -13,7 +18,8 @@ type PagedResults struct {
 	Items           []map[string]interface{} `json:"items"`
 }
 
-// DatabaseConfig provide a uniform struct for storing database configs
+// DatabaseConfig provide a uniform struct for storing database configs.
+// Either set Host and Port or list the members of a replica set in Hosts, see Validate.
 type DatabaseConfig struct {
 	Host           string `json:"host"`
 	Port           int    `json:"port"`
@@ -22,16 +28,116 @@ type DatabaseConfig struct {
 	Database       string `json:"database"`
 	AuthDB         string `json:"auth_db,omitempty"`
 	CollectionName string `json:"collection_name"`
+	// Hosts lists "host:port" addresses, the port defaults to 27017
+	Hosts []string `json:"hosts,omitempty"`
+	// ReplicaSet is the name of the replica set the hosts must belong to
+	ReplicaSet string `json:"replica_set,omitempty"`
+	// TLS encrypts the connections. TLSCAFile is a PEM file of the certificate authorities
+	// to trust instead of the system ones, TLSSkipVerify accepts any server certificate.
+	TLS           bool   `json:"tls,omitempty"`
+	TLSCAFile     string `json:"tls_ca_file,omitempty"`
+	TLSSkipVerify bool   `json:"tls_skip_verify,omitempty"`
+	// ConnectTimeout bounds dialing, SocketTimeout every read and write, zero keeps the defaults
+	ConnectTimeout time.Duration `json:"connect_timeout,omitempty"`
+	SocketTimeout  time.Duration `json:"socket_timeout,omitempty"`
+	// PoolLimit is the most connections per server, zero keeps the default
+	PoolLimit int `json:"pool_limit,omitempty"`
+	// ReadPreference is one of ReadPreferences, empty reads from the primary
+	ReadPreference string `json:"read_preference,omitempty"`
+	// WriteConcern is "majority" or the number of members acknowledging a write,
+	// "0" does not wait at all. Empty waits for the primary.
+	WriteConcern string `json:"write_concern,omitempty"`
+	// Journal waits until writes are in the journal
+	Journal bool `json:"journal,omitempty"`
+	// WriteTimeout bounds the wait for the write concern, zero waits forever
+	WriteTimeout time.Duration `json:"write_timeout,omitempty"`
 }
 
 // DatabaseHandler defines interface for a database handler
 type DatabaseHandler interface {
+	ContextDatabaseHandler
+	BulkDatabaseHandler
+	IndexDatabaseHandler
+	VersionedDatabaseHandler
+	SoftDeleteDatabaseHandler
+	IteratingDatabaseHandler
 	GetConnection() error
 	CloseConnection()
 	GetAllItems(dataname string, limit int, page int, orderBy string, sortBy string, filters map[string]interface{}) (PagedResults, error)
+	// GetAllItemsByKey is GetAllItems returning only the key field and _id of each item,
+	// or whole items when key is empty
+	GetAllItemsByKey(dataname string, limit int, page int, orderBy string, sortBy string, filters map[string]interface{}, key string) (PagedResults, error)
+	// GetAllItemsNoLimit returns every item sorted by _id, projected like GetAllItemsByKey.
+	// It holds the whole collection in memory, use IterateItems for large ones.
+	GetAllItemsNoLimit(dataname string, key string) ([]map[string]interface{}, error)
+	GetItemsAfter(ctx context.Context, dataName string, limit int, cursor string, orderBy string, sortBy string, filters map[string]interface{}) (CursorResults, error)
+	ListItems(ctx context.Context, dataName string, limit int, page int, opts ListOptions) (PagedResults, error)
+	ListItemsAfter(ctx context.Context, dataName string, limit int, cursor string, opts ListOptions) (CursorResults, error)
 	AddNewItem(dataName string, item map[string]interface{}) (map[string]interface{}, error)
 	RemoveItemByID(dataName string, id interface{}) error
 	FindItemByID(dataName string, id interface{}) (map[string]interface{}, error)
+	FindItemByIDWithOptions(ctx context.Context, dataName string, id interface{}, opts FindOptions) (map[string]interface{}, error)
+	UpdateByID(dataName string, id interface{}, update map[string]interface{}) error
 	UpdateBy(dataName string, selector interface{}, update map[string]interface{}) error
 	IsConnecting() bool
+	// Ping tells whether the database answers before the context is done,
+	// readiness checks should use it rather than IsConnecting
+	Ping(ctx context.Context) error
+}
+
+// ContextDatabaseHandler defines the context aware operations of a database handler.
+// Implementations stop waiting on the database once the context is cancelled
+// or its deadline is exceeded and return the context error.
+type ContextDatabaseHandler interface {
+	GetAllItemsContext(ctx context.Context, dataName string, limit int, page int, orderBy string, sortBy string, filters map[string]interface{}) (PagedResults, error)
+	GetAllItemsByKeyContext(ctx context.Context, dataName string, limit int, page int, orderBy string, sortBy string, filters map[string]interface{}, key string) (PagedResults, error)
+	GetAllItemsNoLimitContext(ctx context.Context, dataName string, key string) ([]map[string]interface{}, error)
+	AddNewItemContext(ctx context.Context, dataName string, item map[string]interface{}) (map[string]interface{}, error)
+	RemoveItemByIDContext(ctx context.Context, dataName string, id interface{}) error
+	FindItemByIDContext(ctx context.Context, dataName string, id interface{}) (map[string]interface{}, error)
+	UpdateByIDContext(ctx context.Context, dataName string, id interface{}, update map[string]interface{}) error
+	UpdateByContext(ctx context.Context, dataName string, selector interface{}, update map[string]interface{}) error
+}
+
+// BulkDatabaseHandler defines the operations writing many items in one round trip.
+// Items are written independently, when some fail the returned error is a *BulkError
+// and the result tells which items failed and why.
+type BulkDatabaseHandler interface {
+	AddNewItems(ctx context.Context, dataName string, items []map[string]interface{}) (BulkResult, error)
+	UpsertItems(ctx context.Context, dataName string, items []map[string]interface{}) (BulkResult, error)
+	RemoveItemsByIDs(ctx context.Context, dataName string, ids []interface{}) (BulkResult, error)
+	RemoveItemsBy(ctx context.Context, dataName string, filter Filter) (int, error)
+}
+
+// IndexDatabaseHandler defines the index management of a database handler.
+// Declare the indexes of every collection and ensure them once at startup,
+// the indexes returned by ListIndexes go to the package level DiffIndexes to tell
+// how a collection differs from its declaration.
+type IndexDatabaseHandler interface {
+	EnsureIndexes(ctx context.Context, indexes Indexes) error
+	ListIndexes(ctx context.Context, dataName string) ([]Index, error)
+}
+
+// VersionedDatabaseHandler defines the optimistic concurrency control of a database handler.
+// The version checked writes fail with ErrConflict when the item has another version
+// than expected and with ErrNotVersioned on collections which are not versioned.
+type VersionedDatabaseHandler interface {
+	ConfigureCollection(dataName string, opts CollectionOptions)
+	UpdateByIDIfVersion(ctx context.Context, dataName string, id interface{}, version int64, update map[string]interface{}) (int64, error)
+	RemoveItemByIDIfVersion(ctx context.Context, dataName string, id interface{}, version int64) error
+}
+
+// IteratingDatabaseHandler defines the streaming of large listings.
+// The iterator fetches the items in batches through one cursor, so exports and
+// migrations run in constant memory. The context is checked before every item.
+type IteratingDatabaseHandler interface {
+	IterateItems(ctx context.Context, dataName string, opts IterateOptions) (Iterator, error)
+}
+
+// SoftDeleteDatabaseHandler defines the recovery of items removed from soft deleting collections.
+// List removed items with ListOptions.Deleted. RestoreItemByID and PurgeDeleted fail with
+// ErrNotSoftDeleted on collections which do not soft delete.
+type SoftDeleteDatabaseHandler interface {
+	RestoreItemByID(ctx context.Context, dataName string, id interface{}) error
+	PurgeDeleted(ctx context.Context, dataName string, retention time.Duration) (int, error)
 }
@@ -0,0 +1,1158 @@
+// Package dbhandlertest provides a conformance suite which verifies that a
+// dbhandler.DatabaseHandler implementation honors the shared contract.
+package dbhandlertest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/doctor-services/services/dbhandler"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Factory creates a ready to use handler for one test of the suite
+type Factory func(t *testing.T) dbhandler.DatabaseHandler
+
+// Run runs the whole DatabaseHandler contract against handlers created by newHandler.
+// Every test works in its own collection and removes the items it inserted.
+func Run(t *testing.T, newHandler Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s *suite)
+	}{
+		{"AddNewItem", testAddNewItem},
+		{"FindItemByID", testFindItemByID},
+		{"GetAllItems", testGetAllItems},
+		{"GetItemsAfter", testGetItemsAfter},
+		{"ListItemsSort", testListItemsSort},
+		{"Projection", testProjection},
+		{"ItemsByKey", testItemsByKey},
+		{"Iterate", testIterate},
+		{"Filter", testFilter},
+		{"UpdateBy", testUpdateBy},
+		{"RemoveItemByID", testRemoveItemByID},
+		{"Bulk", testBulk},
+		{"Indexes", testIndexes},
+		{"Versions", testVersions},
+		{"Audit", testAudit},
+		{"SoftDelete", testSoftDelete},
+		{"Context", testContext},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &suite{
+				handler:    newHandler(t),
+				collection: "conformance_" + bson.NewObjectId().Hex(),
+			}
+			defer s.cleanup()
+			tt.test(t, s)
+		})
+	}
+}
+
+type suite struct {
+	handler    dbhandler.DatabaseHandler
+	collection string
+	ids        []interface{}
+}
+
+func (s *suite) cleanup() {
+	for _, id := range s.ids {
+		s.handler.RemoveItemByID(s.collection, id)
+	}
+	s.handler.CloseConnection()
+}
+
+func (s *suite) insert(t *testing.T, item map[string]interface{}) map[string]interface{} {
+	inserted, err := s.handler.AddNewItem(s.collection, item)
+	if err != nil {
+		t.Fatalf("AddNewItem(%v) must not return error but got %v", item, err)
+	}
+	s.ids = append(s.ids, inserted["_id"])
+	return inserted
+}
+
+// seed inserts five doctors, ratings go from 1 to 5
+func (s *suite) seed(t *testing.T) []string {
+	names := []string{"Anna", "Binh", "Chi", "Dung", "Em"}
+	ids := make([]string, len(names))
+	for index, name := range names {
+		specialty := "cardiology"
+		if index%2 == 1 {
+			specialty = "dermatology"
+		}
+		inserted := s.insert(t, map[string]interface{}{
+			"name":      name,
+			"specialty": specialty,
+			"rating":    index + 1,
+		})
+		ids[index] = inserted["_id"].(string)
+	}
+	return ids
+}
+
+func names(items []map[string]interface{}) []interface{} {
+	result := make([]interface{}, len(items))
+	for index, item := range items {
+		result[index] = item["name"]
+	}
+	return result
+}
+
+func testAddNewItem(t *testing.T, s *suite) {
+	item := map[string]interface{}{"name": "Anna", "rating": 4}
+	inserted := s.insert(t, item)
+	id, ok := inserted["_id"].(string)
+	if !ok || !bson.IsObjectIdHex(id) {
+		t.Fatalf("AddNewItem must return a hex _id but got %#v", inserted["_id"])
+	}
+	if inserted["name"] != "Anna" {
+		t.Errorf("AddNewItem must return the inserted fields but got %v", inserted)
+	}
+	if _, ok := item["_id"]; ok {
+		t.Errorf("AddNewItem must not modify the original item")
+	}
+
+	objectID := bson.NewObjectId()
+	inserted = s.insert(t, map[string]interface{}{"_id": objectID})
+	if inserted["_id"] != objectID.Hex() {
+		t.Errorf("AddNewItem must keep a provided ObjectId: expected %s but got %v", objectID.Hex(), inserted["_id"])
+	}
+	hexID := bson.NewObjectId().Hex()
+	inserted = s.insert(t, map[string]interface{}{"_id": hexID})
+	if inserted["_id"] != hexID {
+		t.Errorf("AddNewItem must keep a provided hex id: expected %s but got %v", hexID, inserted["_id"])
+	}
+
+	if _, err := s.handler.AddNewItem(s.collection, map[string]interface{}{"_id": "fdsafas"}); !dbhandler.IsInvalidID(err) {
+		t.Errorf("AddNewItem must reject a malformed id with an invalid id error but got %v", err)
+	}
+	if _, err := s.handler.AddNewItem(s.collection, map[string]interface{}{"_id": objectID}); !dbhandler.IsDuplicateKey(err) {
+		t.Errorf("AddNewItem must reject a duplicated id with a duplicate key error but got %v", err)
+	}
+}
+
+func testFindItemByID(t *testing.T, s *suite) {
+	inserted := s.insert(t, map[string]interface{}{"name": "Anna", "rating": 4})
+	id := inserted["_id"].(string)
+	for _, lookupID := range []interface{}{id, bson.ObjectIdHex(id), []byte(id)} {
+		found, err := s.handler.FindItemByID(s.collection, lookupID)
+		if err != nil {
+			t.Fatalf("FindItemByID(%#v) must not return error but got %v", lookupID, err)
+		}
+		if !reflect.DeepEqual(found, inserted) {
+			t.Errorf("FindItemByID(%#v): expected %v but got %v", lookupID, inserted, found)
+		}
+	}
+	for _, malformedID := range []interface{}{"", "fdsafas", 42, nil} {
+		if _, err := s.handler.FindItemByID(s.collection, malformedID); !dbhandler.IsInvalidID(err) {
+			t.Errorf("FindItemByID(%#v) must reject a malformed id with an invalid id error but got %v", malformedID, err)
+		}
+	}
+	if _, err := s.handler.FindItemByID(s.collection, bson.NewObjectId()); !dbhandler.IsNotFound(err) {
+		t.Errorf("FindItemByID must return a not found error for a missing item but got %v", err)
+	}
+}
+
+func testGetAllItems(t *testing.T, s *suite) {
+	s.seed(t)
+	results, err := s.handler.GetAllItems(s.collection, 2, 2, "ASC", "rating", nil)
+	if err != nil {
+		t.Fatalf("GetAllItems must not return error but got %v", err)
+	}
+	expected := dbhandler.PagedResults{
+		Total:           5,
+		CurrentPage:     2,
+		TotalPage:       3,
+		PageSize:        2,
+		NextPage:        3,
+		PreviousPage:    1,
+		HasNextPage:     true,
+		HasPreviousPage: true,
+	}
+	items := results.Items
+	results.Items = nil
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("GetAllItems paging: expected %+v but got %+v", expected, results)
+	}
+	if got := names(items); !reflect.DeepEqual(got, []interface{}{"Chi", "Dung"}) {
+		t.Errorf("GetAllItems ASC page 2: expected [Chi Dung] but got %v", got)
+	}
+
+	results, err = s.handler.GetAllItems(s.collection, 2, 3, "DESC", "rating", nil)
+	if err != nil {
+		t.Fatalf("GetAllItems must not return error but got %v", err)
+	}
+	if results.PageSize != 1 || results.HasNextPage || results.NextPage != 0 || !results.HasPreviousPage {
+		t.Errorf("GetAllItems last page: wrong paging infor %+v", results)
+	}
+	if got := names(results.Items); !reflect.DeepEqual(got, []interface{}{"Anna"}) {
+		t.Errorf("GetAllItems DESC page 3: expected [Anna] but got %v", got)
+	}
+	for _, item := range results.Items {
+		if id, ok := item["_id"].(string); !ok || !bson.IsObjectIdHex(id) {
+			t.Errorf("GetAllItems must return hex _id but got %#v", item["_id"])
+		}
+	}
+
+	filters := map[string]interface{}{"specialty": "dermatology"}
+	results, err = s.handler.GetAllItems(s.collection, 10, 1, "ASC", "name", filters)
+	if err != nil {
+		t.Fatalf("GetAllItems must not return error but got %v", err)
+	}
+	if results.Total != 2 || results.TotalPage != 1 || results.HasNextPage || results.HasPreviousPage {
+		t.Errorf("GetAllItems with filters: wrong paging infor %+v", results)
+	}
+	if got := names(results.Items); !reflect.DeepEqual(got, []interface{}{"Binh", "Dung"}) {
+		t.Errorf("GetAllItems with filters: expected [Binh Dung] but got %v", got)
+	}
+
+	results, err = s.handler.GetAllItems(s.collection, 10, 1, "ASC", "name", map[string]interface{}{"specialty": "none"})
+	if err != nil {
+		t.Fatalf("GetAllItems must not return error but got %v", err)
+	}
+	if results.Total != 0 || len(results.Items) != 0 {
+		t.Errorf("GetAllItems without matches must be empty but got %+v", results)
+	}
+}
+
+// readAllAfter follows the cursors until the last page
+func (s *suite) readAllAfter(t *testing.T, limit int, orderBy string, sortBy string, filters map[string]interface{}) []interface{} {
+	var (
+		result []interface{}
+		cursor string
+	)
+	for page := 1; page <= 20; page++ {
+		results, err := s.handler.GetItemsAfter(context.Background(), s.collection, limit, cursor, orderBy, sortBy, filters)
+		if err != nil {
+			t.Fatalf("GetItemsAfter must not return error but got %v", err)
+		}
+		if results.PageSize != len(results.Items) || results.PageSize > limit {
+			t.Fatalf("GetItemsAfter page %d: wrong page size %d for %d items", page, results.PageSize, len(results.Items))
+		}
+		result = append(result, names(results.Items)...)
+		if !results.HasNextPage {
+			if results.NextCursor != "" {
+				t.Errorf("GetItemsAfter last page must not have a next cursor")
+			}
+			return result
+		}
+		if results.NextCursor == "" {
+			t.Fatalf("GetItemsAfter page %d has next page but no cursor", page)
+		}
+		cursor = results.NextCursor
+	}
+	t.Fatalf("GetItemsAfter never reached the last page")
+	return nil
+}
+
+func testGetItemsAfter(t *testing.T, s *suite) {
+	s.seed(t)
+	// Items sharing a sort value and items without it must neither repeat nor go missing
+	s.insert(t, map[string]interface{}{"name": "Giang", "specialty": "cardiology", "rating": 3})
+	s.insert(t, map[string]interface{}{"name": "Hoa", "specialty": "cardiology"})
+
+	if got := s.readAllAfter(t, 2, "ASC", "name", nil); !reflect.DeepEqual(got, []interface{}{"Anna", "Binh", "Chi", "Dung", "Em", "Giang", "Hoa"}) {
+		t.Errorf("GetItemsAfter ASC by name: got %v", got)
+	}
+	ascending := s.readAllAfter(t, 2, "ASC", "rating", nil)
+	if len(ascending) != 7 || ascending[0] != "Hoa" || ascending[1] != "Anna" || ascending[6] != "Em" {
+		t.Errorf("GetItemsAfter ASC by rating: got %v", ascending)
+	}
+	descending := s.readAllAfter(t, 3, "DESC", "rating", nil)
+	if len(descending) != 7 || descending[0] != "Em" || descending[6] != "Hoa" {
+		t.Errorf("GetItemsAfter DESC by rating: got %v", descending)
+	}
+	for index := range ascending {
+		if index != 3 && index != 4 && ascending[index] != descending[6-index] {
+			t.Errorf("GetItemsAfter DESC must be the reverse of ASC: %v and %v", ascending, descending)
+			break
+		}
+	}
+	if got := s.readAllAfter(t, 1, "DESC", "", nil); len(got) != 7 {
+		t.Errorf("GetItemsAfter by _id must return every item but got %v", got)
+	}
+	filters := map[string]interface{}{"specialty": "dermatology"}
+	if got := s.readAllAfter(t, 1, "ASC", "name", filters); !reflect.DeepEqual(got, []interface{}{"Binh", "Dung"}) {
+		t.Errorf("GetItemsAfter with filters: expected [Binh Dung] but got %v", got)
+	}
+
+	// A page read after an insert continues where the previous page stopped
+	first, err := s.handler.GetItemsAfter(context.Background(), s.collection, 2, "", "ASC", "name", nil)
+	if err != nil {
+		t.Fatalf("GetItemsAfter must not return error but got %v", err)
+	}
+	s.insert(t, map[string]interface{}{"name": "Aaron"})
+	second, err := s.handler.GetItemsAfter(context.Background(), s.collection, 2, first.NextCursor, "ASC", "name", nil)
+	if err != nil {
+		t.Fatalf("GetItemsAfter must not return error but got %v", err)
+	}
+	if got := names(second.Items); !reflect.DeepEqual(got, []interface{}{"Chi", "Dung"}) {
+		t.Errorf("GetItemsAfter must be stable under inserts: expected [Chi Dung] but got %v", got)
+	}
+
+	if _, err = s.handler.GetItemsAfter(context.Background(), s.collection, 2, "not a cursor", "ASC", "name", nil); err == nil {
+		t.Errorf("GetItemsAfter must reject a malformed cursor")
+	}
+	if _, err = s.handler.GetItemsAfter(context.Background(), s.collection, 2, first.NextCursor, "DESC", "name", nil); err == nil {
+		t.Errorf("GetItemsAfter must reject a cursor created for another sort")
+	}
+	if _, err = s.handler.GetItemsAfter(context.Background(), s.collection, 0, "", "ASC", "name", nil); err == nil {
+		t.Errorf("GetItemsAfter must reject a limit of zero")
+	}
+}
+
+func testListItemsSort(t *testing.T, s *suite) {
+	s.seed(t)
+	s.insert(t, map[string]interface{}{"name": "Giang", "specialty": "dermatology", "rating": 4})
+	sort := []dbhandler.SortKey{{Field: "specialty"}, {Field: "rating", Desc: true}}
+	expected := []interface{}{"Em", "Chi", "Anna", "Dung", "Giang", "Binh"}
+
+	results, err := s.handler.ListItems(context.Background(), s.collection, 10, 1, dbhandler.ListOptions{Sort: sort})
+	if err != nil {
+		t.Fatalf("ListItems must not return error but got %v", err)
+	}
+	got := names(results.Items)
+	// Dung and Giang share specialty and rating, _id decides
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("ListItems by specialty then rating desc: expected %v but got %v", expected, got)
+	}
+	var paged []interface{}
+	for page := 1; page <= 3; page++ {
+		results, err = s.handler.ListItems(context.Background(), s.collection, 2, page, dbhandler.ListOptions{Sort: sort})
+		if err != nil {
+			t.Fatalf("ListItems must not return error but got %v", err)
+		}
+		paged = append(paged, names(results.Items)...)
+	}
+	if !reflect.DeepEqual(paged, expected) {
+		t.Errorf("ListItems pages must not overlap: expected %v but got %v", expected, paged)
+	}
+
+	var (
+		cursor   string
+		afterAll []interface{}
+	)
+	for page := 1; page <= 6; page++ {
+		after, err := s.handler.ListItemsAfter(context.Background(), s.collection, 1, cursor, dbhandler.ListOptions{Sort: sort})
+		if err != nil {
+			t.Fatalf("ListItemsAfter must not return error but got %v", err)
+		}
+		afterAll = append(afterAll, names(after.Items)...)
+		cursor = after.NextCursor
+		if !after.HasNextPage {
+			break
+		}
+	}
+	if !reflect.DeepEqual(afterAll, expected) {
+		t.Errorf("ListItemsAfter by specialty then rating desc: expected %v but got %v", expected, afterAll)
+	}
+
+	filtered, err := s.handler.ListItems(context.Background(), s.collection, 10, 1, dbhandler.ListOptions{
+		Filters: map[string]interface{}{"specialty": "dermatology"},
+		Sort:    []dbhandler.SortKey{{Field: "rating"}, {Field: "name", Desc: true}},
+	})
+	if err != nil {
+		t.Fatalf("ListItems must not return error but got %v", err)
+	}
+	if got := names(filtered.Items); !reflect.DeepEqual(got, []interface{}{"Binh", "Giang", "Dung"}) {
+		t.Errorf("ListItems with filters: expected [Binh Giang Dung] but got %v", got)
+	}
+
+	for _, invalid := range [][]dbhandler.SortKey{
+		{{Field: ""}},
+		{{Field: "$where"}},
+		{{Field: "name"}, {Field: "name", Desc: true}},
+		{{Field: "address..city"}},
+	} {
+		if _, err := s.handler.ListItems(context.Background(), s.collection, 10, 1, dbhandler.ListOptions{Sort: invalid}); err == nil {
+			t.Errorf("ListItems must reject sort %v", invalid)
+		}
+		if _, err := s.handler.ListItemsAfter(context.Background(), s.collection, 10, "", dbhandler.ListOptions{Sort: invalid}); err == nil {
+			t.Errorf("ListItemsAfter must reject sort %v", invalid)
+		}
+	}
+}
+
+func testProjection(t *testing.T, s *suite) {
+	inserted := s.insert(t, map[string]interface{}{
+		"name":     "Anna",
+		"rating":   4,
+		"address":  map[string]interface{}{"city": "Hanoi", "street": "Trang Tien"},
+		"schedule": []interface{}{map[string]interface{}{"day": "monday", "room": 1}},
+	})
+	id := inserted["_id"].(string)
+	tests := []struct {
+		name       string
+		projection dbhandler.Projection
+		want       map[string]interface{}
+	}{
+		{"include", dbhandler.Projection{Include: []string{"name"}},
+			map[string]interface{}{"_id": id, "name": "Anna"}},
+		{"include nested", dbhandler.Projection{Include: []string{"address.city", "schedule.day"}},
+			map[string]interface{}{"_id": id, "address": bson.M{"city": "Hanoi"}, "schedule": []interface{}{bson.M{"day": "monday"}}}},
+		{"include without id", dbhandler.Projection{Include: []string{"rating"}, Exclude: []string{"_id"}},
+			map[string]interface{}{"rating": 4}},
+		{"exclude", dbhandler.Projection{Exclude: []string{"address", "schedule.room", "rating"}},
+			map[string]interface{}{"_id": id, "name": "Anna", "schedule": []interface{}{bson.M{"day": "monday"}}}},
+	}
+	for _, tt := range tests {
+		found, err := s.handler.FindItemByIDWithOptions(context.Background(), s.collection, id, dbhandler.FindOptions{Projection: tt.projection})
+		if err != nil {
+			t.Fatalf("FindItemByIDWithOptions %s must not return error but got %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(found, tt.want) {
+			t.Errorf("FindItemByIDWithOptions %s: expected %v but got %v", tt.name, tt.want, found)
+		}
+		results, err := s.handler.ListItems(context.Background(), s.collection, 10, 1, dbhandler.ListOptions{Projection: tt.projection})
+		if err != nil {
+			t.Fatalf("ListItems %s must not return error but got %v", tt.name, err)
+		}
+		if len(results.Items) != 1 || !reflect.DeepEqual(results.Items[0], tt.want) {
+			t.Errorf("ListItems %s: expected %v but got %v", tt.name, tt.want, results.Items)
+		}
+	}
+
+	s.seed(t)
+	var (
+		cursor string
+		listed []interface{}
+	)
+	for page := 1; page <= 6; page++ {
+		results, err := s.handler.ListItemsAfter(context.Background(), s.collection, 2, cursor, dbhandler.ListOptions{
+			Sort:       []dbhandler.SortKey{{Field: "rating", Desc: true}},
+			Projection: dbhandler.Projection{Include: []string{"name"}, Exclude: []string{"_id"}},
+		})
+		if err != nil {
+			t.Fatalf("ListItemsAfter must not return error but got %v", err)
+		}
+		for _, item := range results.Items {
+			if len(item) != 1 {
+				t.Errorf("ListItemsAfter must only return projected fields but got %v", item)
+			}
+			listed = append(listed, item["name"])
+		}
+		cursor = results.NextCursor
+		if !results.HasNextPage {
+			break
+		}
+	}
+	// Both items rated 4 are ordered by _id, the first inserted comes first
+	expected := []interface{}{"Em", "Anna", "Dung", "Chi", "Binh", "Anna"}
+	if !reflect.DeepEqual(listed, expected) {
+		t.Errorf("ListItemsAfter with projection excluding the sort field: expected %v but got %v", expected, listed)
+	}
+
+	for _, invalid := range []dbhandler.Projection{
+		{Include: []string{"name"}, Exclude: []string{"rating"}},
+		{Include: []string{"$where"}},
+		{Include: []string{"address", "address.city"}},
+	} {
+		if _, err := s.handler.FindItemByIDWithOptions(context.Background(), s.collection, id, dbhandler.FindOptions{Projection: invalid}); err == nil {
+			t.Errorf("FindItemByIDWithOptions must reject projection %v", invalid)
+		}
+		if _, err := s.handler.ListItems(context.Background(), s.collection, 10, 1, dbhandler.ListOptions{Projection: invalid}); err == nil {
+			t.Errorf("ListItems must reject projection %v", invalid)
+		}
+	}
+}
+
+func testFilter(t *testing.T, s *suite) {
+	s.seed(t)
+	s.insert(t, map[string]interface{}{"name": "anh", "tags": []string{"senior", "surgeon"}, "address": map[string]interface{}{"city": "Hanoi"}})
+	tests := []struct {
+		name   string
+		filter dbhandler.Filter
+		want   []interface{}
+	}{
+		{"eq", dbhandler.Eq("specialty", "dermatology"), []interface{}{"Binh", "Dung"}},
+		{"eq array element", dbhandler.Eq("tags", "surgeon"), []interface{}{"anh"}},
+		{"eq nested", dbhandler.Eq("address.city", "Hanoi"), []interface{}{"anh"}},
+		{"ne", dbhandler.Ne("specialty", "cardiology"), []interface{}{"Binh", "Dung", "anh"}},
+		{"in", dbhandler.In("name", "Anna", "Em", "Nobody"), []interface{}{"Anna", "Em"}},
+		{"not in", dbhandler.NotIn("rating", 1, 2, 3), []interface{}{"Dung", "Em", "anh"}},
+		{"range", dbhandler.Range("rating", 2, 4), []interface{}{"Binh", "Chi", "Dung"}},
+		{"open range", dbhandler.Range("rating", nil, 2), []interface{}{"Anna", "Binh"}},
+		{"greater", dbhandler.Gt("rating", 4), []interface{}{"Em"}},
+		{"less", dbhandler.Lt("rating", 2), []interface{}{"Anna"}},
+		{"regex", dbhandler.Regex("name", "(?i)^an"), []interface{}{"Anna", "anh"}},
+		{"prefix", dbhandler.Prefix("name", "An"), []interface{}{"Anna"}},
+		{"exists", dbhandler.Exists("rating", false), []interface{}{"anh"}},
+		{"and", dbhandler.And(dbhandler.Eq("specialty", "cardiology"), dbhandler.Gte("rating", 3)), []interface{}{"Chi", "Em"}},
+		{"or", dbhandler.Or(dbhandler.Eq("name", "Binh"), dbhandler.Exists("tags", true)), []interface{}{"Binh", "anh"}},
+	}
+	for _, tt := range tests {
+		results, err := s.handler.ListItems(context.Background(), s.collection, 10, 1, dbhandler.ListOptions{
+			Filter: tt.filter,
+			Sort:   []dbhandler.SortKey{{Field: "name"}},
+		})
+		if err != nil {
+			t.Fatalf("ListItems with %s filter must not return error but got %v", tt.name, err)
+		}
+		if got := names(results.Items); !reflect.DeepEqual(got, tt.want) || results.Total != len(tt.want) {
+			t.Errorf("ListItems with %s filter: expected %v but got %v", tt.name, tt.want, got)
+		}
+	}
+
+	// Typed filter and filter map are combined
+	results, err := s.handler.ListItems(context.Background(), s.collection, 10, 1, dbhandler.ListOptions{
+		Filter:  dbhandler.Gte("rating", 2),
+		Filters: map[string]interface{}{"specialty": "cardiology"},
+	})
+	if err != nil {
+		t.Fatalf("ListItems must not return error but got %v", err)
+	}
+	if results.Total != 2 {
+		t.Errorf("ListItems must apply both Filter and Filters, expected 2 items but got %d", results.Total)
+	}
+	after, err := s.handler.ListItemsAfter(context.Background(), s.collection, 1, "", dbhandler.ListOptions{
+		Filter: dbhandler.Eq("specialty", "dermatology"),
+		Sort:   []dbhandler.SortKey{{Field: "name", Desc: true}},
+	})
+	if err != nil {
+		t.Fatalf("ListItemsAfter must not return error but got %v", err)
+	}
+	if got := names(after.Items); !reflect.DeepEqual(got, []interface{}{"Dung"}) || !after.HasNextPage {
+		t.Errorf("ListItemsAfter with filter: expected [Dung] and a next page but got %v", got)
+	}
+
+	injections := []map[string]interface{}{
+		{"$where": "true"},
+		{"name": map[string]interface{}{"$where": "true"}},
+		{"rating": map[string]interface{}{"$gt": 0}, "$expr": map[string]interface{}{"$eq": []interface{}{1, 1}}},
+	}
+	for _, filters := range injections {
+		if _, err := s.handler.GetAllItems(s.collection, 10, 1, "ASC", "name", filters); err == nil {
+			t.Errorf("GetAllItems must reject filters %v", filters)
+		}
+		if _, err := s.handler.ListItemsAfter(context.Background(), s.collection, 10, "", dbhandler.ListOptions{Filters: filters}); err == nil {
+			t.Errorf("ListItemsAfter must reject filters %v", filters)
+		}
+		if err := s.handler.UpdateBy(s.collection, filters, map[string]interface{}{"seen": true}); err == nil {
+			t.Errorf("UpdateBy must reject selector %v", filters)
+		}
+	}
+	if _, err := s.handler.ListItems(context.Background(), s.collection, 10, 1, dbhandler.ListOptions{
+		Filter: dbhandler.Eq("name", map[string]interface{}{"$ne": ""}),
+	}); err == nil {
+		t.Errorf("ListItems must reject operators smuggled in filter values")
+	}
+	selectors := []interface{}{
+		bson.D{{Name: "$where", Value: "true"}},
+		struct {
+			Where string `bson:"$where"`
+		}{"true"},
+	}
+	for _, selector := range selectors {
+		if err := s.handler.UpdateBy(s.collection, selector, map[string]interface{}{"seen": true}); dbhandler.KindOf(err) != dbhandler.ErrInvalidFilter {
+			t.Errorf("UpdateBy must reject selector %#v but got %v", selector, err)
+		}
+	}
+}
+
+func testUpdateBy(t *testing.T, s *suite) {
+	ids := s.seed(t)
+	update := map[string]interface{}{
+		"_id":  bson.NewObjectId().Hex(),
+		"seen": true,
+	}
+	cloned := map[string]interface{}{"_id": update["_id"], "seen": true}
+	err := s.handler.UpdateBy(s.collection, map[string]interface{}{"specialty": "dermatology"}, update)
+	if err != nil {
+		t.Fatalf("UpdateBy must not return error but got %v", err)
+	}
+	if !reflect.DeepEqual(update, cloned) {
+		t.Errorf("UpdateBy must not modify the original update")
+	}
+	for index, id := range ids {
+		found, err := s.handler.FindItemByID(s.collection, id)
+		if err != nil {
+			t.Fatalf("UpdateBy must never touch _id, find %s returned %v", id, err)
+		}
+		if found["_id"] != id {
+			t.Errorf("UpdateBy must never touch _id: expected %s but got %v", id, found["_id"])
+		}
+		seen, _ := found["seen"].(bool)
+		if seen != (index%2 == 1) {
+			t.Errorf("UpdateBy must only update selected items but got %v", found)
+		}
+		if found["rating"] != index+1 {
+			t.Errorf("UpdateBy must keep fields which are not updated but got %v", found)
+		}
+	}
+}
+
+func testRemoveItemByID(t *testing.T, s *suite) {
+	ids := s.seed(t)
+	if err := s.handler.RemoveItemByID(s.collection, ids[0]); err != nil {
+		t.Fatalf("RemoveItemByID must not return error but got %v", err)
+	}
+	if _, err := s.handler.FindItemByID(s.collection, ids[0]); err == nil {
+		t.Errorf("FindItemByID must return error after removing")
+	}
+	if err := s.handler.RemoveItemByID(s.collection, ids[0]); !dbhandler.IsNotFound(err) {
+		t.Errorf("RemoveItemByID must return a not found error for a missing item but got %v", err)
+	}
+	if err := s.handler.RemoveItemByID(s.collection, "fdsafas"); !dbhandler.IsInvalidID(err) {
+		t.Errorf("RemoveItemByID must reject a malformed id with an invalid id error but got %v", err)
+	}
+	results, err := s.handler.GetAllItems(s.collection, 10, 1, "ASC", "name", nil)
+	if err != nil {
+		t.Fatalf("GetAllItems must not return error but got %v", err)
+	}
+	if results.Total != 4 {
+		t.Errorf("RemoveItemByID must only remove one item, %d left", results.Total)
+	}
+}
+
+func testBulk(t *testing.T, s *suite) {
+	existing := s.insert(t, map[string]interface{}{"name": "Anna"})
+	items := []map[string]interface{}{
+		{"name": "Binh"},
+		{"_id": existing["_id"], "name": "Duplicate"},
+		{"_id": "fdsafas", "name": "Malformed"},
+		{"name": "Chi"},
+	}
+	result, err := s.handler.AddNewItems(context.Background(), s.collection, items)
+	for _, item := range result.Items {
+		if item.ID != "" {
+			s.ids = append(s.ids, item.ID)
+		}
+	}
+	bulkErr, ok := err.(*dbhandler.BulkError)
+	if !ok {
+		t.Fatalf("AddNewItems must return *BulkError for partial failures but got %v", err)
+	}
+	if result.Succeeded != 2 || result.Failed != 2 || len(bulkErr.Failed) != 2 {
+		t.Fatalf("Expected 2 items written and 2 failed but got %+v", result)
+	}
+	for index, failed := range []bool{false, true, true, false} {
+		if item := result.Items[index]; item.Index != index || (item.Err != nil) != failed {
+			t.Errorf("Item %d: expected failed %v but got %+v", index, failed, item)
+		}
+	}
+	if _, ok := items[0]["_id"]; ok {
+		t.Errorf("AddNewItems must not modify the items")
+	}
+	results, err := s.handler.GetAllItems(s.collection, 10, 1, "ASC", "name", nil)
+	if err != nil {
+		t.Fatalf("GetAllItems must not return error but got %v", err)
+	}
+	if got := names(results.Items); !reflect.DeepEqual(got, []interface{}{"Anna", "Binh", "Chi"}) {
+		t.Fatalf("Expected [Anna Binh Chi] but got %v", got)
+	}
+
+	binhID := result.Items[0].ID
+	upserted, err := s.handler.UpsertItems(context.Background(), s.collection, []map[string]interface{}{
+		{"_id": binhID, "name": "Binh", "rating": 5},
+		{"name": "Dung"},
+	})
+	if err != nil {
+		t.Fatalf("UpsertItems must not return error but got %v", err)
+	}
+	s.ids = append(s.ids, upserted.Items[1].ID)
+	if upserted.Items[0].ID != binhID || upserted.Items[1].ID == "" {
+		t.Errorf("UpsertItems must report the item ids but got %+v", upserted.Items)
+	}
+	binh, err := s.handler.FindItemByID(s.collection, binhID)
+	if err != nil || binh["rating"] != 5 {
+		t.Errorf("UpsertItems must replace an existing item but got %v, %v", binh, err)
+	}
+	if _, err := s.handler.FindItemByID(s.collection, upserted.Items[1].ID); err != nil {
+		t.Errorf("UpsertItems must insert a new item but got %v", err)
+	}
+
+	removed, err := s.handler.RemoveItemsByIDs(context.Background(), s.collection, []interface{}{
+		binhID, bson.NewObjectId(), "fdsafas", bson.ObjectIdHex(result.Items[3].ID),
+	})
+	if _, ok := err.(*dbhandler.BulkError); !ok || removed.Failed != 1 || removed.Items[2].Err == nil {
+		t.Fatalf("RemoveItemsByIDs must only fail the malformed id but got %+v, %v", removed, err)
+	}
+	results, err = s.handler.GetAllItems(s.collection, 10, 1, "ASC", "name", nil)
+	if err != nil {
+		t.Fatalf("GetAllItems must not return error but got %v", err)
+	}
+	if got := names(results.Items); !reflect.DeepEqual(got, []interface{}{"Anna", "Dung"}) {
+		t.Fatalf("Expected [Anna Dung] but got %v", got)
+	}
+
+	if _, err := s.handler.RemoveItemsBy(context.Background(), s.collection, dbhandler.Filter{}); err == nil {
+		t.Errorf("RemoveItemsBy must reject an empty filter")
+	}
+	if _, err := s.handler.RemoveItemsBy(context.Background(), s.collection, dbhandler.Eq("$where", "true")); err == nil {
+		t.Errorf("RemoveItemsBy must reject an invalid filter")
+	}
+	count, err := s.handler.RemoveItemsBy(context.Background(), s.collection, dbhandler.In("name", "Dung", "Nobody"))
+	if err != nil || count != 1 {
+		t.Fatalf("RemoveItemsBy must remove 1 item but got %d, %v", count, err)
+	}
+	if results, _ = s.handler.GetAllItems(s.collection, 10, 1, "ASC", "name", nil); results.Total != 1 {
+		t.Errorf("RemoveItemsBy must only remove matching items, %d left", results.Total)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cancelled, err := s.handler.AddNewItems(ctx, s.collection, []map[string]interface{}{{"name": "Em"}})
+	if err != context.Canceled || cancelled.Failed != 1 {
+		t.Errorf("AddNewItems: expected %v for every item but got %+v, %v", context.Canceled, cancelled, err)
+	}
+}
+
+func testIndexes(t *testing.T, s *suite) {
+	declared := []dbhandler.Index{
+		{Key: []string{"email"}, Unique: true},
+		{Key: []string{"clinicId", "-startAt"}},
+		{Key: []string{"license"}, Unique: true, Sparse: true},
+		{Name: "expiry", Key: []string{"expireAt"}, ExpireAfter: time.Hour},
+		{Key: []string{"$text:bio"}},
+	}
+	indexes := dbhandler.Indexes{s.collection: declared}
+	if err := s.handler.EnsureIndexes(context.Background(), indexes); err != nil {
+		t.Fatalf("EnsureIndexes must not return error but got %v", err)
+	}
+	// Ensuring again is a no-op
+	if err := s.handler.EnsureIndexes(context.Background(), indexes); err != nil {
+		t.Fatalf("EnsureIndexes must not return error the second time but got %v", err)
+	}
+	existing, err := s.handler.ListIndexes(context.Background(), s.collection)
+	if err != nil {
+		t.Fatalf("ListIndexes must not return error but got %v", err)
+	}
+	if len(existing) != len(declared)+1 {
+		t.Errorf("Expected the _id index and %d declared indexes but got %v", len(declared), existing)
+	}
+	if diff := dbhandler.DiffIndexes(declared, existing); !diff.IsEmpty() {
+		t.Errorf("Existing indexes must match the declaration but got %+v", diff)
+	}
+	changed := []dbhandler.Index{{Key: []string{"email"}}}
+	if diff := dbhandler.DiffIndexes(changed, existing); len(diff.Changed) != 1 || len(diff.Extra) != len(declared)-1 {
+		t.Errorf("Expected 1 changed and %d extra indexes but got %+v", len(declared)-1, diff)
+	}
+	if err := s.handler.EnsureIndexes(context.Background(), dbhandler.Indexes{s.collection: changed}); !dbhandler.IsConflict(err) {
+		t.Errorf("EnsureIndexes must not silently change an existing index but got %v", err)
+	}
+	if missing, err := s.handler.ListIndexes(context.Background(), s.collection+"_missing"); err != nil || len(missing) != 0 {
+		t.Errorf("ListIndexes of a missing collection must be empty but got %v, %v", missing, err)
+	}
+
+	// Writing items must keep the indexes
+	anna := s.insert(t, map[string]interface{}{"name": "Anna", "email": "anna@example.com"})
+	s.insert(t, map[string]interface{}{"name": "Binh", "email": "binh@example.com"})
+	if _, err := s.handler.AddNewItem(s.collection, map[string]interface{}{"name": "Anna", "email": "anna@example.com"}); err == nil {
+		t.Errorf("AddNewItem must reject a duplicate unique key")
+	}
+	if err := s.handler.UpdateBy(s.collection, map[string]interface{}{"name": "Binh"}, map[string]interface{}{"email": "anna@example.com"}); err == nil {
+		t.Errorf("UpdateBy must reject a duplicate unique key")
+	}
+	if err := s.handler.UpdateBy(s.collection, map[string]interface{}{"name": "Anna"}, map[string]interface{}{"email": "anna@example.com"}); err != nil {
+		t.Errorf("UpdateBy must allow an item to keep its own key but got %v", err)
+	}
+	result, err := s.handler.AddNewItems(context.Background(), s.collection, []map[string]interface{}{
+		{"name": "Chi", "email": "chi@example.com"},
+		{"name": "Binh", "email": "binh@example.com"},
+	})
+	for _, item := range result.Items {
+		s.ids = append(s.ids, item.ID)
+	}
+	if err == nil || result.Items[0].Err != nil || !dbhandler.IsDuplicateKey(result.Items[1].Err) {
+		t.Errorf("AddNewItems must only fail the duplicate item but got %+v", result)
+	}
+	// Items without a sparse unique field never collide
+	s.insert(t, map[string]interface{}{"name": "Dung", "email": "dung@example.com"})
+	s.insert(t, map[string]interface{}{"name": "Em", "email": "em@example.com", "license": "L-1"})
+	if _, err := s.handler.AddNewItem(s.collection, map[string]interface{}{"name": "Giang", "license": "L-1"}); err == nil {
+		t.Errorf("AddNewItem must reject a duplicate sparse unique key")
+	}
+	if found, err := s.handler.FindItemByID(s.collection, anna["_id"]); err != nil || found["email"] != "anna@example.com" {
+		t.Errorf("Indexes must survive inserts but got %v, %v", found, err)
+	}
+	if existing, _ = s.handler.ListIndexes(context.Background(), s.collection); len(existing) != len(declared)+1 {
+		t.Errorf("Inserting items must not drop indexes but got %v", existing)
+	}
+}
+
+func testVersions(t *testing.T, s *suite) {
+	ctx := context.Background()
+	legacy := s.insert(t, map[string]interface{}{"name": "Legacy"})
+	if _, err := s.handler.UpdateByIDIfVersion(ctx, s.collection, legacy["_id"], 0, legacy); err != dbhandler.ErrNotVersioned {
+		t.Errorf("UpdateByIDIfVersion: expected %v but got %v", dbhandler.ErrNotVersioned, err)
+	}
+	if err := s.handler.RemoveItemByIDIfVersion(ctx, s.collection, legacy["_id"], 0); err != dbhandler.ErrNotVersioned {
+		t.Errorf("RemoveItemByIDIfVersion: expected %v but got %v", dbhandler.ErrNotVersioned, err)
+	}
+
+	s.handler.ConfigureCollection(s.collection, dbhandler.CollectionOptions{Versioned: true})
+	inserted := s.insert(t, map[string]interface{}{"name": "Anna", dbhandler.VersionField: 42})
+	if version := dbhandler.VersionOf(inserted); version != 1 {
+		t.Fatalf("New items must have version 1 but got %d", version)
+	}
+	id := inserted["_id"]
+	version, err := s.handler.UpdateByIDIfVersion(ctx, s.collection, id, 1, map[string]interface{}{"name": "Anna", "rating": 4})
+	if err != nil || version != 2 {
+		t.Fatalf("UpdateByIDIfVersion must return version 2 but got %d, %v", version, err)
+	}
+	if _, err := s.handler.UpdateByIDIfVersion(ctx, s.collection, id, 1, map[string]interface{}{"name": "Stale"}); !dbhandler.IsConflict(err) {
+		t.Errorf("UpdateByIDIfVersion with a stale version must return a conflict error but got %v", err)
+	}
+	if _, err := s.handler.UpdateByIDIfVersion(ctx, s.collection, bson.NewObjectId(), 1, map[string]interface{}{}); !dbhandler.IsNotFound(err) {
+		t.Errorf("UpdateByIDIfVersion of a missing item must return a not found error but got %v", err)
+	}
+	found, err := s.handler.FindItemByID(s.collection, id)
+	if err != nil || found["name"] != "Anna" || dbhandler.VersionOf(found) != 2 {
+		t.Fatalf("Stale updates must not be written but got %v, %v", found, err)
+	}
+
+	// Writes without expected version increment the version too
+	if err := s.handler.UpdateByID(s.collection, id, map[string]interface{}{"name": "Anna", dbhandler.VersionField: 1}); err != nil {
+		t.Fatalf("UpdateByID must not return error but got %v", err)
+	}
+	if err := s.handler.UpdateBy(s.collection, map[string]interface{}{"name": "Anna"}, map[string]interface{}{"seen": true, dbhandler.VersionField: 1}); err != nil {
+		t.Fatalf("UpdateBy must not return error but got %v", err)
+	}
+	if found, _ = s.handler.FindItemByID(s.collection, id); dbhandler.VersionOf(found) != 4 || found["seen"] != true {
+		t.Errorf("Expected version 4 after two more writes but got %v", found)
+	}
+
+	// Items written before versioning have version 0
+	if version, err = s.handler.UpdateByIDIfVersion(ctx, s.collection, legacy["_id"], 0, map[string]interface{}{"name": "Legacy"}); err != nil || version != 1 {
+		t.Errorf("UpdateByIDIfVersion of an unversioned item must return version 1 but got %d, %v", version, err)
+	}
+
+	upserted, err := s.handler.UpsertItems(ctx, s.collection, []map[string]interface{}{
+		{"_id": id, "rating": 5},
+		{"name": "Binh"},
+	})
+	if err != nil {
+		t.Fatalf("UpsertItems must not return error but got %v", err)
+	}
+	s.ids = append(s.ids, upserted.Items[1].ID)
+	if found, _ = s.handler.FindItemByID(s.collection, id); dbhandler.VersionOf(found) != 5 || found["rating"] != 5 {
+		t.Errorf("UpsertItems must increment the version but got %v", found)
+	}
+	if found, _ = s.handler.FindItemByID(s.collection, upserted.Items[1].ID); dbhandler.VersionOf(found) != 1 {
+		t.Errorf("UpsertItems must insert version 1 but got %v", found)
+	}
+	added, err := s.handler.AddNewItems(ctx, s.collection, []map[string]interface{}{{"name": "Chi"}})
+	if err != nil {
+		t.Fatalf("AddNewItems must not return error but got %v", err)
+	}
+	s.ids = append(s.ids, added.Items[0].ID)
+	if found, _ = s.handler.FindItemByID(s.collection, added.Items[0].ID); dbhandler.VersionOf(found) != 1 {
+		t.Errorf("AddNewItems must insert version 1 but got %v", found)
+	}
+
+	if err := s.handler.RemoveItemByIDIfVersion(ctx, s.collection, id, 4); !dbhandler.IsConflict(err) {
+		t.Errorf("RemoveItemByIDIfVersion with a stale version must return a conflict error but got %v", err)
+	}
+	if err := s.handler.RemoveItemByIDIfVersion(ctx, s.collection, id, 5); err != nil {
+		t.Errorf("RemoveItemByIDIfVersion must not return error but got %v", err)
+	}
+	if err := s.handler.RemoveItemByIDIfVersion(ctx, s.collection, id, 5); !dbhandler.IsNotFound(err) {
+		t.Errorf("RemoveItemByIDIfVersion of a removed item must return a not found error but got %v", err)
+	}
+}
+
+func testAudit(t *testing.T, s *suite) {
+	s.handler.ConfigureCollection(s.collection, dbhandler.CollectionOptions{Timestamps: true, Audit: true})
+	before := time.Now().Add(-time.Second)
+	ctx := dbhandler.WithActor(context.Background(), "creator")
+	inserted, err := s.handler.AddNewItemContext(ctx, s.collection, map[string]interface{}{
+		"name": "Anna", dbhandler.CreatedByField: "someone else",
+	})
+	if err != nil {
+		t.Fatalf("AddNewItemContext must not return error but got %v", err)
+	}
+	id := inserted["_id"]
+	s.ids = append(s.ids, id)
+	found, err := s.handler.FindItemByID(s.collection, id)
+	if err != nil {
+		t.Fatalf("FindItemByID must not return error but got %v", err)
+	}
+	createdAt, ok := found[dbhandler.CreatedAtField].(time.Time)
+	if !ok || createdAt.Before(before) || !createdAt.Equal(found[dbhandler.UpdatedAtField].(time.Time)) {
+		t.Fatalf("New items must get equal created and updated times but got %v", found)
+	}
+	if found[dbhandler.CreatedByField] != "creator" || found[dbhandler.UpdatedByField] != "creator" {
+		t.Fatalf("New items must be created and updated by the actor but got %v", found)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	ctx = dbhandler.WithActor(context.Background(), "editor")
+	if err = s.handler.UpdateByIDContext(ctx, s.collection, id, map[string]interface{}{"name": "Anh", dbhandler.CreatedAtField: before}); err != nil {
+		t.Fatalf("UpdateByIDContext must not return error but got %v", err)
+	}
+	found, _ = s.handler.FindItemByID(s.collection, id)
+	if !createdAt.Equal(found[dbhandler.CreatedAtField].(time.Time)) || found[dbhandler.CreatedByField] != "creator" {
+		t.Errorf("Replacing an item must keep its created fields but got %v", found)
+	}
+	updatedAt, _ := found[dbhandler.UpdatedAtField].(time.Time)
+	if !updatedAt.After(createdAt) || found[dbhandler.UpdatedByField] != "editor" || found["name"] != "Anh" {
+		t.Errorf("Replacing an item must stamp its updated fields but got %v", found)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if err = s.handler.UpdateBy(s.collection, map[string]interface{}{"name": "Anh"}, map[string]interface{}{"seen": true}); err != nil {
+		t.Fatalf("UpdateBy must not return error but got %v", err)
+	}
+	found, _ = s.handler.FindItemByID(s.collection, id)
+	if at, _ := found[dbhandler.UpdatedAtField].(time.Time); !at.After(updatedAt) || found[dbhandler.UpdatedByField] != nil {
+		t.Errorf("Writes without actor must stamp the time and clear the actor but got %v", found)
+	}
+
+	ctx = dbhandler.WithActor(context.Background(), "importer")
+	upserted, err := s.handler.UpsertItems(ctx, s.collection, []map[string]interface{}{
+		{"_id": id, "rating": 5},
+		{"name": "Binh"},
+	})
+	if err != nil {
+		t.Fatalf("UpsertItems must not return error but got %v", err)
+	}
+	s.ids = append(s.ids, upserted.Items[1].ID)
+	found, _ = s.handler.FindItemByID(s.collection, id)
+	if found[dbhandler.CreatedByField] != "creator" || found[dbhandler.UpdatedByField] != "importer" || found["name"] != "Anh" {
+		t.Errorf("UpsertItems must keep the created fields of existing items but got %v", found)
+	}
+	found, _ = s.handler.FindItemByID(s.collection, upserted.Items[1].ID)
+	if found[dbhandler.CreatedByField] != "importer" || found[dbhandler.CreatedAtField] == nil {
+		t.Errorf("UpsertItems must stamp inserted items but got %v", found)
+	}
+	added, err := s.handler.AddNewItems(ctx, s.collection, []map[string]interface{}{{"name": "Chi"}})
+	if err != nil {
+		t.Fatalf("AddNewItems must not return error but got %v", err)
+	}
+	s.ids = append(s.ids, added.Items[0].ID)
+	found, _ = s.handler.FindItemByID(s.collection, added.Items[0].ID)
+	if found[dbhandler.CreatedByField] != "importer" || found[dbhandler.UpdatedAtField] == nil {
+		t.Errorf("AddNewItems must stamp the items but got %v", found)
+	}
+}
+
+func testSoftDelete(t *testing.T, s *suite) {
+	ctx := context.Background()
+	if err := s.handler.RestoreItemByID(ctx, s.collection, bson.NewObjectId()); err != dbhandler.ErrNotSoftDeleted {
+		t.Errorf("RestoreItemByID: expected %v but got %v", dbhandler.ErrNotSoftDeleted, err)
+	}
+	if _, err := s.handler.PurgeDeleted(ctx, s.collection, 0); err != dbhandler.ErrNotSoftDeleted {
+		t.Errorf("PurgeDeleted: expected %v but got %v", dbhandler.ErrNotSoftDeleted, err)
+	}
+
+	s.handler.ConfigureCollection(s.collection, dbhandler.CollectionOptions{SoftDelete: true, Versioned: true})
+	defer s.handler.PurgeDeleted(ctx, s.collection, 0)
+	ids := s.seed(t)
+	if err := s.handler.RemoveItemByID(s.collection, ids[0]); err != nil {
+		t.Fatalf("RemoveItemByID must not return error but got %v", err)
+	}
+	if err := s.handler.RemoveItemByID(s.collection, ids[0]); !dbhandler.IsNotFound(err) {
+		t.Errorf("Removing a removed item must return a not found error but got %v", err)
+	}
+	if _, err := s.handler.FindItemByID(s.collection, ids[0]); !dbhandler.IsNotFound(err) {
+		t.Errorf("Removed items must not be found but got %v", err)
+	}
+	found, err := s.handler.FindItemByIDWithOptions(ctx, s.collection, ids[0], dbhandler.FindOptions{Deleted: dbhandler.IncludeDeleted})
+	if err != nil || found[dbhandler.DeletedAtField] == nil || dbhandler.VersionOf(found) != 2 {
+		t.Fatalf("Removed items must keep their fields with a deletion time but got %v, %v", found, err)
+	}
+	if err := s.handler.UpdateByID(s.collection, ids[0], map[string]interface{}{"name": "Anna"}); !dbhandler.IsNotFound(err) {
+		t.Errorf("Updating a removed item must return a not found error but got %v", err)
+	}
+	if err := s.handler.UpdateBy(s.collection, nil, map[string]interface{}{"seen": true, dbhandler.DeletedAtField: nil}); err != nil {
+		t.Fatalf("UpdateBy must not return error but got %v", err)
+	}
+	upserted, err := s.handler.UpsertItems(ctx, s.collection, []map[string]interface{}{{"_id": ids[0], "name": "Anna"}})
+	if err == nil || !dbhandler.IsDuplicateKey(upserted.Items[0].Err) {
+		t.Errorf("Upserting a removed item must return a duplicate key error but got %v", err)
+	}
+	removed, err := s.handler.RemoveItemsBy(ctx, s.collection, dbhandler.Eq("specialty", "dermatology"))
+	if err != nil || removed != 2 {
+		t.Fatalf("RemoveItemsBy must remove 2 items but got %d, %v", removed, err)
+	}
+
+	tests := []struct {
+		name    string
+		deleted dbhandler.DeletedItems
+		want    []interface{}
+	}{
+		{"exclude", dbhandler.ExcludeDeleted, []interface{}{"Chi", "Em"}},
+		{"include", dbhandler.IncludeDeleted, []interface{}{"Anna", "Binh", "Chi", "Dung", "Em"}},
+		{"only", dbhandler.OnlyDeleted, []interface{}{"Anna", "Binh", "Dung"}},
+	}
+	for _, tt := range tests {
+		opts := dbhandler.ListOptions{Sort: []dbhandler.SortKey{{Field: "name"}}, Deleted: tt.deleted}
+		results, err := s.handler.ListItems(ctx, s.collection, 10, 1, opts)
+		if err != nil || !reflect.DeepEqual(names(results.Items), tt.want) {
+			t.Errorf("%s: expected %v but got %v, %v", tt.name, tt.want, names(results.Items), err)
+		}
+		after, err := s.handler.ListItemsAfter(ctx, s.collection, 10, "", opts)
+		if err != nil || !reflect.DeepEqual(names(after.Items), tt.want) {
+			t.Errorf("%s: expected %v after cursor but got %v, %v", tt.name, tt.want, names(after.Items), err)
+		}
+	}
+	if found, _ = s.handler.FindItemByIDWithOptions(ctx, s.collection, ids[2], dbhandler.FindOptions{}); found["seen"] != true {
+		t.Errorf("UpdateBy must update items which are not removed but got %v", found)
+	}
+	if found, _ = s.handler.FindItemByIDWithOptions(ctx, s.collection, ids[0], dbhandler.FindOptions{Deleted: dbhandler.OnlyDeleted}); found["seen"] != nil {
+		t.Errorf("UpdateBy must not update removed items but got %v", found)
+	}
+
+	if err := s.handler.RestoreItemByID(ctx, s.collection, ids[0]); err != nil {
+		t.Fatalf("RestoreItemByID must not return error but got %v", err)
+	}
+	if err := s.handler.RestoreItemByID(ctx, s.collection, ids[0]); !dbhandler.IsNotFound(err) {
+		t.Errorf("Restoring an item which is not removed must return a not found error but got %v", err)
+	}
+	found, err = s.handler.FindItemByID(s.collection, ids[0])
+	if err != nil || found[dbhandler.DeletedAtField] != nil || dbhandler.VersionOf(found) != 3 {
+		t.Errorf("Restored items must be found without deletion time but got %v, %v", found, err)
+	}
+
+	if purged, err := s.handler.PurgeDeleted(ctx, s.collection, time.Hour); err != nil || purged != 0 {
+		t.Errorf("PurgeDeleted must keep items removed within the retention but purged %d, %v", purged, err)
+	}
+	if purged, err := s.handler.PurgeDeleted(ctx, s.collection, 0); err != nil || purged != 2 {
+		t.Errorf("PurgeDeleted must purge 2 items but purged %d, %v", purged, err)
+	}
+	results, _ := s.handler.ListItems(ctx, s.collection, 10, 1, dbhandler.ListOptions{Deleted: dbhandler.IncludeDeleted})
+	if results.Total != 3 {
+		t.Errorf("Expected 3 items after purging but got %d", results.Total)
+	}
+}
+
+func testContext(t *testing.T, s *suite) {
+	ids := s.seed(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.handler.GetAllItemsContext(ctx, s.collection, 10, 1, "ASC", "name", nil); err != context.Canceled {
+		t.Errorf("GetAllItemsContext: expected %v but got %v", context.Canceled, err)
+	}
+	if _, err := s.handler.AddNewItemContext(ctx, s.collection, map[string]interface{}{}); err != context.Canceled {
+		t.Errorf("AddNewItemContext: expected %v but got %v", context.Canceled, err)
+	}
+	if _, err := s.handler.FindItemByIDContext(ctx, s.collection, ids[0]); err != context.Canceled {
+		t.Errorf("FindItemByIDContext: expected %v but got %v", context.Canceled, err)
+	}
+	if err := s.handler.UpdateByContext(ctx, s.collection, nil, map[string]interface{}{"seen": true}); err != context.Canceled {
+		t.Errorf("UpdateByContext: expected %v but got %v", context.Canceled, err)
+	}
+	if err := s.handler.RemoveItemByIDContext(ctx, s.collection, ids[0]); err != context.Canceled {
+		t.Errorf("RemoveItemByIDContext: expected %v but got %v", context.Canceled, err)
+	}
+	if err := s.handler.Ping(ctx); err != context.Canceled {
+		t.Errorf("Ping: expected %v but got %v", context.Canceled, err)
+	}
+	if err := s.handler.Ping(context.Background()); err != nil {
+		t.Errorf("Ping must not return error but got %v", err)
+	}
+	results, err := s.handler.GetAllItemsContext(context.Background(), s.collection, 10, 1, "ASC", "name", nil)
+	if err != nil {
+		t.Fatalf("GetAllItemsContext must not return error but got %v", err)
+	}
+	if results.Total != len(ids) {
+		t.Errorf("Cancelled calls must not write, expected %d items but got %d", len(ids), results.Total)
+	}
+}
+
+func testItemsByKey(t *testing.T, s *suite) {
+	ids := s.seed(t)
+	results, err := s.handler.GetAllItemsByKey(s.collection, 2, 1, "DESC", "rating",
+		map[string]interface{}{"specialty": "cardiology"}, "name")
+	if err != nil {
+		t.Fatalf("GetAllItemsByKey must not return error but got %v", err)
+	}
+	expected := []map[string]interface{}{{"_id": ids[4], "name": "Em"}, {"_id": ids[2], "name": "Chi"}}
+	if results.Total != 3 || !reflect.DeepEqual(results.Items, expected) {
+		t.Fatalf("Expected %v of 3 items but got %v of %d", expected, results.Items, results.Total)
+	}
+	all, err := s.handler.GetAllItemsNoLimit(s.collection, "rating")
+	if err != nil {
+		t.Fatalf("GetAllItemsNoLimit must not return error but got %v", err)
+	}
+	if len(all) != len(ids) {
+		t.Fatalf("Expected %d items but got %v", len(ids), all)
+	}
+	for index, item := range all {
+		if item["_id"] != ids[index] || len(item) != 2 {
+			t.Fatalf("Items must be sorted by _id with only the key but got %v", all)
+		}
+	}
+	whole, err := s.handler.GetAllItemsNoLimit(s.collection, "")
+	if err != nil || len(whole) != len(ids) || whole[0]["name"] != "Anna" {
+		t.Fatalf("Empty key must return whole items but got %v, %v", whole, err)
+	}
+	if _, err = s.handler.GetAllItemsNoLimit(s.collection, "$bad"); dbhandler.KindOf(err) != dbhandler.ErrInvalidProjection {
+		t.Errorf("Expected invalid projection error but got %v", err)
+	}
+	empty, err := s.handler.GetAllItemsNoLimit("conformance_empty_"+bson.NewObjectId().Hex(), "name")
+	if err != nil || empty == nil || len(empty) != 0 {
+		t.Errorf("Empty collection must return no items but got %v, %v", empty, err)
+	}
+}
+
+func testIterate(t *testing.T, s *suite) {
+	s.seed(t)
+	ctx := context.Background()
+	it, err := s.handler.IterateItems(ctx, s.collection, dbhandler.IterateOptions{
+		ListOptions: dbhandler.ListOptions{
+			Filters:    map[string]interface{}{"specialty": "cardiology"},
+			Sort:       []dbhandler.SortKey{{Field: "name", Desc: true}},
+			Projection: dbhandler.Projection{Include: []string{"name"}},
+		},
+		BatchSize: 2,
+	})
+	if err != nil {
+		t.Fatalf("IterateItems must not return error but got %v", err)
+	}
+	var items []map[string]interface{}
+	for it.Next() {
+		items = append(items, it.Item())
+	}
+	if err = it.Err(); err != nil {
+		t.Fatalf("Iteration must not fail but got %v", err)
+	}
+	if got := names(items); !reflect.DeepEqual(got, []interface{}{"Em", "Chi", "Anna"}) {
+		t.Fatalf("Expected Em, Chi and Anna but got %v", got)
+	}
+	if len(items[0]) != 2 {
+		t.Errorf("Items must be projected but got %v", items[0])
+	}
+	if it.Next() || it.Close() != nil || it.Close() != nil {
+		t.Errorf("Finished iterator must stay finished and close without error")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	it, err = s.handler.IterateItems(cancelled, s.collection, dbhandler.IterateOptions{BatchSize: 1})
+	if err != nil {
+		t.Fatalf("IterateItems must not return error but got %v", err)
+	}
+	if !it.Next() {
+		t.Fatalf("Iterator must return the first item but got %v", it.Err())
+	}
+	cancel()
+	if it.Next() || it.Err() != context.Canceled || it.Close() != context.Canceled {
+		t.Fatalf("Cancelled iteration must stop with %v but got %v", context.Canceled, it.Err())
+	}
+
+	visited := 0
+	err = dbhandler.ForEach(mustIterate(t, s), func(item map[string]interface{}) error {
+		visited++
+		return nil
+	})
+	if err != nil || visited != 5 {
+		t.Errorf("ForEach must visit the 5 items but visited %d with %v", visited, err)
+	}
+	if _, err = s.handler.IterateItems(ctx, s.collection, dbhandler.IterateOptions{
+		ListOptions: dbhandler.ListOptions{Sort: []dbhandler.SortKey{{Field: "$bad"}}},
+	}); dbhandler.KindOf(err) != dbhandler.ErrInvalidSort {
+		t.Errorf("Expected invalid sort error but got %v", err)
+	}
+}
+
+func mustIterate(t *testing.T, s *suite) dbhandler.Iterator {
+	it, err := s.handler.IterateItems(context.Background(), s.collection, dbhandler.IterateOptions{})
+	if err != nil {
+		t.Fatalf("IterateItems must not return error but got %v", err)
+	}
+	return it
+}
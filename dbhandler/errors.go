@@ -0,0 +1,138 @@
+package dbhandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error kinds every implementation maps its errors to
+var (
+	// ErrNotFound is returned when no item has the given id
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidID is returned when an id is not a valid object id
+	ErrInvalidID = errors.New("invalid id")
+	// ErrDuplicateKey is returned when a write breaks a unique index
+	ErrDuplicateKey = errors.New("duplicate key")
+	// ErrConflict is returned when a write conflicts with the stored state
+	ErrConflict = errors.New("conflict")
+	// ErrUnavailable is returned when the database cannot be reached
+	ErrUnavailable = errors.New("database unavailable")
+	// ErrTimeout is returned when the database did not answer in time
+	ErrTimeout = errors.New("timeout")
+)
+
+// Error is an error of a known kind, like ErrNotFound or ErrInvalidSort,
+// with the error which caused it
+type Error struct {
+	Kind error
+	Err  error
+}
+
+// NewError creates an error of the given kind caused by err
+func NewError(kind error, err error) error {
+	return &Error{Kind: kind, Err: err}
+}
+
+// Errorf creates an error of the given kind with a formatted message
+func Errorf(kind error, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Kind.Error()
+	}
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error which caused e
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is tells whether target is the kind of e
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// wrapper is implemented by errors wrapping another error
+type wrapper interface {
+	Unwrap() error
+}
+
+// KindOf returns the kind of err, walking through wrapped errors.
+// It returns nil when err has no known kind.
+func KindOf(err error) error {
+	for err != nil {
+		switch err {
+		case ErrNotFound, ErrInvalidID, ErrDuplicateKey, ErrConflict, ErrUnavailable, ErrTimeout,
+			ErrInvalidCursor, ErrInvalidLimit, ErrInvalidSort, ErrInvalidProjection, ErrInvalidFilter, ErrInvalidIndex,
+			ErrInvalidConfig, ErrInvalidETag:
+			return err
+		case context.DeadlineExceeded:
+			return ErrTimeout
+		}
+		if e, ok := err.(*Error); ok {
+			return e.Kind
+		}
+		unwrapped, ok := err.(wrapper)
+		if !ok {
+			return nil
+		}
+		err = unwrapped.Unwrap()
+	}
+	return nil
+}
+
+// IsNotFound tells whether err is of kind ErrNotFound
+func IsNotFound(err error) bool {
+	return KindOf(err) == ErrNotFound
+}
+
+// IsInvalidID tells whether err is of kind ErrInvalidID
+func IsInvalidID(err error) bool {
+	return KindOf(err) == ErrInvalidID
+}
+
+// IsDuplicateKey tells whether err is of kind ErrDuplicateKey
+func IsDuplicateKey(err error) bool {
+	return KindOf(err) == ErrDuplicateKey
+}
+
+// IsConflict tells whether err is of kind ErrConflict
+func IsConflict(err error) bool {
+	return KindOf(err) == ErrConflict
+}
+
+// IsUnavailable tells whether err is of kind ErrUnavailable
+func IsUnavailable(err error) bool {
+	return KindOf(err) == ErrUnavailable
+}
+
+// IsTimeout tells whether err is of kind ErrTimeout
+func IsTimeout(err error) bool {
+	return KindOf(err) == ErrTimeout
+}
+
+// HTTPStatus returns the HTTP status code matching the kind of err:
+// 404 for not found, 400 for bad input, 409 for duplicates and conflicts,
+// 503 when the database is unavailable or too slow and 500 otherwise
+func HTTPStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	switch KindOf(err) {
+	case ErrNotFound:
+		return http.StatusNotFound
+	case ErrDuplicateKey, ErrConflict:
+		return http.StatusConflict
+	case ErrUnavailable, ErrTimeout:
+		return http.StatusServiceUnavailable
+	case ErrInvalidID, ErrInvalidCursor, ErrInvalidLimit, ErrInvalidSort, ErrInvalidProjection, ErrInvalidFilter,
+		ErrInvalidETag:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
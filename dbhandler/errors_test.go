@@ -0,0 +1,81 @@
+package dbhandler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+type wrappedError struct {
+	err error
+}
+
+func (e wrappedError) Error() string { return "wrapped: " + e.err.Error() }
+func (e wrappedError) Unwrap() error { return e.err }
+
+func TestKindOf(t *testing.T) {
+	cause := errors.New("E11000 duplicate key error")
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"nil", nil, nil},
+		{"unknown", errors.New("boom"), nil},
+		{"sentinel", ErrNotFound, ErrNotFound},
+		{"error", NewError(ErrDuplicateKey, cause), ErrDuplicateKey},
+		{"wrapped", wrappedError{NewError(ErrConflict, cause)}, ErrConflict},
+		{"wrapped sentinel", wrappedError{ErrInvalidID}, ErrInvalidID},
+		{"deadline", context.DeadlineExceeded, ErrTimeout},
+		{"validation", Errorf(ErrInvalidSort, "bad field name %q", "$where"), ErrInvalidSort},
+		{"cursor", ErrInvalidCursor, ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := KindOf(tt.err); got != tt.want {
+				t.Errorf("KindOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if !IsDuplicateKey(NewError(ErrDuplicateKey, cause)) || IsNotFound(NewError(ErrDuplicateKey, cause)) {
+		t.Errorf("IsDuplicateKey must only match duplicate key errors")
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	if got := Errorf(ErrInvalidSort, "bad field name %q", "$where").Error(); got != `invalid sort: bad field name "$where"` {
+		t.Errorf("Unexpected message %s", got)
+	}
+	if got := NewError(ErrNotFound, nil).Error(); got != "not found" {
+		t.Errorf("Unexpected message %s", got)
+	}
+	err := NewError(ErrTimeout, context.DeadlineExceeded).(*Error)
+	if err.Unwrap() != context.DeadlineExceeded || !err.Is(ErrTimeout) || err.Is(ErrNotFound) {
+		t.Errorf("Error must unwrap to its cause and be its kind")
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, http.StatusOK},
+		{errors.New("boom"), http.StatusInternalServerError},
+		{NewError(ErrNotFound, nil), http.StatusNotFound},
+		{NewError(ErrInvalidID, nil), http.StatusBadRequest},
+		{Errorf(ErrInvalidFilter, "operator %q is not allowed", "$where"), http.StatusBadRequest},
+		{ErrInvalidCursor, http.StatusBadRequest},
+		{Errorf(ErrInvalidETag, "malformed entity tag %q", "7"), http.StatusBadRequest},
+		{NewError(ErrDuplicateKey, nil), http.StatusConflict},
+		{NewError(ErrConflict, nil), http.StatusConflict},
+		{NewError(ErrUnavailable, nil), http.StatusServiceUnavailable},
+		{context.DeadlineExceeded, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		if got := HTTPStatus(tt.err); got != tt.want {
+			t.Errorf("HTTPStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Package events emits a change event for every item written through a dbhandler.DatabaseHandler,
+// so other services learn about changes without posting notifications by hand.
+package events
+
+import (
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Operation is the kind of write which changed an item
+type Operation string
+
+// Operations reported in change events
+const (
+	OpInsert Operation = "insert"
+	OpUpdate Operation = "update"
+	OpDelete Operation = "delete"
+)
+
+// ChangeEvent describes the change of one item. Before is empty for inserts and
+// After for deletes, Diff lists the top level fields which changed. AfterUnknown is set
+// when the item could not be read after an update, After and Diff are then empty.
+// Key identifies the event, an event delivered again has the same key.
+type ChangeEvent struct {
+	Key          string                 `json:"key"`
+	Collection   string                 `json:"collection"`
+	Operation    Operation              `json:"operation"`
+	ID           string                 `json:"id"`
+	Time         time.Time              `json:"time"`
+	Actor        string                 `json:"actor,omitempty"`
+	Before       map[string]interface{} `json:"before,omitempty"`
+	After        map[string]interface{} `json:"after,omitempty"`
+	Diff         []FieldChange          `json:"diff,omitempty"`
+	AfterUnknown bool                   `json:"afterUnknown,omitempty"`
+}
+
+// FieldChange is the change of one field, a missing value is nil
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// Diff returns the top level fields whose value differs between before and after, sorted by name
+func Diff(before map[string]interface{}, after map[string]interface{}) []FieldChange {
+	fields := map[string]bool{}
+	for field := range before {
+		fields[field] = true
+	}
+	for field := range after {
+		fields[field] = true
+	}
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+	var changes []FieldChange
+	for _, field := range names {
+		oldValue, hadValue := before[field]
+		newValue, hasValue := after[field]
+		if hadValue == hasValue && equal(oldValue, newValue) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: field, Before: oldValue, After: newValue})
+	}
+	return changes
+}
+
+// equal compares two field values, times are equal when they are the same instant
+func equal(a interface{}, b interface{}) bool {
+	if at, ok := a.(time.Time); ok {
+		bt, ok := b.(time.Time)
+		return ok && at.Equal(bt)
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,32 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	at := time.Now()
+	tests := []struct {
+		name   string
+		before map[string]interface{}
+		after  map[string]interface{}
+		want   []FieldChange
+	}{
+		{"insert", nil, map[string]interface{}{"name": "Anna"}, []FieldChange{{Field: "name", After: "Anna"}}},
+		{"delete", map[string]interface{}{"name": "Anna"}, nil, []FieldChange{{Field: "name", Before: "Anna"}}},
+		{"unchanged", map[string]interface{}{"tags": []string{"a"}, "at": at}, map[string]interface{}{"tags": []string{"a"}, "at": at.UTC()}, nil},
+		{"set to nil", map[string]interface{}{"rating": 4}, map[string]interface{}{"rating": nil}, []FieldChange{{Field: "rating", Before: 4}}},
+		{"sorted", map[string]interface{}{"b": 1, "a": 1, "c": 1}, map[string]interface{}{"c": 2, "b": 1}, []FieldChange{
+			{Field: "a", Before: 1}, {Field: "c", Before: 1, After: 2},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff(tt.before, tt.after); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Expected %v but got %v", tt.want, got)
+			}
+		})
+	}
+}
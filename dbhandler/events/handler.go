@@ -0,0 +1,299 @@
+package events
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/doctor-services/services/dbhandler"
+	mongoHelper "github.com/doctor-services/services/helper/mongo"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// listPageSize is the page size used to read the items an UpdateBy selects
+const listPageSize = 100
+
+// eventHandler records a change event for every item written through the handler it wraps.
+// Without outbox the events are published to sink once the write succeeded.
+type eventHandler struct {
+	dbhandler.DatabaseHandler
+	sink   Sink
+	outbox *outbox
+}
+
+// change is the write of one item
+type change struct {
+	operation Operation
+	id        interface{}
+	before    map[string]interface{}
+	after     map[string]interface{}
+	// afterUnknown is set when the updated item could not be read after the write
+	afterUnknown bool
+}
+
+// NewEventHandler wraps handler so AddNewItem, UpdateByID, UpdateBy, RemoveItemByID, their
+// context variants and the version checked writes publish change events to sink.
+// Items are read before and after the write to fill the event, so events of concurrent
+// writes to the same item may show intermediate states. When an updated item cannot be read
+// after the write, its event has no After and Diff and AfterUnknown is set. Events are
+// published once the write succeeded, a failing sink is logged and does not fail the write.
+// Bulk writes, RestoreItemByID and PurgeDeleted publish no events.
+func NewEventHandler(handler dbhandler.DatabaseHandler, sink Sink) dbhandler.DatabaseHandler {
+	return &eventHandler{DatabaseHandler: handler, sink: sink}
+}
+
+func (h *eventHandler) AddNewItem(dataName string, item map[string]interface{}) (map[string]interface{}, error) {
+	return h.AddNewItemContext(context.Background(), dataName, item)
+}
+
+func (h *eventHandler) AddNewItemContext(ctx context.Context, dataName string, item map[string]interface{}) (map[string]interface{}, error) {
+	// The id is chosen here, so the event can be recorded before the write
+	doc, objectID, err := mongoHelper.NewItemDoc(item)
+	if err != nil {
+		return h.DatabaseHandler.AddNewItemContext(ctx, dataName, item)
+	}
+	var inserted map[string]interface{}
+	changes := []*change{{operation: OpInsert, id: objectID.Hex()}}
+	err = h.record(ctx, dataName, changes, func() error {
+		var err error
+		inserted, err = h.DatabaseHandler.AddNewItemContext(ctx, dataName, doc)
+		changes[0].after = mongoHelper.CloneStringMap(inserted)
+		return err
+	})
+	return inserted, err
+}
+
+func (h *eventHandler) RemoveItemByID(dataName string, id interface{}) error {
+	return h.RemoveItemByIDContext(context.Background(), dataName, id)
+}
+
+func (h *eventHandler) RemoveItemByIDContext(ctx context.Context, dataName string, id interface{}) error {
+	changes, err := h.changeOf(ctx, dataName, OpDelete, id)
+	if err != nil {
+		return err
+	}
+	return h.record(ctx, dataName, changes, func() error {
+		return h.DatabaseHandler.RemoveItemByIDContext(ctx, dataName, id)
+	})
+}
+
+func (h *eventHandler) RemoveItemByIDIfVersion(ctx context.Context, dataName string, id interface{}, version int64) error {
+	changes, err := h.changeOf(ctx, dataName, OpDelete, id)
+	if err != nil {
+		return err
+	}
+	return h.record(ctx, dataName, changes, func() error {
+		return h.DatabaseHandler.RemoveItemByIDIfVersion(ctx, dataName, id, version)
+	})
+}
+
+func (h *eventHandler) UpdateByID(dataName string, id interface{}, update map[string]interface{}) error {
+	return h.UpdateByIDContext(context.Background(), dataName, id, update)
+}
+
+func (h *eventHandler) UpdateByIDContext(ctx context.Context, dataName string, id interface{}, update map[string]interface{}) error {
+	changes, err := h.changeOf(ctx, dataName, OpUpdate, id)
+	if err != nil {
+		return err
+	}
+	return h.record(ctx, dataName, changes, func() error {
+		return h.DatabaseHandler.UpdateByIDContext(ctx, dataName, id, update)
+	})
+}
+
+func (h *eventHandler) UpdateByIDIfVersion(ctx context.Context, dataName string, id interface{}, version int64,
+	update map[string]interface{}) (int64, error) {
+	changes, err := h.changeOf(ctx, dataName, OpUpdate, id)
+	if err != nil {
+		return 0, err
+	}
+	var newVersion int64
+	err = h.record(ctx, dataName, changes, func() error {
+		var err error
+		newVersion, err = h.DatabaseHandler.UpdateByIDIfVersion(ctx, dataName, id, version, update)
+		return err
+	})
+	return newVersion, err
+}
+
+func (h *eventHandler) UpdateBy(dataName string, selector interface{}, update map[string]interface{}) error {
+	return h.UpdateByContext(context.Background(), dataName, selector, update)
+}
+
+// UpdateByContext records an event for every selected item. The selector must be
+// nil, a filter map or a bson.D, see dbhandler.ParseFilterMap. The selected items are
+// read in pages before the write and again after it, neither read is atomic with the
+// write: items written meanwhile may be missed or show other changes. The states read
+// before are held until the events are recorded.
+func (h *eventHandler) UpdateByContext(ctx context.Context, dataName string, selector interface{}, update map[string]interface{}) error {
+	befores, err := h.selected(ctx, dataName, selector)
+	if err != nil {
+		return err
+	}
+	changes := make([]*change, len(befores))
+	for index, before := range befores {
+		changes[index] = &change{operation: OpUpdate, id: before["_id"], before: before}
+	}
+	return h.record(ctx, dataName, changes, func() error {
+		return h.DatabaseHandler.UpdateByContext(ctx, dataName, selector, update)
+	})
+}
+
+// changeOf reads the item a write of one item changes
+func (h *eventHandler) changeOf(ctx context.Context, dataName string, operation Operation, id interface{}) ([]*change, error) {
+	before, err := h.FindItemByIDContext(ctx, dataName, id)
+	if err != nil {
+		return nil, err
+	}
+	return []*change{{operation: operation, id: before["_id"], before: before}}, nil
+}
+
+// selected reads the items an UpdateBy with selector writes
+func (h *eventHandler) selected(ctx context.Context, dataName string, selector interface{}) ([]map[string]interface{}, error) {
+	var filters map[string]interface{}
+	switch s := selector.(type) {
+	case nil:
+	case bson.M:
+		filters = s
+	case map[string]interface{}:
+		filters = s
+	case bson.D:
+		filters = s.Map()
+	default:
+		return nil, dbhandler.Errorf(dbhandler.ErrInvalidFilter, "cannot read the items selected by a %T", selector)
+	}
+	var items []map[string]interface{}
+	cursor := ""
+	for {
+		page, err := h.ListItemsAfter(ctx, dataName, listPageSize, cursor, dbhandler.ListOptions{Filters: filters})
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page.Items...)
+		if !page.HasNextPage {
+			return items, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// record runs write and records the events of its changes. With outbox the events are
+// stored as pending before the write and marked ready after it, otherwise they are published.
+func (h *eventHandler) record(ctx context.Context, dataName string, changes []*change, write func() error) error {
+	var keys []bson.ObjectId
+	if h.outbox != nil {
+		var err error
+		if keys, err = h.outbox.begin(ctx, dataName, changes); err != nil {
+			return err
+		}
+	}
+	if err := write(); err != nil {
+		if h.outbox != nil {
+			h.outbox.abort(keys)
+		}
+		return err
+	}
+	h.readAfter(ctx, dataName, changes)
+	events := make([]ChangeEvent, len(changes))
+	for index, change := range changes {
+		events[index] = newEvent(ctx, dataName, change)
+	}
+	if h.outbox != nil {
+		// Entries whose item could not be read stay pending, the relay then reads it
+		var ready []bson.ObjectId
+		var readyEvents []ChangeEvent
+		for index := range events {
+			if changes[index].afterUnknown {
+				continue
+			}
+			events[index].Key = keys[index].Hex()
+			ready = append(ready, keys[index])
+			readyEvents = append(readyEvents, events[index])
+		}
+		h.outbox.commit(ready, readyEvents)
+		return nil
+	}
+	for index := range events {
+		events[index].Key = bson.NewObjectId().Hex()
+	}
+	h.publish(ctx, events)
+	return nil
+}
+
+// readAfter reads the updated items of changes in pages of listPageSize. The changes
+// of the items which cannot be read are marked afterUnknown.
+func (h *eventHandler) readAfter(ctx context.Context, dataName string, changes []*change) {
+	var updated []*change
+	for _, change := range changes {
+		if change.operation == OpUpdate {
+			updated = append(updated, change)
+		}
+	}
+	for start := 0; start < len(updated); start += listPageSize {
+		end := start + listPageSize
+		if end > len(updated) {
+			end = len(updated)
+		}
+		page := updated[start:end]
+		ids := make([]interface{}, 0, len(page))
+		for _, change := range page {
+			if id, err := mongoHelper.CreateObjectID(change.id); err == nil {
+				ids = append(ids, id)
+			}
+		}
+		afters := map[string]map[string]interface{}{}
+		results, err := h.ListItemsAfter(ctx, dataName, len(page), "", dbhandler.ListOptions{Filter: dbhandler.In("_id", ids...)})
+		if err != nil {
+			log.Printf("[App.db]: Error during reading %d updated items of %s. %s\n", len(page), dataName, err)
+		}
+		for _, item := range results.Items {
+			afters[idString(item["_id"])] = item
+		}
+		for _, change := range page {
+			change.after = afters[idString(change.id)]
+			change.afterUnknown = change.after == nil
+		}
+	}
+}
+
+func (h *eventHandler) publish(ctx context.Context, events []ChangeEvent) {
+	if len(events) == 0 {
+		return
+	}
+	if err := h.sink.Publish(ctx, events); err != nil {
+		log.Printf("[App.db]: Error during publishing %d change events of %s. %s\n", len(events), events[0].Collection, err)
+	}
+}
+
+// newEvent returns the change event of a finished write
+func newEvent(ctx context.Context, dataName string, change *change) ChangeEvent {
+	actor, _ := dbhandler.ActorFrom(ctx)
+	event := ChangeEvent{
+		Collection: dataName,
+		Operation:  change.operation,
+		ID:         idString(change.id),
+		Time:       time.Now().UTC(),
+		Actor:      actor,
+		Before:     change.before,
+	}
+	if change.afterUnknown {
+		// Without the state after the write every field would look removed
+		event.AfterUnknown = true
+		return event
+	}
+	event.After = change.after
+	event.Diff = Diff(change.before, change.after)
+	return event
+}
+
+// idString returns the hex form of an item id
+func idString(id interface{}) string {
+	if objectID, ok := id.(bson.ObjectId); ok {
+		return objectID.Hex()
+	}
+	if hex, ok := id.(string); ok {
+		return hex
+	}
+	return ""
+}
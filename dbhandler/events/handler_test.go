@@ -0,0 +1,169 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/doctor-services/services/dbhandler"
+	"github.com/doctor-services/services/dbhandler/memory"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+const CollectionName = "test_collection"
+
+func TestEventHandler(t *testing.T) {
+	var published []ChangeEvent
+	handler := NewEventHandler(memory.NewMemoryHandler(), SinkFunc(func(ctx context.Context, events []ChangeEvent) error {
+		published = append(published, events...)
+		return nil
+	}))
+	ctx := dbhandler.WithActor(context.Background(), "doctor-1")
+	anna, err := handler.AddNewItemContext(ctx, CollectionName, map[string]interface{}{"name": "Anna", "rating": 4})
+	if err != nil {
+		t.Fatalf("Insert item must not return error but got %v", err)
+	}
+	binh, _ := handler.AddNewItem(CollectionName, map[string]interface{}{"name": "Binh", "rating": 4})
+	if err = handler.UpdateByIDContext(ctx, CollectionName, anna["_id"], map[string]interface{}{"name": "Anh", "rating": 4}); err != nil {
+		t.Fatalf("Update by id must not return error but got %v", err)
+	}
+	if err = handler.UpdateBy(CollectionName, map[string]interface{}{"rating": 4}, map[string]interface{}{"seen": true}); err != nil {
+		t.Fatalf("Update by must not return error but got %v", err)
+	}
+	if err = handler.RemoveItemByID(CollectionName, binh["_id"]); err != nil {
+		t.Fatalf("Remove must not return error but got %v", err)
+	}
+	if err = handler.RemoveItemByID(CollectionName, binh["_id"]); !dbhandler.IsNotFound(err) {
+		t.Fatalf("Expected not found error but got %v", err)
+	}
+	expected := []struct {
+		operation Operation
+		id        interface{}
+		changed   []string
+	}{
+		{OpInsert, anna["_id"], []string{"_id", "name", "rating"}},
+		{OpInsert, binh["_id"], []string{"_id", "name", "rating"}},
+		{OpUpdate, anna["_id"], []string{"name"}},
+		{OpUpdate, anna["_id"], []string{"seen"}},
+		{OpUpdate, binh["_id"], []string{"seen"}},
+		{OpDelete, binh["_id"], []string{"_id", "name", "rating", "seen"}},
+	}
+	if len(published) != len(expected) {
+		t.Fatalf("Expected %d events but got %v", len(expected), published)
+	}
+	for index, want := range expected {
+		event := published[index]
+		var changed []string
+		for _, change := range event.Diff {
+			changed = append(changed, change.Field)
+		}
+		if event.Collection != CollectionName || event.Operation != want.operation || event.ID != want.id ||
+			len(changed) != len(want.changed) {
+			t.Fatalf("Event %d: expected %s of %v changing %v but got %+v", index, want.operation, want.id, want.changed, event)
+		}
+		for position, field := range want.changed {
+			if changed[position] != field {
+				t.Fatalf("Event %d: expected changes of %v but got %v", index, want.changed, changed)
+			}
+		}
+	}
+	if published[0].Actor != "doctor-1" || published[1].Actor != "" || published[2].Before["name"] != "Anna" || published[2].After["name"] != "Anh" {
+		t.Errorf("Events must carry the actor and both states but got %+v", published[:3])
+	}
+	if err = handler.UpdateBy(CollectionName, []interface{}{}, map[string]interface{}{}); dbhandler.KindOf(err) != dbhandler.ErrInvalidFilter {
+		t.Errorf("Expected invalid filter error but got %v", err)
+	}
+}
+
+func TestEventHandlerUpdateByPages(t *testing.T) {
+	store := memory.NewMemoryHandler()
+	items := make([]map[string]interface{}, listPageSize+20)
+	for index := range items {
+		items[index] = map[string]interface{}{"rating": 4}
+	}
+	if _, err := store.AddNewItems(context.Background(), CollectionName, items); err != nil {
+		t.Fatalf("Insert items must not return error but got %v", err)
+	}
+	var published []ChangeEvent
+	handler := NewEventHandler(store, SinkFunc(func(ctx context.Context, events []ChangeEvent) error {
+		published = append(published, events...)
+		return nil
+	}))
+	// Selectors accepted by the wrapped handler must be accepted by the event handler
+	if err := handler.UpdateBy(CollectionName, bson.D{{Name: "rating", Value: 4}}, map[string]interface{}{"seen": true}); err != nil {
+		t.Fatalf("Update by a bson.D selector must not return error but got %v", err)
+	}
+	if len(published) != len(items) {
+		t.Fatalf("Expected %d events but got %d", len(items), len(published))
+	}
+	for index, event := range published {
+		if event.AfterUnknown || len(event.Diff) != 1 || event.Diff[0].Field != "seen" || event.After["seen"] != true {
+			t.Fatalf("Event %d must carry the state after the update but got %+v", index, event)
+		}
+	}
+}
+
+// readFailingHandler fails every read once an update was written
+type readFailingHandler struct {
+	dbhandler.DatabaseHandler
+	failing bool
+}
+
+func (h *readFailingHandler) UpdateByIDContext(ctx context.Context, dataName string, id interface{}, update map[string]interface{}) error {
+	err := h.DatabaseHandler.UpdateByIDContext(ctx, dataName, id, update)
+	h.failing = dataName == CollectionName
+	return err
+}
+
+func (h *readFailingHandler) FindItemByIDContext(ctx context.Context, dataName string, id interface{}) (map[string]interface{}, error) {
+	if h.failing {
+		return nil, dbhandler.Errorf(dbhandler.ErrUnavailable, "read failed")
+	}
+	return h.DatabaseHandler.FindItemByIDContext(ctx, dataName, id)
+}
+
+func (h *readFailingHandler) ListItemsAfter(ctx context.Context, dataName string, limit int, cursor string,
+	opts dbhandler.ListOptions) (dbhandler.CursorResults, error) {
+	if h.failing {
+		return dbhandler.CursorResults{}, dbhandler.Errorf(dbhandler.ErrUnavailable, "read failed")
+	}
+	return h.DatabaseHandler.ListItemsAfter(ctx, dataName, limit, cursor, opts)
+}
+
+func TestEventHandlerAfterReadFails(t *testing.T) {
+	store := memory.NewMemoryHandler()
+	anna, _ := store.AddNewItem(CollectionName, map[string]interface{}{"name": "Anna"})
+	var published []ChangeEvent
+	handler := NewEventHandler(&readFailingHandler{DatabaseHandler: store}, SinkFunc(func(ctx context.Context, events []ChangeEvent) error {
+		published = append(published, events...)
+		return nil
+	}))
+	if err := handler.UpdateByID(CollectionName, anna["_id"], map[string]interface{}{"name": "Anh"}); err != nil {
+		t.Fatalf("Update by id must not return error but got %v", err)
+	}
+	if len(published) != 1 || !published[0].AfterUnknown || published[0].After != nil || published[0].Diff != nil ||
+		published[0].Before["name"] != "Anna" {
+		t.Fatalf("Event of an item which cannot be read must have an unknown state after but got %+v", published)
+	}
+
+	// With an outbox the entry stays pending and the relay publishes the current state
+	store = memory.NewMemoryHandler()
+	anna, _ = store.AddNewItem(CollectionName, map[string]interface{}{"name": "Anna"})
+	handler = NewOutboxHandler(&readFailingHandler{DatabaseHandler: store}, OutboxConfig{PendingTimeout: time.Millisecond})
+	if err := handler.UpdateByID(CollectionName, anna["_id"], map[string]interface{}{"name": "Anh"}); err != nil {
+		t.Fatalf("Update by id must not return error but got %v", err)
+	}
+	entries := outboxEntries(t, store)
+	if len(entries) != 1 || entries[0][fieldState] != statePending {
+		t.Fatalf("Expected 1 pending entry but got %v", entries)
+	}
+	time.Sleep(5 * time.Millisecond)
+	sink := &recordingSink{}
+	if published, err := NewRelay(store, sink, RelayConfig{}).Drain(context.Background()); err != nil || published != 1 {
+		t.Fatalf("Expected 1 published entry but got %d, %v", published, err)
+	}
+	if event := sink.events[0]; event.AfterUnknown || event.After["name"] != "Anh" || len(event.Diff) != 1 {
+		t.Fatalf("Relay must publish the current state of the item but got %+v", event)
+	}
+}
@@ -0,0 +1,198 @@
+package events
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/doctor-services/services/dbhandler"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DefaultOutboxCollection stores the outbox entries when the config names no collection
+const DefaultOutboxCollection = "outbox"
+
+// defaultPendingTimeout is how long a write may take before its event is published anyway
+const defaultPendingTimeout = time.Minute
+
+// States of outbox entries
+const (
+	// statePending entries belong to a write which has not finished
+	statePending = "pending"
+	// stateReady entries belong to a finished write and wait for the relay
+	stateReady = "ready"
+)
+
+// Fields of outbox entries
+const (
+	fieldState       = "state"
+	fieldNextAttempt = "nextAttempt"
+	fieldAttempts    = "attempts"
+	fieldLastError   = "lastError"
+)
+
+// OutboxConfig configures where writes record their events, see NewOutboxHandler
+type OutboxConfig struct {
+	// Collection stores the outbox entries, DefaultOutboxCollection when empty
+	Collection string
+	// PendingTimeout is how long the relay waits for an unfinished write before it publishes
+	// the event with the current state of the item, one minute when zero
+	PendingTimeout time.Duration
+}
+
+func (c OutboxConfig) collection() string {
+	if c.Collection == "" {
+		return DefaultOutboxCollection
+	}
+	return c.Collection
+}
+
+// outbox records the events of writes as entries of a collection
+type outbox struct {
+	handler        dbhandler.DatabaseHandler
+	collection     string
+	pendingTimeout time.Duration
+}
+
+// NewOutboxHandler wraps handler like NewEventHandler, but instead of publishing the events
+// it stores them in the outbox collection, where a Relay picks them up. Before every write a
+// pending entry is stored and the write fails when it cannot be. Once the write finished the
+// entry is marked ready, or removed when the write failed. When the process stops in between,
+// or the updated item cannot be read after the write, the entry stays pending and after the
+// pending timeout the relay publishes it with the current state of the item, which may not
+// include the interrupted write.
+func NewOutboxHandler(handler dbhandler.DatabaseHandler, config OutboxConfig) dbhandler.DatabaseHandler {
+	handler.ConfigureCollection(config.collection(), dbhandler.CollectionOptions{Versioned: true})
+	pendingTimeout := config.PendingTimeout
+	if pendingTimeout <= 0 {
+		pendingTimeout = defaultPendingTimeout
+	}
+	return &eventHandler{
+		DatabaseHandler: handler,
+		outbox: &outbox{
+			handler:        handler,
+			collection:     config.collection(),
+			pendingTimeout: pendingTimeout,
+		},
+	}
+}
+
+// begin stores a pending entry for every change and returns their keys
+func (o *outbox) begin(ctx context.Context, dataName string, changes []*change) ([]bson.ObjectId, error) {
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	actor, _ := dbhandler.ActorFrom(ctx)
+	now := time.Now().UTC()
+	keys := make([]bson.ObjectId, len(changes))
+	entries := make([]map[string]interface{}, len(changes))
+	for index, change := range changes {
+		keys[index] = bson.NewObjectId()
+		event := ChangeEvent{
+			Collection: dataName,
+			Operation:  change.operation,
+			ID:         idString(change.id),
+			Time:       now,
+			Actor:      actor,
+			Before:     change.before,
+		}
+		entries[index] = entryDoc(keys[index], event, statePending, now.Add(o.pendingTimeout))
+	}
+	result, err := o.handler.AddNewItems(ctx, o.collection, entries)
+	if err != nil {
+		var stored []bson.ObjectId
+		for index, item := range result.Items {
+			if item.Err == nil {
+				stored = append(stored, keys[index])
+			}
+		}
+		o.abort(stored)
+		log.Printf("[App.db]: Error during storing outbox entries of %s. %s\n", dataName, err)
+		return nil, err
+	}
+	return keys, nil
+}
+
+// abort removes the entries of a failed write. It does not use the context of the
+// write, as that may be the reason the write failed.
+func (o *outbox) abort(keys []bson.ObjectId) {
+	if len(keys) == 0 {
+		return
+	}
+	ids := make([]interface{}, len(keys))
+	for index, key := range keys {
+		ids[index] = key
+	}
+	if _, err := o.handler.RemoveItemsByIDs(context.Background(), o.collection, ids); err != nil {
+		log.Printf("[App.db]: Error during removing outbox entries of a failed write. %s\n", err)
+	}
+}
+
+// commit marks the entries of a finished write ready. An entry which cannot be marked
+// stays pending, the relay publishes it after the pending timeout.
+func (o *outbox) commit(keys []bson.ObjectId, events []ChangeEvent) {
+	now := time.Now().UTC()
+	for index, key := range keys {
+		entry := entryDoc(key, events[index], stateReady, now)
+		if err := o.handler.UpdateByIDContext(context.Background(), o.collection, key, entry); err != nil {
+			log.Printf("[App.db]: Error during marking outbox entry %s ready. %s\n", key.Hex(), err)
+		}
+	}
+}
+
+// entryDoc returns the outbox entry storing event
+func entryDoc(key bson.ObjectId, event ChangeEvent, state string, nextAttempt time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"_id":            key,
+		fieldState:       state,
+		fieldNextAttempt: nextAttempt,
+		fieldAttempts:    0,
+		"collection":     event.Collection,
+		"operation":      string(event.Operation),
+		"itemId":         event.ID,
+		"time":           event.Time,
+		"actor":          event.Actor,
+		"before":         event.Before,
+		"after":          event.After,
+	}
+}
+
+// entryEvent returns the event stored in an outbox entry, its key is the id of the entry
+func entryEvent(entry map[string]interface{}) ChangeEvent {
+	event := ChangeEvent{Key: idString(entry["_id"])}
+	event.Collection, _ = entry["collection"].(string)
+	operation, _ := entry["operation"].(string)
+	event.Operation = Operation(operation)
+	event.ID, _ = entry["itemId"].(string)
+	event.Time, _ = entry["time"].(time.Time)
+	event.Actor, _ = entry["actor"].(string)
+	event.Before = toMap(entry["before"])
+	event.After = toMap(entry["after"])
+	event.Diff = Diff(event.Before, event.After)
+	return event
+}
+
+func toMap(value interface{}) map[string]interface{} {
+	switch doc := value.(type) {
+	case bson.M:
+		return doc
+	case map[string]interface{}:
+		return doc
+	}
+	return nil
+}
+
+func toInt(value interface{}) int {
+	switch number := value.(type) {
+	case int:
+		return number
+	case int32:
+		return int(number)
+	case int64:
+		return int(number)
+	case float64:
+		return int(number)
+	}
+	return 0
+}
@@ -0,0 +1,129 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/doctor-services/services/dbhandler"
+	"github.com/doctor-services/services/dbhandler/memory"
+)
+
+// recordingSink keeps the published events and fails while err is set
+type recordingSink struct {
+	events []ChangeEvent
+	err    error
+}
+
+func (s *recordingSink) Publish(ctx context.Context, events []ChangeEvent) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func outboxEntries(t *testing.T, handler dbhandler.DatabaseHandler) []map[string]interface{} {
+	results, err := handler.GetAllItems(DefaultOutboxCollection, 100, 1, "", "", nil)
+	if err != nil {
+		t.Fatalf("Reading the outbox must not return error but got %v", err)
+	}
+	return results.Items
+}
+
+func TestOutbox(t *testing.T) {
+	store := memory.NewMemoryHandler()
+	handler := NewOutboxHandler(store, OutboxConfig{})
+	sink := &recordingSink{}
+	relay := NewRelay(store, sink, RelayConfig{MinBackoff: time.Hour})
+	ctx := context.Background()
+
+	anna, err := handler.AddNewItem(CollectionName, map[string]interface{}{"name": "Anna"})
+	if err != nil {
+		t.Fatalf("Insert item must not return error but got %v", err)
+	}
+	if _, err = handler.AddNewItem(CollectionName, map[string]interface{}{"_id": anna["_id"]}); !dbhandler.IsDuplicateKey(err) {
+		t.Fatalf("Expected duplicate key error but got %v", err)
+	}
+	if err = handler.UpdateByID(CollectionName, anna["_id"], map[string]interface{}{"name": "Anh"}); err != nil {
+		t.Fatalf("Update by id must not return error but got %v", err)
+	}
+	entries := outboxEntries(t, store)
+	if len(entries) != 2 || entries[0][fieldState] != stateReady || entries[1][fieldState] != stateReady {
+		t.Fatalf("Expected 2 ready entries, failed writes leave none, but got %v", entries)
+	}
+
+	sink.err = errors.New("unavailable")
+	if published, err := relay.Drain(ctx); err != nil || published != 0 {
+		t.Fatalf("Rejected entries must not count as published but got %d, %v", published, err)
+	}
+	entries = outboxEntries(t, store)
+	if len(entries) != 2 || toInt(entries[0][fieldAttempts]) != 1 || entries[0][fieldLastError] != "unavailable" {
+		t.Fatalf("Rejected entries must be kept with their failure but got %v", entries)
+	}
+	sink.err = nil
+	if published, _ := relay.Drain(ctx); published != 0 {
+		t.Fatalf("Rejected entries must wait for their backoff but %d were published", published)
+	}
+
+	// Make the entries due again
+	for _, entry := range entries {
+		entry[fieldNextAttempt] = time.Now().Add(-time.Second)
+		store.UpdateByID(DefaultOutboxCollection, entry["_id"], entry)
+	}
+	if published, err := relay.Drain(ctx); err != nil || published != 2 {
+		t.Fatalf("Expected 2 published entries but got %d, %v", published, err)
+	}
+	if len(sink.events) != 2 || sink.events[0].Operation != OpInsert || sink.events[1].Operation != OpUpdate ||
+		sink.events[1].Before["name"] != "Anna" || sink.events[1].After["name"] != "Anh" {
+		t.Fatalf("Published events must match the writes but got %+v", sink.events)
+	}
+	if sink.events[0].Key == "" || sink.events[0].Key == sink.events[1].Key || sink.events[0].ID != anna["_id"] {
+		t.Errorf("Every event must have its own key but got %+v", sink.events)
+	}
+	if entries = outboxEntries(t, store); len(entries) != 0 {
+		t.Errorf("Published entries must be removed but got %v", entries)
+	}
+}
+
+func TestOutboxPendingEntry(t *testing.T) {
+	store := memory.NewMemoryHandler()
+	handler := NewOutboxHandler(store, OutboxConfig{PendingTimeout: time.Millisecond}).(*eventHandler)
+	sink := &recordingSink{}
+	relay := NewRelay(store, sink, RelayConfig{})
+	ctx := context.Background()
+	anna, _ := store.AddNewItem(CollectionName, map[string]interface{}{"name": "Anna"})
+	// A write interrupted after storing its entry
+	before, _ := store.FindItemByID(CollectionName, anna["_id"])
+	if _, err := handler.outbox.begin(ctx, CollectionName, []*change{{operation: OpUpdate, id: anna["_id"], before: before}}); err != nil {
+		t.Fatalf("Storing the entry must not return error but got %v", err)
+	}
+	store.UpdateByID(CollectionName, anna["_id"], map[string]interface{}{"name": "Anh"})
+	time.Sleep(5 * time.Millisecond)
+	if published, err := relay.Drain(ctx); err != nil || published != 1 {
+		t.Fatalf("Expected 1 published entry but got %d, %v", published, err)
+	}
+	if sink.events[0].After["name"] != "Anh" || len(sink.events[0].Diff) != 1 {
+		t.Errorf("Pending entries must be published with the current state but got %+v", sink.events[0])
+	}
+}
+
+func TestRelayBackoff(t *testing.T) {
+	relay := NewRelay(memory.NewMemoryHandler(), &recordingSink{}, RelayConfig{MinBackoff: time.Second, MaxBackoff: 5 * time.Second})
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{40, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := relay.backoff(tt.attempts); got != tt.want {
+			t.Errorf("Attempt %d: expected %v but got %v", tt.attempts, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package events
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/doctor-services/services/dbhandler"
+	mongoHelper "github.com/doctor-services/services/helper/mongo"
+)
+
+// Relay defaults
+const (
+	defaultBatchSize    = 100
+	defaultPollInterval = time.Second
+	defaultMinBackoff   = time.Second
+	defaultMaxBackoff   = 5 * time.Minute
+)
+
+// RelayConfig configures a Relay, zero values use the defaults
+type RelayConfig struct {
+	// Collection is the outbox collection, DefaultOutboxCollection when empty
+	Collection string
+	// BatchSize is the most entries read per poll, 100 by default
+	BatchSize int
+	// PollInterval is the wait between polls, one second by default
+	PollInterval time.Duration
+	// MinBackoff is the wait before the first retry of an entry, doubled on every
+	// attempt up to MaxBackoff. One second and five minutes by default.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Relay publishes the entries of an outbox collection to a sink. Delivery is at least once:
+// an entry is removed only after the sink accepted it, entries the sink rejects are retried
+// with backoff and several relays may share one outbox. Consumers use ChangeEvent.Key to
+// drop events they got before. Retries may deliver the events of an item out of order.
+type Relay struct {
+	handler dbhandler.DatabaseHandler
+	sink    Sink
+	config  RelayConfig
+}
+
+// NewRelay creates a relay publishing the outbox entries stored through handler to sink
+func NewRelay(handler dbhandler.DatabaseHandler, sink Sink, config RelayConfig) *Relay {
+	config.Collection = OutboxConfig{Collection: config.Collection}.collection()
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultBatchSize
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaultPollInterval
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = defaultMinBackoff
+	}
+	if config.MaxBackoff < config.MinBackoff {
+		config.MaxBackoff = defaultMaxBackoff
+		if config.MaxBackoff < config.MinBackoff {
+			config.MaxBackoff = config.MinBackoff
+		}
+	}
+	handler.ConfigureCollection(config.Collection, dbhandler.CollectionOptions{Versioned: true})
+	return &Relay{handler: handler, sink: sink, config: config}
+}
+
+// Run publishes the outbox until ctx is done and returns the context error
+func (r *Relay) Run(ctx context.Context) error {
+	indexes := dbhandler.Indexes{r.config.Collection: {{Key: []string{fieldNextAttempt}}}}
+	if err := r.handler.EnsureIndexes(ctx, indexes); err != nil {
+		log.Printf("[App.db]: Error during ensuring the indexes of outbox %s. %s\n", r.config.Collection, err)
+	}
+	for {
+		published, err := r.Drain(ctx)
+		if err != nil {
+			log.Printf("[App.db]: Error during relaying outbox %s. %s\n", r.config.Collection, err)
+		}
+		wait := r.config.PollInterval
+		if err == nil && published == r.config.BatchSize {
+			// There may be more entries waiting
+			wait = 0
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Drain publishes one batch of the entries which are due and returns how many were published
+func (r *Relay) Drain(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	due, err := r.handler.ListItemsAfter(ctx, r.config.Collection, r.config.BatchSize, "", dbhandler.ListOptions{
+		Filter: dbhandler.Lte(fieldNextAttempt, now),
+		Sort:   []dbhandler.SortKey{{Field: fieldNextAttempt}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	published := 0
+	for _, entry := range due.Items {
+		ok, err := r.deliver(ctx, entry, now)
+		if err != nil {
+			return published, err
+		}
+		if ok {
+			published++
+		}
+	}
+	return published, nil
+}
+
+// deliver claims an entry and publishes it. It returns false when another relay
+// or the writer changed the entry first, or the sink rejected it.
+func (r *Relay) deliver(ctx context.Context, entry map[string]interface{}, now time.Time) (bool, error) {
+	id := entry["_id"]
+	attempts := toInt(entry[fieldAttempts]) + 1
+	// Claiming pushes the next attempt back, so no other relay picks the entry meanwhile
+	claimed := mongoHelper.CloneStringMap(entry)
+	claimed[fieldAttempts] = attempts
+	claimed[fieldNextAttempt] = now.Add(r.backoff(attempts))
+	version, err := r.handler.UpdateByIDIfVersion(ctx, r.config.Collection, id, dbhandler.VersionOf(entry), claimed)
+	if dbhandler.IsConflict(err) || dbhandler.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	event := entryEvent(entry)
+	if entry[fieldState] == statePending {
+		// The write did not finish in time, publish the current state of the item
+		current, err := r.handler.FindItemByIDWithOptions(ctx, event.Collection, event.ID,
+			dbhandler.FindOptions{Deleted: dbhandler.IncludeDeleted})
+		if err != nil && !dbhandler.IsNotFound(err) {
+			return false, err
+		}
+		event.After = current
+		event.Diff = Diff(event.Before, event.After)
+	}
+	if err = r.sink.Publish(ctx, []ChangeEvent{event}); err != nil {
+		log.Printf("[App.db]: Error during publishing outbox entry %s, attempt %d. %s\n", event.Key, attempts, err)
+		claimed[fieldLastError] = err.Error()
+		if _, err = r.handler.UpdateByIDIfVersion(ctx, r.config.Collection, id, version, claimed); err != nil && !dbhandler.IsConflict(err) {
+			log.Printf("[App.db]: Error during recording the failure of outbox entry %s. %s\n", event.Key, err)
+		}
+		return false, nil
+	}
+	// A writer marking the entry ready meanwhile makes it due again, it is then published twice
+	err = r.handler.RemoveItemByIDIfVersion(ctx, r.config.Collection, id, version)
+	if err != nil && !dbhandler.IsConflict(err) && !dbhandler.IsNotFound(err) {
+		return true, err
+	}
+	return true, nil
+}
+
+// backoff returns the wait after the given attempt
+func (r *Relay) backoff(attempts int) time.Duration {
+	wait := r.config.MinBackoff
+	for attempt := 1; attempt < attempts && wait < r.config.MaxBackoff; attempt++ {
+		wait *= 2
+	}
+	if wait > r.config.MaxBackoff {
+		wait = r.config.MaxBackoff
+	}
+	return wait
+}
@@ -0,0 +1,98 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	kitlog "github.com/go-kit/kit/log"
+)
+
+// Sink receives the change events of the writes made through an event handler
+type Sink interface {
+	Publish(ctx context.Context, events []ChangeEvent) error
+}
+
+// SinkFunc adapts a function to a Sink
+type SinkFunc func(ctx context.Context, events []ChangeEvent) error
+
+// Publish calls f
+func (f SinkFunc) Publish(ctx context.Context, events []ChangeEvent) error {
+	return f(ctx, events)
+}
+
+// NewChannelSink sends every event on ch, waiting until it is received or ctx is done
+func NewChannelSink(ch chan<- ChangeEvent) Sink {
+	return SinkFunc(func(ctx context.Context, events []ChangeEvent) error {
+		for _, event := range events {
+			select {
+			case ch <- event:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+}
+
+// NewWebhookSink posts the events as a JSON array to url.
+// A nil client uses http.DefaultClient, any status but 2xx is an error.
+func NewWebhookSink(url string, client *http.Client) Sink {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return SinkFunc(func(ctx context.Context, events []ChangeEvent) error {
+		body, err := json.Marshal(events)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("webhook %s answered %s", url, resp.Status)
+		}
+		return nil
+	})
+}
+
+// NewLogSink logs one line per event with the changed fields
+func NewLogSink(logger kitlog.Logger) Sink {
+	return SinkFunc(func(ctx context.Context, events []ChangeEvent) error {
+		for _, event := range events {
+			fields := make([]string, len(event.Diff))
+			for index, change := range event.Diff {
+				fields[index] = change.Field
+			}
+			err := logger.Log("collection", event.Collection, "operation", event.Operation,
+				"id", event.ID, "actor", event.Actor, "changed", fmt.Sprint(fields))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MultiSink publishes the events to every sink, even when some fail.
+// It returns the first error.
+func MultiSink(sinks ...Sink) Sink {
+	return SinkFunc(func(ctx context.Context, events []ChangeEvent) error {
+		var first error
+		for _, sink := range sinks {
+			if err := sink.Publish(ctx, events); err != nil && first == nil {
+				first = err
+			}
+		}
+		return first
+	})
+}
@@ -0,0 +1,68 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChannelSink(t *testing.T) {
+	ch := make(chan ChangeEvent, 1)
+	sink := NewChannelSink(ch)
+	if err := sink.Publish(context.Background(), []ChangeEvent{{ID: "1"}}); err != nil {
+		t.Fatalf("Publish must not return error but got %v", err)
+	}
+	if event := <-ch; event.ID != "1" {
+		t.Fatalf("Expected event 1 but got %v", event)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ch <- ChangeEvent{}
+	if err := sink.Publish(ctx, []ChangeEvent{{ID: "2"}}); err != context.Canceled {
+		t.Fatalf("Publishing to a full channel must stop with the context but got %v", err)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var received []ChangeEvent
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected a JSON post but got %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	sink := NewWebhookSink(server.URL, nil)
+	events := []ChangeEvent{{Collection: "doctors", Operation: OpInsert, ID: "1"}}
+	if err := sink.Publish(context.Background(), events); err != nil {
+		t.Fatalf("Publish must not return error but got %v", err)
+	}
+	if len(received) != 1 || received[0].Collection != "doctors" || received[0].Operation != OpInsert {
+		t.Fatalf("Expected %v but got %v", events, received)
+	}
+	status = http.StatusBadGateway
+	if err := sink.Publish(context.Background(), events); err == nil {
+		t.Fatalf("Publish must return error when the webhook fails")
+	}
+}
+
+func TestMultiSink(t *testing.T) {
+	failure := errors.New("failure")
+	var calls int
+	counting := SinkFunc(func(ctx context.Context, events []ChangeEvent) error {
+		calls++
+		return nil
+	})
+	failing := SinkFunc(func(ctx context.Context, events []ChangeEvent) error {
+		return failure
+	})
+	err := MultiSink(failing, counting, counting).Publish(context.Background(), []ChangeEvent{{}})
+	if err != failure || calls != 2 {
+		t.Fatalf("Expected every sink called and the first error but got %d calls, %v", calls, err)
+	}
+}
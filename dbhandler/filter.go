@@ -0,0 +1,411 @@
+package dbhandler
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalidFilter is returned when a filter uses an operator which is not
+// allowed or a value which cannot be compared
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Operator is a filter operation every backend knows how to run
+type Operator string
+
+// Allowed filter operators
+const (
+	OpEq     Operator = "eq"
+	OpNe     Operator = "ne"
+	OpGt     Operator = "gt"
+	OpGte    Operator = "gte"
+	OpLt     Operator = "lt"
+	OpLte    Operator = "lte"
+	OpIn     Operator = "in"
+	OpNin    Operator = "nin"
+	OpRegex  Operator = "regex"
+	OpExists Operator = "exists"
+	OpAnd    Operator = "and"
+	OpOr     Operator = "or"
+)
+
+// Filter is a backend neutral condition on items, build it with Eq, In, And...
+// Field conditions use Field and Value, And/Or use Filters.
+// The zero Filter matches every item.
+type Filter struct {
+	Op      Operator
+	Field   string
+	Value   interface{}
+	Filters []Filter
+}
+
+// Eq matches items whose field equals value, or contains it when the field is an array
+func Eq(field string, value interface{}) Filter {
+	return Filter{Op: OpEq, Field: field, Value: value}
+}
+
+// Ne matches items whose field does not equal value
+func Ne(field string, value interface{}) Filter {
+	return Filter{Op: OpNe, Field: field, Value: value}
+}
+
+// Gt matches items whose field is greater than value
+func Gt(field string, value interface{}) Filter {
+	return Filter{Op: OpGt, Field: field, Value: value}
+}
+
+// Gte matches items whose field is greater than or equal to value
+func Gte(field string, value interface{}) Filter {
+	return Filter{Op: OpGte, Field: field, Value: value}
+}
+
+// Lt matches items whose field is less than value
+func Lt(field string, value interface{}) Filter {
+	return Filter{Op: OpLt, Field: field, Value: value}
+}
+
+// Lte matches items whose field is less than or equal to value
+func Lte(field string, value interface{}) Filter {
+	return Filter{Op: OpLte, Field: field, Value: value}
+}
+
+// In matches items whose field equals one of the values
+func In(field string, values ...interface{}) Filter {
+	return Filter{Op: OpIn, Field: field, Value: values}
+}
+
+// NotIn matches items whose field equals none of the values
+func NotIn(field string, values ...interface{}) Filter {
+	return Filter{Op: OpNin, Field: field, Value: values}
+}
+
+// Range matches items whose field is between min and max, both included.
+// A nil bound leaves that side open.
+func Range(field string, min interface{}, max interface{}) Filter {
+	var filters []Filter
+	if min != nil {
+		filters = append(filters, Gte(field, min))
+	}
+	if max != nil {
+		filters = append(filters, Lte(field, max))
+	}
+	return And(filters...)
+}
+
+// Regex matches items whose field matches the pattern. Patterns must be
+// understood by both PCRE and RE2, inline flags like (?i) are fine.
+func Regex(field string, pattern string) Filter {
+	return Filter{Op: OpRegex, Field: field, Value: pattern}
+}
+
+// Prefix matches items whose field starts with prefix
+func Prefix(field string, prefix string) Filter {
+	return Regex(field, "^"+regexp.QuoteMeta(prefix))
+}
+
+// Exists matches items which have the field, or do not have it when exists is false
+func Exists(field string, exists bool) Filter {
+	return Filter{Op: OpExists, Field: field, Value: exists}
+}
+
+// And matches items matching every filter, empty filters are dropped
+func And(filters ...Filter) Filter {
+	return combine(OpAnd, filters)
+}
+
+// Or matches items matching at least one of the filters
+func Or(filters ...Filter) Filter {
+	return combine(OpOr, filters)
+}
+
+func combine(op Operator, filters []Filter) Filter {
+	var kept []Filter
+	for _, filter := range filters {
+		if !filter.IsEmpty() {
+			kept = append(kept, filter)
+		}
+	}
+	switch len(kept) {
+	case 0:
+		return Filter{}
+	case 1:
+		return kept[0]
+	}
+	return Filter{Op: op, Filters: kept}
+}
+
+// IsEmpty tells whether the filter matches every item
+func (f Filter) IsEmpty() bool {
+	return f.Op == ""
+}
+
+// Validate makes sure the filter only uses allowed operators, valid field
+// names and plain values, so it cannot smuggle in backend specific operators
+func (f Filter) Validate() error {
+	switch f.Op {
+	case "":
+		return nil
+	case OpAnd, OpOr:
+		if len(f.Filters) == 0 {
+			return Errorf(ErrInvalidFilter, "%s needs filters", f.Op)
+		}
+		for _, filter := range f.Filters {
+			if filter.IsEmpty() {
+				return Errorf(ErrInvalidFilter, "%s cannot contain an empty filter", f.Op)
+			}
+			if err := filter.Validate(); err != nil {
+				return err
+			}
+		}
+		return nil
+	case OpEq, OpNe, OpGt, OpGte, OpLt, OpLte, OpIn, OpNin, OpRegex, OpExists:
+	default:
+		return Errorf(ErrInvalidFilter, "operator %q is not allowed", f.Op)
+	}
+	if !sortFieldPattern.MatchString(f.Field) || strings.HasPrefix(f.Field, "-") {
+		return Errorf(ErrInvalidFilter, "bad field name %q", f.Field)
+	}
+	switch f.Op {
+	case OpIn, OpNin:
+		if _, ok := f.Value.([]interface{}); !ok {
+			return Errorf(ErrInvalidFilter, "%s on %q needs a list of values", f.Op, f.Field)
+		}
+	case OpRegex:
+		pattern, ok := f.Value.(string)
+		if !ok {
+			return Errorf(ErrInvalidFilter, "regex on %q needs a string pattern", f.Field)
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return Errorf(ErrInvalidFilter, "regex on %q: %s", f.Field, err)
+		}
+	case OpExists:
+		if _, ok := f.Value.(bool); !ok {
+			return Errorf(ErrInvalidFilter, "exists on %q needs a bool", f.Field)
+		}
+	}
+	return checkPlainValue(f.Field, f.Value)
+}
+
+// isScalar tells whether value is a single comparable value: nil, a bool,
+// a number, a string like an object id, or a time
+func isScalar(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	if _, ok := value.(time.Time); ok {
+		return true
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// checkPlainValue rejects embedded documents containing operators and values
+// which are neither scalars, documents nor lists, like the backend types whose
+// encoding could hide operators
+func checkPlainValue(field string, value interface{}) error {
+	if _, ok := value.([]byte); ok || isScalar(value) {
+		return nil
+	}
+	reflected := reflect.ValueOf(value)
+	switch reflected.Kind() {
+	case reflect.Map:
+		for _, key := range reflected.MapKeys() {
+			if key.Kind() != reflect.String {
+				return Errorf(ErrInvalidFilter, "value of %q has non string keys", field)
+			}
+			if err := checkPlainKey(field, key.String(), reflected.MapIndex(key).Interface()); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for index := 0; index < reflected.Len(); index++ {
+			if err := checkPlainValue(field, reflected.Index(index).Interface()); err != nil {
+				return err
+			}
+		}
+	case reflect.Ptr:
+		if !reflected.IsNil() {
+			return checkPlainValue(field, reflected.Elem().Interface())
+		}
+	default:
+		return Errorf(ErrInvalidFilter, "value of %q cannot be a %T", field, value)
+	}
+	return nil
+}
+
+func checkPlainKey(field string, key string, value interface{}) error {
+	if strings.HasPrefix(key, "$") {
+		return Errorf(ErrInvalidFilter, "value of %q cannot contain operator %q", field, key)
+	}
+	return checkPlainValue(field, value)
+}
+
+// legacyOperators maps the mongo operators accepted in filter maps
+var legacyOperators = map[string]Operator{
+	"$eq":  OpEq,
+	"$ne":  OpNe,
+	"$gt":  OpGt,
+	"$gte": OpGte,
+	"$lt":  OpLt,
+	"$lte": OpLte,
+	"$in":  OpIn,
+	"$nin": OpNin,
+}
+
+// ParseFilterMap converts a mongo style filter map, as accepted by GetAllItems,
+// into a Filter. Only the operators which have a Filter counterpart are
+// accepted ($eq, $ne, $gt, $gte, $lt, $lte, $in, $nin, $exists, $regex with
+// $options, $and, $or), anything else like $where is rejected.
+func ParseFilterMap(filters map[string]interface{}) (Filter, error) {
+	var parsed []Filter
+	for _, key := range sortedKeys(filters) {
+		value := filters[key]
+		var (
+			filter Filter
+			err    error
+		)
+		switch {
+		case key == "$and" || key == "$or":
+			filter, err = parseLogical(key, value)
+		case strings.HasPrefix(key, "$"):
+			err = Errorf(ErrInvalidFilter, "operator %q is not allowed", key)
+		default:
+			filter, err = parseCondition(key, value)
+		}
+		if err != nil {
+			return Filter{}, err
+		}
+		parsed = append(parsed, filter)
+	}
+	result := And(parsed...)
+	return result, result.Validate()
+}
+
+func parseLogical(key string, value interface{}) (Filter, error) {
+	clauses := reflect.ValueOf(value)
+	if clauses.Kind() != reflect.Slice || clauses.Len() == 0 {
+		return Filter{}, Errorf(ErrInvalidFilter, "%s needs a non empty list", key)
+	}
+	filters := make([]Filter, clauses.Len())
+	for index := range filters {
+		clause, ok := toStringMap(clauses.Index(index).Interface())
+		if !ok {
+			return Filter{}, Errorf(ErrInvalidFilter, "%s entries must be documents", key)
+		}
+		filter, err := ParseFilterMap(clause)
+		if err != nil {
+			return Filter{}, err
+		}
+		if filter.IsEmpty() {
+			return Filter{}, Errorf(ErrInvalidFilter, "%s entries cannot be empty", key)
+		}
+		filters[index] = filter
+	}
+	if key == "$or" {
+		return Filter{Op: OpOr, Filters: filters}, nil
+	}
+	return Filter{Op: OpAnd, Filters: filters}, nil
+}
+
+func parseCondition(field string, value interface{}) (Filter, error) {
+	operators, ok := toStringMap(value)
+	if !ok || !hasOperator(operators) {
+		return Eq(field, value), nil
+	}
+	var filters []Filter
+	for _, key := range sortedKeys(operators) {
+		argument := operators[key]
+		switch key {
+		case "$exists":
+			exists, ok := argument.(bool)
+			if !ok {
+				return Filter{}, Errorf(ErrInvalidFilter, "$exists on %q needs a bool", field)
+			}
+			filters = append(filters, Exists(field, exists))
+		case "$regex":
+			pattern, ok := argument.(string)
+			if !ok {
+				return Filter{}, Errorf(ErrInvalidFilter, "$regex on %q needs a string", field)
+			}
+			options, _ := operators["$options"].(string)
+			filters = append(filters, Regex(field, regexWithOptions(pattern, options)))
+		case "$options":
+			if _, ok := operators["$regex"]; !ok {
+				return Filter{}, Errorf(ErrInvalidFilter, "$options on %q needs a $regex", field)
+			}
+		case "$in", "$nin":
+			values := reflect.ValueOf(argument)
+			if values.Kind() != reflect.Slice {
+				return Filter{}, Errorf(ErrInvalidFilter, "%s on %q needs a list", key, field)
+			}
+			list := make([]interface{}, values.Len())
+			for index := range list {
+				list[index] = values.Index(index).Interface()
+			}
+			filters = append(filters, Filter{Op: legacyOperators[key], Field: field, Value: list})
+		default:
+			op, ok := legacyOperators[key]
+			if !ok {
+				return Filter{}, Errorf(ErrInvalidFilter, "operator %q is not allowed", key)
+			}
+			filters = append(filters, Filter{Op: op, Field: field, Value: argument})
+		}
+	}
+	return And(filters...), nil
+}
+
+// regexWithOptions turns mongo regex options into inline flags
+func regexWithOptions(pattern string, options string) string {
+	flags := ""
+	for _, option := range options {
+		if strings.ContainsRune("ims", option) {
+			flags += string(option)
+		}
+	}
+	if flags == "" {
+		return pattern
+	}
+	return "(?" + flags + ")" + pattern
+}
+
+var stringMapType = reflect.TypeOf(map[string]interface{}(nil))
+
+// toStringMap returns documents like map[string]interface{} and the named map
+// types of the backends
+func toStringMap(value interface{}) (map[string]interface{}, bool) {
+	if doc, ok := value.(map[string]interface{}); ok {
+		return doc, true
+	}
+	reflected := reflect.ValueOf(value)
+	if reflected.Kind() != reflect.Map || !reflected.Type().ConvertibleTo(stringMapType) {
+		return nil, false
+	}
+	return reflected.Convert(stringMapType).Interface().(map[string]interface{}), true
+}
+
+func hasOperator(doc map[string]interface{}) bool {
+	for key := range doc {
+		if strings.HasPrefix(key, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(doc map[string]interface{}) []string {
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,110 @@
+package dbhandler
+
+import (
+	"reflect"
+	"testing"
+)
+
+// document is a named map type like the documents of the backends
+type document map[string]interface{}
+
+func TestFilterBuilders(t *testing.T) {
+	if f := And(); !f.IsEmpty() {
+		t.Errorf("And of nothing must be empty but got %v", f)
+	}
+	if f := And(Filter{}, Eq("name", "Anna")); !reflect.DeepEqual(f, Eq("name", "Anna")) {
+		t.Errorf("And must drop empty filters but got %v", f)
+	}
+	expected := Filter{Op: OpAnd, Filters: []Filter{Gte("rating", 2), Lte("rating", 4)}}
+	if f := Range("rating", 2, 4); !reflect.DeepEqual(f, expected) {
+		t.Errorf("Expected %v but got %v", expected, f)
+	}
+	if f := Range("rating", nil, 4); !reflect.DeepEqual(f, Lte("rating", 4)) {
+		t.Errorf("Range without min must only have max but got %v", f)
+	}
+	if f := Prefix("name", "a.b"); f.Value != `^a\.b` {
+		t.Errorf("Prefix must quote the prefix but got %v", f.Value)
+	}
+	if f := In("status", "active", "pending"); !reflect.DeepEqual(f.Value, []interface{}{"active", "pending"}) {
+		t.Errorf("In must keep its values but got %v", f.Value)
+	}
+}
+
+func TestFilterValidate(t *testing.T) {
+	valid := []Filter{
+		{},
+		Eq("name", "Anna"),
+		Eq("address", map[string]interface{}{"city": "Hanoi"}),
+		Or(Eq("name", "Anna"), And(Gt("rating", 3), Exists("deletedAt", false))),
+		In("_id", "5a0b1c2d3e4f5a6b7c8d9e01"),
+		Regex("name", "(?i)^an"),
+	}
+	for _, filter := range valid {
+		if err := filter.Validate(); err != nil {
+			t.Errorf("Filter %v must be valid but got %v", filter, err)
+		}
+	}
+	invalid := []Filter{
+		{Op: "where", Field: "name", Value: "true"},
+		Eq("$where", "true"),
+		Eq("name", document{"$gt": ""}),
+		Eq("name", struct{ Where string }{"true"}),
+		In("tags", struct{ Where string }{"true"}),
+		Eq("tags", []interface{}{map[string]interface{}{"$ne": nil}}),
+		{Op: OpIn, Field: "name", Value: "Anna"},
+		Regex("name", "("),
+		{Op: OpExists, Field: "name", Value: "yes"},
+		{Op: OpOr},
+		{Op: OpAnd, Filters: []Filter{{}}},
+	}
+	for _, filter := range invalid {
+		if err := filter.Validate(); err == nil {
+			t.Errorf("Filter %v must be rejected", filter)
+		}
+	}
+}
+
+func TestParseFilterMap(t *testing.T) {
+	filters := map[string]interface{}{
+		"status": "active",
+		"rating": document{"$gte": 3, "$lt": 5},
+		"name":   map[string]interface{}{"$regex": "^an", "$options": "i"},
+		"tags":   document{"$in": []string{"senior"}},
+		"$or": []interface{}{
+			document{"city": "Hanoi"},
+			map[string]interface{}{"deletedAt": document{"$exists": false}},
+		},
+	}
+	f, err := ParseFilterMap(filters)
+	if err != nil {
+		t.Fatalf("ParseFilterMap must not return error but got %v", err)
+	}
+	expected := And(
+		Or(Eq("city", "Hanoi"), Exists("deletedAt", false)),
+		Regex("name", "(?i)^an"),
+		And(Gte("rating", 3), Lt("rating", 5)),
+		Eq("status", "active"),
+		In("tags", "senior"),
+	)
+	if !reflect.DeepEqual(f, expected) {
+		t.Fatalf("Expected %+v but got %+v", expected, f)
+	}
+	if f, err = ParseFilterMap(nil); err != nil || !f.IsEmpty() {
+		t.Errorf("Nil filters must be empty but got %v, %v", f, err)
+	}
+
+	rejected := []map[string]interface{}{
+		{"$where": "this.rating > 3"},
+		{"rating": document{"$where": "true"}},
+		{"name": document{"$options": "i"}},
+		{"$or": []interface{}{}},
+		{"$and": []interface{}{"name"}},
+		{"address": document{"city": document{"$ne": ""}}},
+		{"name": document{"$exists": 1}},
+	}
+	for _, filters := range rejected {
+		if _, err := ParseFilterMap(filters); err == nil {
+			t.Errorf("ParseFilterMap must reject %v", filters)
+		}
+	}
+}
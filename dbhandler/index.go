@@ -0,0 +1,170 @@
+package dbhandler
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalidIndex is returned when an index declaration cannot be created
+var ErrInvalidIndex = errors.New("invalid index")
+
+// Index declares an index of a collection
+type Index struct {
+	// Name defaults to the name mongo derives from the key, like "clinicId_1_startAt_-1"
+	Name string `json:"name,omitempty"`
+	// Key lists the indexed fields. A "-" prefix indexes the field descending,
+	// a "$text:" prefix adds the field to the text index.
+	Key []string `json:"key"`
+	// Unique prevents two items from having the same key
+	Unique bool `json:"unique,omitempty"`
+	// Sparse only indexes the items having the key fields
+	Sparse bool `json:"sparse,omitempty"`
+	// ExpireAfter removes items once the time in the single key field is older, TTL indexes only
+	ExpireAfter time.Duration `json:"expireAfter,omitempty"`
+}
+
+// Indexes declares the indexes of every collection by collection name
+type Indexes map[string][]Index
+
+// IndexName returns the declared name or the name mongo derives from the key
+func (i Index) IndexName() string {
+	if i.Name != "" {
+		return i.Name
+	}
+	parts := make([]string, 0, 2*len(i.Key))
+	for _, key := range i.Key {
+		switch {
+		case strings.HasPrefix(key, "$text:"):
+			parts = append(parts, key[len("$text:"):], "text")
+		case strings.HasPrefix(key, "-"):
+			parts = append(parts, key[1:], "-1")
+		default:
+			parts = append(parts, strings.TrimPrefix(key, "+"), "1")
+		}
+	}
+	return strings.Join(parts, "_")
+}
+
+// IsText tells whether the index is a text index
+func (i Index) IsText() bool {
+	for _, key := range i.Key {
+		if strings.HasPrefix(key, "$text:") {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the key fields and the options used together
+func (i Index) Validate() error {
+	if len(i.Key) == 0 {
+		return Errorf(ErrInvalidIndex, "%q has no key", i.Name)
+	}
+	seen := make(map[string]bool, len(i.Key))
+	for _, key := range i.Key {
+		field := strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(key, "$text:"), "-"), "+")
+		if !sortFieldPattern.MatchString(field) || strings.HasPrefix(field, "-") {
+			return Errorf(ErrInvalidIndex, "bad field name %q", key)
+		}
+		if seen[field] {
+			return Errorf(ErrInvalidIndex, "field %q used twice", field)
+		}
+		seen[field] = true
+	}
+	if i.ExpireAfter < 0 || (i.ExpireAfter > 0 && (len(i.Key) != 1 || i.IsText())) {
+		return Errorf(ErrInvalidIndex, "%s expiry needs a single time field", i.IndexName())
+	}
+	if i.ExpireAfter%time.Second != 0 {
+		return Errorf(ErrInvalidIndex, "%s expiry must be whole seconds", i.IndexName())
+	}
+	if i.Unique && i.IsText() {
+		return Errorf(ErrInvalidIndex, "%s text index cannot be unique", i.IndexName())
+	}
+	return nil
+}
+
+// Validate checks every declared index and rejects two indexes with the same name
+func (indexes Indexes) Validate() error {
+	for dataName, declared := range indexes {
+		names := make(map[string]bool, len(declared))
+		for _, index := range declared {
+			if err := index.Validate(); err != nil {
+				return Errorf(ErrInvalidIndex, "%s: %s", dataName, err.(*Error).Err)
+			}
+			if names[index.IndexName()] {
+				return Errorf(ErrInvalidIndex, "%s: %s declared twice", dataName, index.IndexName())
+			}
+			names[index.IndexName()] = true
+		}
+	}
+	return nil
+}
+
+// IndexDiff tells how the existing indexes of a collection differ from the declared ones
+type IndexDiff struct {
+	// Missing indexes are declared but do not exist
+	Missing []Index `json:"missing,omitempty"`
+	// Changed indexes exist with other options than declared, the declared index is listed
+	Changed []Index `json:"changed,omitempty"`
+	// Extra indexes exist but are not declared, the _id index is never extra
+	Extra []Index `json:"extra,omitempty"`
+}
+
+// IsEmpty tells whether the existing indexes match the declaration
+func (d IndexDiff) IsEmpty() bool {
+	return len(d.Missing) == 0 && len(d.Changed) == 0 && len(d.Extra) == 0
+}
+
+// DiffIndexes compares the declared indexes of a collection with the existing ones.
+// Indexes are matched by name.
+func DiffIndexes(declared []Index, existing []Index) IndexDiff {
+	var diff IndexDiff
+	byName := make(map[string]Index, len(existing))
+	for _, index := range existing {
+		byName[index.IndexName()] = index
+	}
+	for _, index := range declared {
+		found, ok := byName[index.IndexName()]
+		if !ok {
+			diff.Missing = append(diff.Missing, index)
+			continue
+		}
+		delete(byName, index.IndexName())
+		if !sameIndex(index, found) {
+			diff.Changed = append(diff.Changed, index)
+		}
+	}
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		if name != "_id_" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		diff.Extra = append(diff.Extra, byName[name])
+	}
+	return diff
+}
+
+func sameIndex(a Index, b Index) bool {
+	return reflect.DeepEqual(indexKey(a), indexKey(b)) &&
+		a.Unique == b.Unique && a.Sparse == b.Sparse && a.ExpireAfter == b.ExpireAfter
+}
+
+// indexKey normalizes "+field" to "field" and orders the text fields, their order does not matter
+func indexKey(index Index) []string {
+	var key, text []string
+	for _, field := range index.Key {
+		if strings.HasPrefix(field, "$text:") {
+			text = append(text, field)
+			continue
+		}
+		key = append(key, strings.TrimPrefix(field, "+"))
+	}
+	sort.Strings(text)
+	return append(key, text...)
+}
@@ -0,0 +1,79 @@
+package dbhandler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIndexName(t *testing.T) {
+	tests := []struct {
+		index Index
+		want  string
+	}{
+		{Index{Key: []string{"email"}}, "email_1"},
+		{Index{Key: []string{"clinicId", "-startAt"}}, "clinicId_1_startAt_-1"},
+		{Index{Key: []string{"$text:bio", "$text:name"}}, "bio_text_name_text"},
+		{Index{Name: "expiry", Key: []string{"expireAt"}}, "expiry"},
+	}
+	for _, tt := range tests {
+		if got := tt.index.IndexName(); got != tt.want {
+			t.Errorf("IndexName() = %s, want %s", got, tt.want)
+		}
+	}
+}
+
+func TestIndexValidate(t *testing.T) {
+	valid := Indexes{"doctors": {
+		{Key: []string{"email"}, Unique: true, Sparse: true},
+		{Key: []string{"clinicId", "-startAt"}},
+		{Key: []string{"expireAt"}, ExpireAfter: 24 * time.Hour},
+		{Key: []string{"$text:bio"}},
+	}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Indexes must be valid but got %v", err)
+	}
+	invalid := []Index{
+		{},
+		{Key: []string{"$where"}},
+		{Key: []string{"a", "-a"}},
+		{Key: []string{"a", "b"}, ExpireAfter: time.Hour},
+		{Key: []string{"a"}, ExpireAfter: time.Millisecond},
+		{Key: []string{"$text:bio"}, Unique: true},
+	}
+	for _, index := range invalid {
+		if err := index.Validate(); err == nil {
+			t.Errorf("Index %v must be rejected", index)
+		}
+	}
+	twice := Indexes{"doctors": {{Key: []string{"email"}}, {Key: []string{"email"}, Unique: true}}}
+	if err := twice.Validate(); err == nil {
+		t.Errorf("Indexes with the same name must be rejected")
+	}
+}
+
+func TestDiffIndexes(t *testing.T) {
+	declared := []Index{
+		{Key: []string{"email"}, Unique: true},
+		{Key: []string{"clinicId", "-startAt"}},
+		{Key: []string{"$text:bio", "$text:name"}},
+	}
+	existing := []Index{
+		{Name: "_id_", Key: []string{"_id"}},
+		{Name: "email_1", Key: []string{"email"}},
+		{Name: "bio_text_name_text", Key: []string{"$text:name", "$text:bio"}},
+		{Name: "legacy_1", Key: []string{"legacy"}},
+	}
+	diff := DiffIndexes(declared, existing)
+	if len(diff.Missing) != 1 || diff.Missing[0].IndexName() != "clinicId_1_startAt_-1" {
+		t.Errorf("Expected clinicId_1_startAt_-1 missing but got %v", diff.Missing)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].IndexName() != "email_1" {
+		t.Errorf("Expected email_1 changed but got %v", diff.Changed)
+	}
+	if len(diff.Extra) != 1 || diff.Extra[0].Name != "legacy_1" {
+		t.Errorf("Expected legacy_1 extra but got %v", diff.Extra)
+	}
+	if diff := DiffIndexes(existing[1:3], existing); len(diff.Extra) != 1 || diff.IsEmpty() {
+		t.Errorf("Only legacy_1 must be extra but got %+v", diff)
+	}
+}
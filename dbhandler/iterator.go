@@ -0,0 +1,47 @@
+package dbhandler
+
+// DefaultBatchSize is how many items an iterator fetches per round trip when IterateOptions leaves it unset
+const DefaultBatchSize = 500
+
+// IterateOptions selects and orders the items of an iteration
+type IterateOptions struct {
+	ListOptions
+	// BatchSize is how many items are fetched per round trip, DefaultBatchSize when zero
+	BatchSize int
+}
+
+// Iterator reads the items of a listing one at a time, in constant memory.
+// Call Next until it returns false, then check Err. Close releases the cursor,
+// call it when stopping early; closing twice is safe.
+//
+//	it, err := handler.IterateItems(ctx, "patients", opts)
+//	if err != nil {
+//		return err
+//	}
+//	defer it.Close()
+//	for it.Next() {
+//		process(it.Item())
+//	}
+//	return it.Err()
+type Iterator interface {
+	// Next fetches the next item, it returns false at the end, on error or once the context is done
+	Next() bool
+	// Item returns the item fetched by the last call to Next
+	Item() map[string]interface{}
+	// Err returns the error which stopped the iteration, nil at the end of the items
+	Err() error
+	// Close releases the cursor and returns Err
+	Close() error
+}
+
+// ForEach calls fn with every item of it and closes it.
+// It stops at the first error, from fn or from the iterator, and returns it.
+func ForEach(it Iterator, fn func(item map[string]interface{}) error) error {
+	defer it.Close()
+	for it.Next() {
+		if err := fn(it.Item()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
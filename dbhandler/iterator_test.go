@@ -0,0 +1,77 @@
+package dbhandler
+
+import (
+	"errors"
+	"testing"
+)
+
+// sliceIterator iterates over items and then fails with err
+type sliceIterator struct {
+	items  []map[string]interface{}
+	next   int
+	err    error
+	closed int
+}
+
+func (it *sliceIterator) Next() bool {
+	if it.next >= len(it.items) {
+		return false
+	}
+	it.next++
+	return true
+}
+
+func (it *sliceIterator) Item() map[string]interface{} {
+	return it.items[it.next-1]
+}
+
+func (it *sliceIterator) Err() error {
+	if it.next < len(it.items) {
+		return nil
+	}
+	return it.err
+}
+
+func (it *sliceIterator) Close() error {
+	it.closed++
+	return it.Err()
+}
+
+func TestForEach(t *testing.T) {
+	items := []map[string]interface{}{{"name": "Anna"}, {"name": "Binh"}, {"name": "Chi"}}
+	stop := errors.New("stop")
+	failed := errors.New("cursor killed")
+	tests := []struct {
+		name    string
+		iterErr error
+		stopAt  int
+		want    error
+		visited int
+	}{
+		{"every item", nil, -1, nil, 3},
+		{"callback error", nil, 1, stop, 2},
+		{"iterator error", failed, -1, failed, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it := &sliceIterator{items: items, err: tt.iterErr}
+			visited := 0
+			err := ForEach(it, func(item map[string]interface{}) error {
+				if item["name"] != items[visited]["name"] {
+					t.Fatalf("Expected %v but got %v", items[visited], item)
+				}
+				visited++
+				if visited-1 == tt.stopAt {
+					return stop
+				}
+				return nil
+			})
+			if err != tt.want || visited != tt.visited {
+				t.Fatalf("ForEach must return %v after %d items but got %v after %d", tt.want, tt.visited, err, visited)
+			}
+			if it.closed != 1 {
+				t.Fatalf("ForEach must close the iterator once but closed it %d times", it.closed)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/doctor-services/services/dbhandler"
+	mongoHelper "github.com/doctor-services/services/helper/mongo"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// bulkItem is a prepared item of a bulk write
+type bulkItem struct {
+	index    int
+	objectID bson.ObjectId
+	doc      bson.M
+}
+
+// prepareBulk normalizes the items
+func prepareBulk(items []map[string]interface{}, result *dbhandler.BulkResult) []bulkItem {
+	prepared := make([]bulkItem, 0, len(items))
+	for index, item := range items {
+		willInsertDoc, objectID, err := mongoHelper.NewItemDoc(item)
+		if err != nil {
+			result.Fail(index, err)
+			continue
+		}
+		result.Items[index].ID = objectID.Hex()
+		doc, err := normalize(willInsertDoc)
+		if err != nil {
+			result.Fail(index, err)
+			continue
+		}
+		prepared = append(prepared, bulkItem{index: index, objectID: objectID, doc: doc})
+	}
+	return prepared
+}
+
+// AddNewItems inserts the items, a failing item does not stop the others
+func (m *memoryHandler) AddNewItems(ctx context.Context, dataName string, items []map[string]interface{}) (dbhandler.BulkResult, error) {
+	result := dbhandler.NewBulkResult(len(items))
+	prepared := prepareBulk(items, &result)
+	if err := m.begin(ctx); err != nil {
+		return result, failAll(&result, prepared, err)
+	}
+	defer m.mu.Unlock()
+	opts := m.options[dataName]
+	c := m.collection(dataName, true)
+	for _, item := range prepared {
+		opts.StampNewItem(ctx, item.doc)
+		result.Fail(item.index, c.insert(dataName, item.objectID, item.doc))
+	}
+	return result, result.Err()
+}
+
+// UpsertItems replaces the items with the same _id or inserts them when there is none.
+// In collections with managed fields the fields of existing items are set one by one.
+// Upserting a removed item of a soft deleting collection fails with a duplicate key error.
+func (m *memoryHandler) UpsertItems(ctx context.Context, dataName string, items []map[string]interface{}) (dbhandler.BulkResult, error) {
+	result := dbhandler.NewBulkResult(len(items))
+	prepared := prepareBulk(items, &result)
+	if err := m.begin(ctx); err != nil {
+		return result, failAll(&result, prepared, err)
+	}
+	defer m.mu.Unlock()
+	opts := m.options[dataName]
+	managed := len(opts.ManagedFields()) > 0
+	c := m.collection(dataName, true)
+	for _, item := range prepared {
+		// Removed items are not replaced, inserting them fails like in mongo
+		existing := c.item(item.objectID, opts, dbhandler.ExcludeDeleted)
+		ok := existing != nil
+		if ok && managed {
+			opts.StripManaged(item.doc)
+			_, updated := opts.Stamp(ctx)
+			for key, value := range updated {
+				item.doc[key] = value
+			}
+			if opts.Versioned {
+				item.doc[dbhandler.VersionField] = dbhandler.VersionOf(existing) + 1
+			}
+			result.Fail(item.index, c.merge(dataName, existing, item.doc))
+			continue
+		}
+		if ok {
+			result.Fail(item.index, c.replace(dataName, item.doc))
+			continue
+		}
+		opts.StampNewItem(ctx, item.doc)
+		result.Fail(item.index, c.insert(dataName, item.objectID, item.doc))
+	}
+	return result, result.Err()
+}
+
+// RemoveItemsByIDs removes the items with the given ids, an id without item is not an error
+func (m *memoryHandler) RemoveItemsByIDs(ctx context.Context, dataName string, ids []interface{}) (dbhandler.BulkResult, error) {
+	result := dbhandler.NewBulkResult(len(ids))
+	prepared := make([]bulkItem, 0, len(ids))
+	for index, id := range ids {
+		objectID, err := mongoHelper.CreateObjectID(id)
+		if err != nil {
+			result.Fail(index, err)
+			continue
+		}
+		result.Items[index].ID = objectID.Hex()
+		prepared = append(prepared, bulkItem{index: index, objectID: objectID})
+	}
+	if err := m.begin(ctx); err != nil {
+		return result, failAll(&result, prepared, err)
+	}
+	defer m.mu.Unlock()
+	opts := m.options[dataName]
+	c := m.collection(dataName, false)
+	for _, item := range prepared {
+		if doc := c.item(item.objectID, opts, dbhandler.ExcludeDeleted); doc != nil {
+			result.Fail(item.index, c.removeItem(ctx, dataName, opts, doc))
+		}
+	}
+	return result, result.Err()
+}
+
+// RemoveItemsBy removes every item matching the filter and returns how many were removed
+func (m *memoryHandler) RemoveItemsBy(ctx context.Context, dataName string, filter dbhandler.Filter) (int, error) {
+	if filter.IsEmpty() {
+		return 0, dbhandler.Errorf(dbhandler.ErrInvalidFilter, "an empty filter would remove every item")
+	}
+	if err := filter.Validate(); err != nil {
+		return 0, err
+	}
+	opts := m.collectionOptions(dataName)
+	query := mongoHelper.FilterQuery(dbhandler.And(filter, opts.DeletedFilter(dbhandler.ExcludeDeleted)))
+	if err := m.begin(ctx); err != nil {
+		return 0, err
+	}
+	defer m.mu.Unlock()
+	c := m.collection(dataName, false)
+	docs, err := c.find(query)
+	if err != nil {
+		return 0, err
+	}
+	for _, doc := range docs {
+		if err = c.removeItem(ctx, dataName, opts, doc); err != nil {
+			return 0, err
+		}
+	}
+	return len(docs), nil
+}
+
+// failAll marks every prepared item failed when the bulk could not run
+func failAll(result *dbhandler.BulkResult, prepared []bulkItem, err error) error {
+	for _, item := range prepared {
+		result.Fail(item.index, err)
+	}
+	return err
+}
+
+// merge sets the fields of doc on a copy of existing
+func (c *collection) merge(dataName string, existing bson.M, doc bson.M) error {
+	merged, _ := normalize(existing)
+	for key, value := range doc {
+		if err := assign(merged, key, value); err != nil {
+			return err
+		}
+	}
+	return c.replace(dataName, merged)
+}
@@ -0,0 +1,137 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/doctor-services/services/dbhandler"
+	mongoHelper "github.com/doctor-services/services/helper/mongo"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// idIndex is the index every collection has
+var idIndex = dbhandler.Index{Name: "_id_", Key: []string{"_id"}}
+
+// EnsureIndexes declares the indexes of the collections. Unique indexes are enforced
+// on every write, expiring items are not removed.
+func (m *memoryHandler) EnsureIndexes(ctx context.Context, indexes dbhandler.Indexes) error {
+	if err := indexes.Validate(); err != nil {
+		return err
+	}
+	if err := m.begin(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	for dataName, declared := range indexes {
+		c := m.collection(dataName, true)
+		for _, index := range declared {
+			if err := c.ensureIndex(dataName, index); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ListIndexes lists the _id index and the declared indexes of a collection
+func (m *memoryHandler) ListIndexes(ctx context.Context, dataName string) ([]dbhandler.Index, error) {
+	if err := m.begin(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	c := m.collection(dataName, false)
+	if c == nil {
+		return nil, nil
+	}
+	indexes := []dbhandler.Index{idIndex}
+	for _, index := range c.indexes {
+		index.Name = index.IndexName()
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+func (c *collection) ensureIndex(dataName string, index dbhandler.Index) error {
+	for _, existing := range c.indexes {
+		if existing.IndexName() != index.IndexName() {
+			continue
+		}
+		if !dbhandler.DiffIndexes([]dbhandler.Index{index}, []dbhandler.Index{existing}).IsEmpty() {
+			return mongoHelper.MapError(&mgo.QueryError{
+				Code:    85,
+				Message: fmt.Sprintf("Index with name: %s already exists with different options", index.IndexName()),
+			})
+		}
+		return nil
+	}
+	if index.Unique {
+		seen := make([]bson.M, 0, len(c.ids))
+		for _, id := range c.ids {
+			doc := c.docs[id]
+			for _, other := range seen {
+				if sameIndexKey(index, doc, other) {
+					return duplicateKeyError(dataName, index.IndexName(), keyValues(index, doc))
+				}
+			}
+			seen = append(seen, doc)
+		}
+	}
+	c.indexes = append(c.indexes, index)
+	return nil
+}
+
+// checkUnique returns a duplicate key error when doc would break a unique index.
+// The item with doc's _id is not compared, doc replaces it.
+func (c *collection) checkUnique(dataName string, doc bson.M) error {
+	for _, index := range c.indexes {
+		if !index.Unique {
+			continue
+		}
+		for _, id := range c.ids {
+			if id == doc["_id"] {
+				continue
+			}
+			if sameIndexKey(index, doc, c.docs[id]) {
+				return duplicateKeyError(dataName, index.IndexName(), keyValues(index, doc))
+			}
+		}
+	}
+	return nil
+}
+
+func sameIndexKey(index dbhandler.Index, a bson.M, b bson.M) bool {
+	valuesA, hasA := indexValues(index, a)
+	valuesB, hasB := indexValues(index, b)
+	if index.Sparse && (!hasA || !hasB) {
+		return false
+	}
+	for position := range valuesA {
+		if compareValues(valuesA[position], valuesB[position]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// indexValues returns the values of the key fields, missing fields are null like in mongo.
+// It also tells whether doc has any key field.
+func indexValues(index dbhandler.Index, doc bson.M) ([]interface{}, bool) {
+	values := make([]interface{}, len(index.Key))
+	present := false
+	for position, key := range index.Key {
+		field := strings.TrimPrefix(strings.TrimPrefix(key, "-"), "+")
+		if value, ok := lookup(doc, field); ok {
+			values[position] = value
+			present = true
+		}
+	}
+	return values, present
+}
+
+func keyValues(index dbhandler.Index, doc bson.M) []interface{} {
+	values, _ := indexValues(index, doc)
+	return values
+}
@@ -0,0 +1,80 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/doctor-services/services/dbhandler"
+	mongoHelper "github.com/doctor-services/services/helper/mongo"
+)
+
+// IterateItems iterates over a snapshot of the listed items taken when it is called.
+// Unlike mongo the snapshot is held in memory, the batch size is ignored.
+func (m *memoryHandler) IterateItems(ctx context.Context, dataName string, opts dbhandler.IterateOptions) (dbhandler.Iterator, error) {
+	sortKeys, err := dbhandler.NormalizeSort(opts.Sort)
+	if err != nil {
+		return nil, err
+	}
+	if err = opts.Projection.Validate(); err != nil {
+		return nil, err
+	}
+	opts.Filter = dbhandler.And(opts.Filter, m.collectionOptions(dataName).DeletedFilter(opts.Deleted))
+	query, err := mongoHelper.ListQuery(opts.ListOptions)
+	if err != nil {
+		return nil, err
+	}
+	if err = m.begin(ctx); err != nil {
+		return nil, err
+	}
+	defer m.mu.Unlock()
+	found, err := m.collection(dataName, false).find(query)
+	if err != nil {
+		return nil, err
+	}
+	sortDocs(found, mongoHelper.SortFields(sortKeys))
+	items := make([]map[string]interface{}, len(found))
+	for index, doc := range found {
+		items[index] = output(mongoHelper.Project(doc, opts.Projection))
+	}
+	return &iterator{ctx: ctx, items: items, next: -1}, nil
+}
+
+// iterator reads a snapshot of items
+type iterator struct {
+	ctx   context.Context
+	items []map[string]interface{}
+	next  int
+	err   error
+}
+
+func (it *iterator) Next() bool {
+	if it.items == nil {
+		return false
+	}
+	if err := it.ctx.Err(); err != nil {
+		it.err = mongoHelper.MapError(err)
+		it.Close()
+		return false
+	}
+	it.next++
+	if it.next >= len(it.items) {
+		it.Close()
+		return false
+	}
+	return true
+}
+
+func (it *iterator) Item() map[string]interface{} {
+	if it.items == nil || it.next < 0 {
+		return nil
+	}
+	return it.items[it.next]
+}
+
+func (it *iterator) Err() error {
+	return it.err
+}
+
+func (it *iterator) Close() error {
+	it.items = nil
+	return it.err
+}
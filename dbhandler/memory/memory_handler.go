@@ -0,0 +1,518 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/doctor-services/services/dbhandler"
+	mongoHelper "github.com/doctor-services/services/helper/mongo"
+	paingHelper "github.com/doctor-services/services/helper/paging"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// collection keeps documents in insertion order, which is the natural
+// order mongo returns them in when no sort is given
+type collection struct {
+	ids     []bson.ObjectId
+	docs    map[bson.ObjectId]bson.M
+	indexes []dbhandler.Index
+}
+
+type memoryHandler struct {
+	mu          sync.RWMutex
+	connected   bool
+	collections map[string]*collection
+	options     map[string]dbhandler.CollectionOptions
+}
+
+// GetConnection marks the handler as connected, there is nothing to dial
+func (m *memoryHandler) GetConnection() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connected = true
+	return nil
+}
+
+func (m *memoryHandler) IsConnecting() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.connected
+}
+
+// CloseConnection marks the handler as disconnected. Stored items are kept
+// like they would be on a mongo server.
+func (m *memoryHandler) CloseConnection() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connected = false
+}
+
+// Ping only checks the context, the memory handler is always reachable
+func (m *memoryHandler) Ping(ctx context.Context) error {
+	return mongoHelper.MapError(ctx.Err())
+}
+
+// begin does what every mongo call does first: check the context and make
+// sure the connection is open. It returns with the lock held.
+func (m *memoryHandler) begin(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return mongoHelper.MapError(err)
+	}
+	m.mu.Lock()
+	m.connected = true
+	return nil
+}
+
+func (m *memoryHandler) collection(dataName string, create bool) *collection {
+	c, ok := m.collections[dataName]
+	if !ok && create {
+		if m.collections == nil {
+			m.collections = map[string]*collection{}
+		}
+		c = &collection{docs: map[bson.ObjectId]bson.M{}}
+		m.collections[dataName] = c
+	}
+	return c
+}
+
+// find returns the stored documents matching the filters in natural order
+func (c *collection) find(filters interface{}) ([]bson.M, error) {
+	if c == nil {
+		return nil, nil
+	}
+	filter, err := normalize(filters)
+	if err != nil {
+		return nil, err
+	}
+	var found []bson.M
+	for _, id := range c.ids {
+		doc := c.docs[id]
+		ok, err := matches(doc, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			found = append(found, doc)
+		}
+	}
+	return found, nil
+}
+
+func (c *collection) insert(dataName string, objectID bson.ObjectId, doc bson.M) error {
+	if _, ok := c.docs[objectID]; ok {
+		return duplicateKeyError(dataName, "_id_", objectID)
+	}
+	if err := c.checkUnique(dataName, doc); err != nil {
+		return err
+	}
+	c.ids = append(c.ids, objectID)
+	c.docs[objectID] = doc
+	return nil
+}
+
+// replace stores doc in place of the item with the same _id
+func (c *collection) replace(dataName string, doc bson.M) error {
+	if err := c.checkUnique(dataName, doc); err != nil {
+		return err
+	}
+	c.docs[doc["_id"].(bson.ObjectId)] = doc
+	return nil
+}
+
+func (c *collection) remove(id bson.ObjectId) {
+	delete(c.docs, id)
+	for index, storedID := range c.ids {
+		if storedID == id {
+			c.ids = append(c.ids[:index], c.ids[index+1:]...)
+			break
+		}
+	}
+}
+
+// output copies a stored document into the generic map returned by mongo handler
+func output(doc bson.M) map[string]interface{} {
+	copied, _ := normalize(doc)
+	return mongoHelper.CreateMapFromBsonM(copied)
+}
+
+// GetAllItems get all items with paging infor
+func (m *memoryHandler) GetAllItems(dataname string, limit int, page int, orderBy string,
+	sortBy string, filters map[string]interface{}) (dbhandler.PagedResults, error) {
+	return m.GetAllItemsContext(context.Background(), dataname, limit, page, orderBy, sortBy, filters)
+}
+
+// GetAllItemsContext get all items with paging infor, honoring the context
+func (m *memoryHandler) GetAllItemsContext(ctx context.Context, dataName string, limit int, page int, orderBy string,
+	sortBy string, filters map[string]interface{}) (dbhandler.PagedResults, error) {
+	return m.ListItems(ctx, dataName, limit, page, dbhandler.ListOptions{
+		Filters: filters,
+		Sort:    dbhandler.SortFromOrder(orderBy, sortBy),
+	})
+}
+
+// GetAllItemsByKey get a page of items with only the key field
+func (m *memoryHandler) GetAllItemsByKey(dataname string, limit int, page int, orderBy string,
+	sortBy string, filters map[string]interface{}, key string) (dbhandler.PagedResults, error) {
+	return m.GetAllItemsByKeyContext(context.Background(), dataname, limit, page, orderBy, sortBy, filters, key)
+}
+
+// GetAllItemsByKeyContext get a page of items with only the key field, honoring the context
+func (m *memoryHandler) GetAllItemsByKeyContext(ctx context.Context, dataName string, limit int, page int, orderBy string,
+	sortBy string, filters map[string]interface{}, key string) (dbhandler.PagedResults, error) {
+	return m.ListItems(ctx, dataName, limit, page, dbhandler.ListOptions{
+		Filters:    filters,
+		Sort:       dbhandler.SortFromOrder(orderBy, sortBy),
+		Projection: dbhandler.KeyProjection(key),
+	})
+}
+
+// GetAllItemsNoLimit get every item with only the key field
+func (m *memoryHandler) GetAllItemsNoLimit(dataname string, key string) ([]map[string]interface{}, error) {
+	return m.GetAllItemsNoLimitContext(context.Background(), dataname, key)
+}
+
+// GetAllItemsNoLimitContext get every item with only the key field, honoring the context
+func (m *memoryHandler) GetAllItemsNoLimitContext(ctx context.Context, dataName string, key string) ([]map[string]interface{}, error) {
+	it, err := m.IterateItems(ctx, dataName, dbhandler.IterateOptions{
+		ListOptions: dbhandler.ListOptions{Projection: dbhandler.KeyProjection(key)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	genericItems := []map[string]interface{}{}
+	err = dbhandler.ForEach(it, func(item map[string]interface{}) error {
+		genericItems = append(genericItems, item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return genericItems, nil
+}
+
+// ListItems get a page of items sorted by every sort key in order
+func (m *memoryHandler) ListItems(ctx context.Context, dataName string, limit int, page int,
+	opts dbhandler.ListOptions) (dbhandler.PagedResults, error) {
+	sortKeys, err := dbhandler.NormalizeSort(opts.Sort)
+	if err != nil {
+		return dbhandler.PagedResults{}, err
+	}
+	if err = opts.Projection.Validate(); err != nil {
+		return dbhandler.PagedResults{}, err
+	}
+	opts.Filter = dbhandler.And(opts.Filter, m.collectionOptions(dataName).DeletedFilter(opts.Deleted))
+	query, err := mongoHelper.ListQuery(opts)
+	if err != nil {
+		return dbhandler.PagedResults{}, err
+	}
+	if err = m.begin(ctx); err != nil {
+		return dbhandler.PagedResults{}, err
+	}
+	defer m.mu.Unlock()
+	found, err := m.collection(dataName, false).find(query)
+	if err != nil {
+		return dbhandler.PagedResults{}, err
+	}
+	total := len(found)
+	sortDocs(found, mongoHelper.SortFields(sortKeys))
+	// First we need to skip previous page items
+	skip := (page * limit) - limit
+	if skip < 0 {
+		skip = 0
+	}
+	if skip > len(found) {
+		skip = len(found)
+	}
+	found = found[skip:]
+	if limit > 0 && limit < len(found) {
+		found = found[:limit]
+	}
+	pagingInfor := paingHelper.NewPaginator(total, limit, page)
+	genericItems := make([]map[string]interface{}, len(found))
+	for index, doc := range found {
+		genericItems[index] = output(mongoHelper.Project(doc, opts.Projection))
+	}
+	return dbhandler.PagedResults{
+		Total:           total,
+		CurrentPage:     page,
+		TotalPage:       pagingInfor.TotalPage,
+		PageSize:        len(genericItems),
+		NextPage:        pagingInfor.NextPage,
+		PreviousPage:    pagingInfor.PreviousPage,
+		HasNextPage:     pagingInfor.HasNextPage,
+		HasPreviousPage: pagingInfor.HasPreviousPage,
+		Items:           genericItems,
+	}, nil
+}
+
+// sortDocs sorts documents by mongo sort fields like "+name" or "-rating"
+func sortDocs(docs []bson.M, fields []string) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, field := range fields {
+			desc := strings.HasPrefix(field, "-")
+			field = strings.TrimLeft(field, "+-")
+			a, _ := lookup(docs[i], field)
+			b, _ := lookup(docs[j], field)
+			result := compareValues(a, b)
+			if result != 0 {
+				return (result < 0) != desc
+			}
+		}
+		return false
+	})
+}
+
+// GetItemsAfter get a page of items following the cursor
+func (m *memoryHandler) GetItemsAfter(ctx context.Context, dataName string, limit int, cursor string,
+	orderBy string, sortBy string, filters map[string]interface{}) (dbhandler.CursorResults, error) {
+	return m.ListItemsAfter(ctx, dataName, limit, cursor, dbhandler.ListOptions{
+		Filters: filters,
+		Sort:    dbhandler.SortFromOrder(orderBy, sortBy),
+	})
+}
+
+// ListItemsAfter get a page of items following the cursor
+func (m *memoryHandler) ListItemsAfter(ctx context.Context, dataName string, limit int, cursor string,
+	opts dbhandler.ListOptions) (dbhandler.CursorResults, error) {
+	if limit <= 0 {
+		return dbhandler.CursorResults{}, dbhandler.ErrInvalidLimit
+	}
+	position, err := mongoHelper.ParseCursor(cursor, opts.Sort)
+	if err != nil {
+		return dbhandler.CursorResults{}, err
+	}
+	if err = opts.Projection.Validate(); err != nil {
+		return dbhandler.CursorResults{}, err
+	}
+	opts.Filter = dbhandler.And(opts.Filter, m.collectionOptions(dataName).DeletedFilter(opts.Deleted))
+	query, err := mongoHelper.ListQuery(opts)
+	if err != nil {
+		return dbhandler.CursorResults{}, err
+	}
+	query = mongoHelper.CursorQuery(position, query)
+	if err = m.begin(ctx); err != nil {
+		return dbhandler.CursorResults{}, err
+	}
+	defer m.mu.Unlock()
+	found, err := m.collection(dataName, false).find(query)
+	if err != nil {
+		return dbhandler.CursorResults{}, err
+	}
+	sortDocs(found, mongoHelper.SortFields(position.Sort))
+	if len(found) > limit+1 {
+		found = found[:limit+1]
+	}
+	docs := make([]bson.M, len(found))
+	for index, doc := range found {
+		docs[index], _ = normalize(doc)
+	}
+	return mongoHelper.NewCursorResults(position, docs, limit, opts.Projection), nil
+}
+
+func (m *memoryHandler) AddNewItem(dataName string, item map[string]interface{}) (map[string]interface{}, error) {
+	return m.AddNewItemContext(context.Background(), dataName, item)
+}
+
+func (m *memoryHandler) AddNewItemContext(ctx context.Context, dataName string, item map[string]interface{}) (map[string]interface{}, error) {
+	// Create unique id for item
+	willInsertDoc, objectID, err := mongoHelper.NewItemDoc(item)
+	if err != nil {
+		return willInsertDoc, err
+	}
+	m.collectionOptions(dataName).StampNewItem(ctx, willInsertDoc)
+	doc, err := normalize(willInsertDoc)
+	if err != nil {
+		return item, err
+	}
+	if err = m.begin(ctx); err != nil {
+		return item, err
+	}
+	defer m.mu.Unlock()
+	if err = m.collection(dataName, true).insert(dataName, objectID, doc); err != nil {
+		return item, err
+	}
+	// return hexid
+	willInsertDoc["_id"] = objectID.Hex()
+	return willInsertDoc, nil
+}
+
+// duplicateKeyError builds the same error mongo reports for a unique index violation
+func duplicateKeyError(dataName string, index string, key interface{}) error {
+	return mongoHelper.MapError(&mgo.LastError{
+		Code: 11000,
+		Err:  fmt.Sprintf("E11000 duplicate key error collection: %s index: %s dup key: { : %v }", dataName, index, key),
+	})
+}
+
+// errNotFound is returned when no item has the given id, like mongo does
+var errNotFound = mongoHelper.MapError(mgo.ErrNotFound)
+
+func (m *memoryHandler) RemoveItemByID(dataName string, id interface{}) error {
+	return m.RemoveItemByIDContext(context.Background(), dataName, id)
+}
+
+func (m *memoryHandler) RemoveItemByIDContext(ctx context.Context, dataName string, id interface{}) error {
+	// Make sure to use correct object id
+	objectID, err := mongoHelper.CreateObjectID(id)
+	if err != nil {
+		return err
+	}
+	if err = m.begin(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	c := m.collection(dataName, false)
+	doc := c.item(objectID, m.options[dataName], dbhandler.ExcludeDeleted)
+	if doc == nil {
+		return errNotFound
+	}
+	return c.removeItem(ctx, dataName, m.options[dataName], doc)
+}
+
+func (m *memoryHandler) FindItemByID(dataName string, id interface{}) (map[string]interface{}, error) {
+	return m.FindItemByIDContext(context.Background(), dataName, id)
+}
+
+func (m *memoryHandler) FindItemByIDContext(ctx context.Context, dataName string, id interface{}) (map[string]interface{}, error) {
+	return m.FindItemByIDWithOptions(ctx, dataName, id, dbhandler.FindOptions{})
+}
+
+// FindItemByIDWithOptions find an item, only returning the projected fields
+func (m *memoryHandler) FindItemByIDWithOptions(ctx context.Context, dataName string, id interface{},
+	opts dbhandler.FindOptions) (map[string]interface{}, error) {
+	var data map[string]interface{}
+	// Make sure to use correct object id
+	objectID, err := mongoHelper.CreateObjectID(id)
+	if err != nil {
+		return data, err
+	}
+	if err = opts.Projection.Validate(); err != nil {
+		return data, err
+	}
+	if err = m.begin(ctx); err != nil {
+		return data, err
+	}
+	defer m.mu.Unlock()
+	doc := m.collection(dataName, false).item(objectID, m.options[dataName], opts.Deleted)
+	if doc == nil {
+		return data, errNotFound
+	}
+	return output(mongoHelper.Project(doc, opts.Projection)), nil
+}
+
+// UpdateByID replaces the whole item like mongo handler does
+func (m *memoryHandler) UpdateByID(dataName string, id interface{}, update map[string]interface{}) error {
+	return m.UpdateByIDContext(context.Background(), dataName, id, update)
+}
+
+func (m *memoryHandler) UpdateByIDContext(ctx context.Context, dataName string, id interface{}, update map[string]interface{}) error {
+	_, err := m.replaceByID(ctx, dataName, id, -1, update)
+	return err
+}
+
+// replaceByID replaces an item and returns its new version in versioned collections.
+// A negative expected version replaces any version.
+func (m *memoryHandler) replaceByID(ctx context.Context, dataName string, id interface{}, expected int64,
+	update map[string]interface{}) (int64, error) {
+	// Make sure to use correct object id
+	objectID, err := mongoHelper.CreateObjectID(id)
+	if err != nil {
+		return 0, err
+	}
+	// Not allow to update id
+	willUpdateDoc := mongoHelper.CloneStringMap(update)
+	delete(willUpdateDoc, "_id")
+	doc, err := normalize(willUpdateDoc)
+	if err != nil {
+		return 0, err
+	}
+	doc["_id"] = objectID
+	if err = m.begin(ctx); err != nil {
+		return 0, err
+	}
+	defer m.mu.Unlock()
+	opts := m.options[dataName]
+	c := m.collection(dataName, false)
+	current := c.item(objectID, opts, dbhandler.ExcludeDeleted)
+	if current == nil {
+		return 0, errNotFound
+	}
+	opts.StampReplacement(ctx, doc, current)
+	if !opts.Versioned {
+		return 0, c.replace(dataName, doc)
+	}
+	version := dbhandler.VersionOf(current)
+	if expected >= 0 && expected != version {
+		return 0, versionConflict(objectID, expected)
+	}
+	doc[dbhandler.VersionField] = version + 1
+	return version + 1, c.replace(dataName, doc)
+}
+
+func (m *memoryHandler) UpdateBy(dataName string, selector interface{}, update map[string]interface{}) error {
+	return m.UpdateByContext(context.Background(), dataName, selector, update)
+}
+
+func (m *memoryHandler) UpdateByContext(ctx context.Context, dataName string, selector interface{}, update map[string]interface{}) error {
+	query, err := mongoHelper.SelectorQuery(selector)
+	if err != nil {
+		return err
+	}
+	willUpdateDoc := mongoHelper.CloneStringMap(update)
+	delete(willUpdateDoc, "_id")
+	opts := m.collectionOptions(dataName)
+	opts.StripManaged(willUpdateDoc)
+	_, stamped := opts.Stamp(ctx)
+	for key, value := range stamped {
+		willUpdateDoc[key] = value
+	}
+	set, err := normalize(willUpdateDoc)
+	if err != nil {
+		return err
+	}
+	for key := range set {
+		if strings.HasPrefix(key, "$") {
+			return fmt.Errorf("The dollar ($) prefixed field '%s' is not valid for storage", key)
+		}
+	}
+	if err = m.begin(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	c := m.collection(dataName, false)
+	found, err := c.find(query)
+	if err != nil {
+		return err
+	}
+	for _, doc := range found {
+		if !opts.Visible(doc, dbhandler.ExcludeDeleted) {
+			continue
+		}
+		// Every item gets its own copy of the new values
+		updated, _ := normalize(doc)
+		values, _ := normalize(set)
+		for key, value := range values {
+			if err = assign(updated, key, value); err != nil {
+				return err
+			}
+		}
+		if opts.Versioned {
+			updated[dbhandler.VersionField] = dbhandler.VersionOf(doc) + 1
+		}
+		if err = c.replace(dataName, updated); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewMemoryHandler create a database handler which keeps everything in memory.
+// It behaves like the mongo handler and is meant for tests and local development.
+func NewMemoryHandler() dbhandler.DatabaseHandler {
+	return &memoryHandler{}
+}
@@ -0,0 +1,282 @@
+package memory
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/doctor-services/services/dbhandler"
+	"github.com/doctor-services/services/dbhandler/dbhandlertest"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+const CollectionName = "test_collection"
+
+func seedItems(t *testing.T, handler *memoryHandler) []string {
+	items := []map[string]interface{}{
+		{"name": "Anna", "specialty": "cardiology", "rating": 4, "tags": []string{"senior", "surgeon"}},
+		{"name": "Binh", "specialty": "dermatology", "rating": 5, "address": map[string]interface{}{"city": "Hanoi"}},
+		{"name": "Chi", "specialty": "cardiology", "rating": 3.5},
+		{"name": "Dung", "specialty": "pediatrics"},
+	}
+	ids := make([]string, len(items))
+	for index, item := range items {
+		inserted, err := handler.AddNewItem(CollectionName, item)
+		if err != nil {
+			t.Fatalf("Insert item must not return error but got %v", err)
+		}
+		ids[index] = inserted["_id"].(string)
+	}
+	return ids
+}
+
+func TestNewMemoryHandler(t *testing.T) {
+	dbhandler := NewMemoryHandler()
+	if dbhandler.IsConnecting() {
+		t.Error("Connection must be closed before got connecting")
+	}
+	if err := dbhandler.GetConnection(); err != nil {
+		t.Fatalf("Get connection must not return error but got %v", err)
+	}
+	if !dbhandler.IsConnecting() {
+		t.Error("Connection must be open after got connecting")
+	}
+	dbhandler.CloseConnection()
+	if dbhandler.IsConnecting() {
+		t.Error("After called close, connection must be closed")
+	}
+}
+
+func TestInsertAndFindByID(t *testing.T) {
+	dbhandler := &memoryHandler{}
+	createdAt := time.Now()
+	message := map[string]interface{}{
+		"content":   "This is test message",
+		"actorID":   1,
+		"createdAt": createdAt,
+	}
+	inserted, err := dbhandler.AddNewItem(CollectionName, message)
+	if err != nil {
+		t.Fatalf("Insert item must not return error but got %v", err)
+	}
+	if _, ok := message["_id"]; ok {
+		t.Fatalf("Insert must not modify original item")
+	}
+	id, ok := inserted["_id"].(string)
+	if !ok || !bson.IsObjectIdHex(id) {
+		t.Fatalf("Inserted item must have hex id but got %v", inserted["_id"])
+	}
+	found, err := dbhandler.FindItemByID(CollectionName, id)
+	if err != nil {
+		t.Fatalf("Error during find message by ID: %s", err.Error())
+	}
+	if found["content"] != message["content"] || found["actorID"] != 1 {
+		t.Fatalf("Found and inserted not match: expected %v but got %v", message, found)
+	}
+	// Like mongo, stored times only keep milliseconds
+	if !found["createdAt"].(time.Time).Equal(createdAt.Truncate(time.Millisecond)) {
+		t.Errorf("Expected %v but got %v", createdAt, found["createdAt"])
+	}
+	found["content"] = "changed"
+	again, _ := dbhandler.FindItemByID(CollectionName, bson.ObjectIdHex(id))
+	if again["content"] != message["content"] {
+		t.Fatalf("Changing a found item must not change the stored item")
+	}
+}
+
+func TestInsertDuplicateID(t *testing.T) {
+	handler := &memoryHandler{}
+	id := bson.NewObjectId()
+	_, err := handler.AddNewItem(CollectionName, map[string]interface{}{"_id": id})
+	if err != nil {
+		t.Fatalf("Insert item must not return error but got %v", err)
+	}
+	_, err = handler.AddNewItem(CollectionName, map[string]interface{}{"_id": id.Hex()})
+	if !dbhandler.IsDuplicateKey(err) {
+		t.Fatalf("Expected duplicate key error but got %v", err)
+	}
+}
+
+func TestInvalidID(t *testing.T) {
+	dbhandler := &memoryHandler{}
+	if _, err := dbhandler.AddNewItem(CollectionName, map[string]interface{}{"_id": "fdsafas"}); err == nil {
+		t.Error("Insert with wrong id must return error")
+	}
+	if _, err := dbhandler.FindItemByID(CollectionName, ""); err == nil {
+		t.Error("Find with wrong id must return error")
+	}
+	if err := dbhandler.RemoveItemByID(CollectionName, "fdsafas"); err == nil {
+		t.Error("Remove with wrong id must return error")
+	}
+	if err := dbhandler.UpdateByID(CollectionName, "", map[string]interface{}{}); err == nil {
+		t.Error("Update with wrong id must return error")
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	handler := &memoryHandler{}
+	id := bson.NewObjectId()
+	if _, err := handler.FindItemByID(CollectionName, id); !dbhandler.IsNotFound(err) {
+		t.Errorf("Expected not found error but got %v", err)
+	}
+	if err := handler.RemoveItemByID(CollectionName, id); !dbhandler.IsNotFound(err) {
+		t.Errorf("Expected not found error but got %v", err)
+	}
+	if err := handler.UpdateByID(CollectionName, id, map[string]interface{}{}); !dbhandler.IsNotFound(err) {
+		t.Errorf("Expected not found error but got %v", err)
+	}
+}
+
+func TestRemoveItemByID(t *testing.T) {
+	dbhandler := &memoryHandler{}
+	ids := seedItems(t, dbhandler)
+	if err := dbhandler.RemoveItemByID(CollectionName, ids[1]); err != nil {
+		t.Fatalf("Remove must not return error but got %v", err)
+	}
+	if _, err := dbhandler.FindItemByID(CollectionName, ids[1]); err == nil {
+		t.Fatalf("After deleting, find must return error")
+	}
+	results, _ := dbhandler.GetAllItems(CollectionName, 10, 1, "", "", nil)
+	if results.Total != 3 {
+		t.Fatalf("Expected 3 items left but got %d", results.Total)
+	}
+}
+
+func TestGetAllItemsPaging(t *testing.T) {
+	dbhandler := &memoryHandler{}
+	seedItems(t, dbhandler)
+	results, err := dbhandler.GetAllItems(CollectionName, 3, 2, "ASC", "name", nil)
+	if err != nil {
+		t.Fatalf("Error when get all items %s", err.Error())
+	}
+	if results.Total != 4 || results.TotalPage != 2 || results.PageSize != 1 || results.CurrentPage != 2 {
+		t.Fatalf("Wrong paging infor: %+v", results)
+	}
+	if results.HasNextPage || !results.HasPreviousPage || results.PreviousPage != 1 {
+		t.Fatalf("Wrong paging infor: %+v", results)
+	}
+	if results.Items[0]["name"] != "Dung" {
+		t.Fatalf("Expected Dung on last page but got %v", results.Items[0]["name"])
+	}
+}
+
+func TestGetAllItemsSort(t *testing.T) {
+	dbhandler := &memoryHandler{}
+	seedItems(t, dbhandler)
+	results, err := dbhandler.GetAllItems(CollectionName, 10, 1, "DESC", "rating", nil)
+	if err != nil {
+		t.Fatalf("Error when get all items %s", err.Error())
+	}
+	var names []interface{}
+	for _, item := range results.Items {
+		names = append(names, item["name"])
+	}
+	// Missing values are the lowest in mongo sort order
+	expected := []interface{}{"Binh", "Anna", "Chi", "Dung"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Expected %v but got %v", expected, names)
+	}
+}
+
+func TestGetAllItemsFilters(t *testing.T) {
+	dbhandler := &memoryHandler{}
+	seedItems(t, dbhandler)
+	tests := []struct {
+		name    string
+		filters map[string]interface{}
+		want    int
+	}{
+		{"equal", map[string]interface{}{"specialty": "cardiology"}, 2},
+		{"array contains", map[string]interface{}{"tags": "surgeon"}, 1},
+		{"nested field", map[string]interface{}{"address.city": "Hanoi"}, 1},
+		{"null matches missing", map[string]interface{}{"rating": nil}, 1},
+		{"greater than", map[string]interface{}{"rating": bson.M{"$gte": 4}}, 2},
+		{"in", map[string]interface{}{"name": bson.M{"$in": []string{"Anna", "Dung", "Nobody"}}}, 2},
+		{"not equal", map[string]interface{}{"specialty": bson.M{"$ne": "cardiology"}}, 2},
+		{"exists", map[string]interface{}{"rating": bson.M{"$exists": false}}, 1},
+		{"regex", map[string]interface{}{"name": bson.M{"$regex": "^b", "$options": "i"}}, 1},
+		{"or", map[string]interface{}{"$or": []interface{}{
+			bson.M{"name": "Anna"}, bson.M{"specialty": "pediatrics"},
+		}}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := dbhandler.GetAllItems(CollectionName, 10, 1, "", "", tt.filters)
+			if err != nil {
+				t.Fatalf("Error when get all items %s", err.Error())
+			}
+			if results.Total != tt.want {
+				t.Fatalf("Expected %d items but got %d", tt.want, results.Total)
+			}
+		})
+	}
+	_, err := dbhandler.GetAllItems(CollectionName, 10, 1, "", "", map[string]interface{}{"$where": "true"})
+	if err == nil {
+		t.Fatalf("Unsupported operator must return error")
+	}
+}
+
+func TestUpdateBy(t *testing.T) {
+	dbhandler := &memoryHandler{}
+	ids := seedItems(t, dbhandler)
+	update := map[string]interface{}{"_id": bson.NewObjectId(), "seen": true, "address.zip": "100000"}
+	cloned := map[string]interface{}{}
+	for key, value := range update {
+		cloned[key] = value
+	}
+	err := dbhandler.UpdateBy(CollectionName, map[string]interface{}{"specialty": "cardiology"}, update)
+	if err != nil {
+		t.Fatalf("Update by must not return error but got %s", err.Error())
+	}
+	if !reflect.DeepEqual(update, cloned) {
+		t.Fatalf("Update must not modify original item")
+	}
+	for _, id := range ids[:3] {
+		item, err := dbhandler.FindItemByID(CollectionName, id)
+		if err != nil {
+			t.Fatalf("Update must not change the id but got %v", err)
+		}
+		seen, _ := item["seen"].(bool)
+		if seen != (item["specialty"] == "cardiology") {
+			t.Errorf("Only selected items must be updated but got %v", item)
+		}
+	}
+	item, _ := dbhandler.FindItemByID(CollectionName, ids[0])
+	if item["name"] != "Anna" || item["address"].(bson.M)["zip"] != "100000" {
+		t.Errorf("Update must only set given fields but got %v", item)
+	}
+}
+
+func TestUpdateByID(t *testing.T) {
+	dbhandler := &memoryHandler{}
+	ids := seedItems(t, dbhandler)
+	err := dbhandler.UpdateByID(CollectionName, ids[0], map[string]interface{}{"_id": ids[1], "name": "Anh"})
+	if err != nil {
+		t.Fatalf("Update by id must not return error but got %s", err.Error())
+	}
+	item, _ := dbhandler.FindItemByID(CollectionName, ids[0])
+	expected := map[string]interface{}{"_id": ids[0], "name": "Anh"}
+	if !reflect.DeepEqual(item, expected) {
+		t.Fatalf("Expected %v but got %v", expected, item)
+	}
+}
+
+func TestContextCancelled(t *testing.T) {
+	dbhandler := &memoryHandler{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := dbhandler.AddNewItemContext(ctx, CollectionName, map[string]interface{}{}); err != context.Canceled {
+		t.Fatalf("Expected %v but got %v", context.Canceled, err)
+	}
+	if dbhandler.IsConnecting() {
+		t.Error("Cancelled call must not open a connection")
+	}
+}
+
+func TestConformance(t *testing.T) {
+	dbhandlertest.Run(t, func(t *testing.T) dbhandler.DatabaseHandler {
+		return NewMemoryHandler()
+	})
+}
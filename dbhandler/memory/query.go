@@ -0,0 +1,418 @@
+package memory
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// normalize converts any document like value (map, bson.M, struct) into the
+// bson.M mongo would hand back after storing it, so both handlers see the
+// same value types (e.g. nested maps become bson.M, times lose nanoseconds)
+func normalize(doc interface{}) (bson.M, error) {
+	result := bson.M{}
+	if doc == nil {
+		return result, nil
+	}
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	err = bson.Unmarshal(data, &result)
+	return result, err
+}
+
+// lookup finds the value of a dotted path in a document.
+// Like mongo, a path going through an array collects the values of every element.
+func lookup(doc bson.M, path string) (interface{}, bool) {
+	var current interface{} = doc
+	for _, segment := range strings.Split(path, ".") {
+		switch value := current.(type) {
+		case bson.M:
+			next, ok := value[segment]
+			if !ok {
+				return nil, false
+			}
+			current = next
+		case []interface{}:
+			if index, err := strconv.Atoi(segment); err == nil {
+				if index < 0 || index >= len(value) {
+					return nil, false
+				}
+				current = value[index]
+				continue
+			}
+			var collected []interface{}
+			for _, element := range value {
+				if sub, ok := element.(bson.M); ok {
+					if found, ok := lookup(sub, segment); ok {
+						collected = append(collected, found)
+					}
+				}
+			}
+			if len(collected) == 0 {
+				return nil, false
+			}
+			current = collected
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// assign sets the value of a dotted path, creating intermediate documents
+func assign(doc bson.M, path string, value interface{}) error {
+	segments := strings.Split(path, ".")
+	current := doc
+	for _, segment := range segments[:len(segments)-1] {
+		next, ok := current[segment]
+		if !ok || next == nil {
+			created := bson.M{}
+			current[segment] = created
+			current = created
+			continue
+		}
+		sub, ok := next.(bson.M)
+		if !ok {
+			return fmt.Errorf("cannot create field '%s' in element {%s: %v}", path, segment, next)
+		}
+		current = sub
+	}
+	current[segments[len(segments)-1]] = value
+	return nil
+}
+
+// matches reports whether a normalized document satisfies a normalized mongo filter
+func matches(doc bson.M, filter bson.M) (bool, error) {
+	for key, condition := range filter {
+		var (
+			ok  bool
+			err error
+		)
+		switch key {
+		case "$and", "$or", "$nor":
+			ok, err = matchLogical(doc, key, condition)
+		default:
+			if strings.HasPrefix(key, "$") {
+				return false, fmt.Errorf("unknown top level operator: %s", key)
+			}
+			ok, err = matchField(doc, key, condition)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchLogical(doc bson.M, operator string, condition interface{}) (bool, error) {
+	clauses, ok := condition.([]interface{})
+	if !ok || len(clauses) == 0 {
+		return false, fmt.Errorf("%s must be a nonempty array", operator)
+	}
+	for _, clause := range clauses {
+		sub, ok := clause.(bson.M)
+		if !ok {
+			return false, fmt.Errorf("%s entries need to be full objects", operator)
+		}
+		matched, err := matches(doc, sub)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case operator == "$and" && !matched:
+			return false, nil
+		case operator == "$or" && matched:
+			return true, nil
+		case operator == "$nor" && matched:
+			return false, nil
+		}
+	}
+	return operator != "$or", nil
+}
+
+func matchField(doc bson.M, path string, condition interface{}) (bool, error) {
+	value, exists := lookup(doc, path)
+	operators, ok := condition.(bson.M)
+	if !ok || !isOperatorDoc(operators) {
+		if regex, ok := condition.(bson.RegEx); ok {
+			return matchRegex(value, regex.Pattern, regex.Options)
+		}
+		return equalsOrContains(value, condition), nil
+	}
+	for operator, argument := range operators {
+		var matched bool
+		switch operator {
+		case "$eq":
+			matched = equalsOrContains(value, argument)
+		case "$ne":
+			matched = !equalsOrContains(value, argument)
+		case "$gt", "$gte", "$lt", "$lte":
+			matched = exists && compareMatches(value, operator, argument)
+		case "$in", "$nin":
+			candidates, ok := argument.([]interface{})
+			if !ok {
+				return false, fmt.Errorf("%s needs an array", operator)
+			}
+			for _, candidate := range candidates {
+				if equalsOrContains(value, candidate) {
+					matched = true
+					break
+				}
+			}
+			if operator == "$nin" {
+				matched = !matched
+			}
+		case "$exists":
+			matched = exists == truthy(argument)
+		case "$regex":
+			pattern, options, err := regexArgument(argument, operators["$options"])
+			if err != nil {
+				return false, err
+			}
+			var regexErr error
+			matched, regexErr = matchRegex(value, pattern, options)
+			if regexErr != nil {
+				return false, regexErr
+			}
+		case "$options":
+			if _, ok := operators["$regex"]; !ok {
+				return false, fmt.Errorf("$options needs a $regex")
+			}
+			matched = true
+		default:
+			return false, fmt.Errorf("unknown operator: %s", operator)
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func isOperatorDoc(doc bson.M) bool {
+	for key := range doc {
+		if strings.HasPrefix(key, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case nil:
+		return false
+	default:
+		if number, ok := toFloat(v); ok {
+			return number != 0
+		}
+		return true
+	}
+}
+
+// equalsOrContains applies mongo equality: an array field matches when
+// the whole array or any of its elements equals the wanted value
+func equalsOrContains(value interface{}, wanted interface{}) bool {
+	if compareValues(value, wanted) == 0 {
+		return true
+	}
+	if values, ok := value.([]interface{}); ok {
+		for _, element := range values {
+			if compareValues(element, wanted) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func compareMatches(value interface{}, operator string, argument interface{}) bool {
+	candidates := []interface{}{value}
+	if values, ok := value.([]interface{}); ok {
+		candidates = append(candidates, values...)
+	}
+	for _, candidate := range candidates {
+		// Mongo only compares values of the same type bracket
+		if typeRank(candidate) != typeRank(argument) {
+			continue
+		}
+		result := compareValues(candidate, argument)
+		switch {
+		case operator == "$gt" && result > 0,
+			operator == "$gte" && result >= 0,
+			operator == "$lt" && result < 0,
+			operator == "$lte" && result <= 0:
+			return true
+		}
+	}
+	return false
+}
+
+func regexArgument(argument interface{}, options interface{}) (string, string, error) {
+	optionString, _ := options.(string)
+	switch pattern := argument.(type) {
+	case string:
+		return pattern, optionString, nil
+	case bson.RegEx:
+		if optionString == "" {
+			optionString = pattern.Options
+		}
+		return pattern.Pattern, optionString, nil
+	}
+	return "", "", fmt.Errorf("$regex has to be a string")
+}
+
+func matchRegex(value interface{}, pattern string, options string) (bool, error) {
+	flags := ""
+	for _, option := range options {
+		switch option {
+		case 'i', 'm', 's':
+			flags += string(option)
+		case 'x':
+			// Extended mode is not supported by go regexp, ignore like whitespace
+		default:
+			return false, fmt.Errorf("invalid regex option: %c", option)
+		}
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	candidates := []interface{}{value}
+	if values, ok := value.([]interface{}); ok {
+		candidates = values
+	}
+	for _, candidate := range candidates {
+		if text, ok := candidate.(string); ok && regex.MatchString(text) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// typeRank follows the mongo comparison order of bson types
+func typeRank(value interface{}) int {
+	switch value.(type) {
+	case nil:
+		return 1
+	case int, int32, int64, float64, float32:
+		return 2
+	case string, bson.Symbol:
+		return 3
+	case bson.M, map[string]interface{}, bson.D:
+		return 4
+	case []interface{}:
+		return 5
+	case []byte, bson.Binary:
+		return 6
+	case bson.ObjectId:
+		return 7
+	case bool:
+		return 8
+	case time.Time:
+		return 9
+	case bson.MongoTimestamp:
+		return 10
+	case bson.RegEx:
+		return 11
+	}
+	return 12
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// compareValues orders two bson values the way mongo sorts them
+func compareValues(a, b interface{}) int {
+	rankA, rankB := typeRank(a), typeRank(b)
+	if rankA != rankB {
+		if rankA < rankB {
+			return -1
+		}
+		return 1
+	}
+	switch rankA {
+	case 1:
+		return 0
+	case 2:
+		x, _ := toFloat(a)
+		y, _ := toFloat(b)
+		return compareFloats(x, y)
+	case 3:
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+	case 5:
+		x, y := a.([]interface{}), b.([]interface{})
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if result := compareValues(x[i], y[i]); result != 0 {
+				return result
+			}
+		}
+		return compareFloats(float64(len(x)), float64(len(y)))
+	case 6:
+		x, _ := a.([]byte)
+		y, _ := b.([]byte)
+		return bytes.Compare(x, y)
+	case 7:
+		return strings.Compare(string(a.(bson.ObjectId)), string(b.(bson.ObjectId)))
+	case 8:
+		x, y := a.(bool), b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		}
+		return 1
+	case 9:
+		x, y := a.(time.Time), b.(time.Time)
+		switch {
+		case x.Equal(y):
+			return 0
+		case x.Before(y):
+			return -1
+		}
+		return 1
+	case 10:
+		return compareFloats(float64(a.(bson.MongoTimestamp)), float64(b.(bson.MongoTimestamp)))
+	}
+	if reflect.DeepEqual(a, b) {
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func compareFloats(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,92 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/doctor-services/services/dbhandler"
+	mongoHelper "github.com/doctor-services/services/helper/mongo"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// RestoreItemByID brings back an item removed from a soft deleting collection
+func (m *memoryHandler) RestoreItemByID(ctx context.Context, dataName string, id interface{}) error {
+	if !m.collectionOptions(dataName).SoftDelete {
+		return dbhandler.ErrNotSoftDeleted
+	}
+	objectID, err := mongoHelper.CreateObjectID(id)
+	if err != nil {
+		return err
+	}
+	if err = m.begin(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	opts := m.options[dataName]
+	c := m.collection(dataName, false)
+	doc := c.item(objectID, opts, dbhandler.OnlyDeleted)
+	if doc == nil {
+		return errNotFound
+	}
+	restored, _ := normalize(doc)
+	delete(restored, dbhandler.DeletedAtField)
+	_, updated := opts.Stamp(ctx)
+	for key, value := range updated {
+		restored[key] = value
+	}
+	if opts.Versioned {
+		restored[dbhandler.VersionField] = dbhandler.VersionOf(doc) + 1
+	}
+	return c.replace(dataName, restored)
+}
+
+// PurgeDeleted permanently removes the items of a soft deleting collection which were
+// removed longer than retention ago and returns how many were purged
+func (m *memoryHandler) PurgeDeleted(ctx context.Context, dataName string, retention time.Duration) (int, error) {
+	if !m.collectionOptions(dataName).SoftDelete {
+		return 0, dbhandler.ErrNotSoftDeleted
+	}
+	query := mongoHelper.FilterQuery(dbhandler.PurgeFilter(retention))
+	if err := m.begin(ctx); err != nil {
+		return 0, err
+	}
+	defer m.mu.Unlock()
+	c := m.collection(dataName, false)
+	docs, err := c.find(query)
+	if err != nil {
+		return 0, err
+	}
+	for _, doc := range docs {
+		c.remove(doc["_id"].(bson.ObjectId))
+	}
+	return len(docs), nil
+}
+
+// item returns the stored item with the given id when a read selecting deleted items returns it
+func (c *collection) item(objectID bson.ObjectId, opts dbhandler.CollectionOptions, deleted dbhandler.DeletedItems) bson.M {
+	if c == nil {
+		return nil
+	}
+	doc := c.docs[objectID]
+	if doc == nil || !opts.Visible(doc, deleted) {
+		return nil
+	}
+	return doc
+}
+
+// removeItem removes a stored item, soft deleting collections only mark it removed
+func (c *collection) removeItem(ctx context.Context, dataName string, opts dbhandler.CollectionOptions, doc bson.M) error {
+	if !opts.SoftDelete {
+		c.remove(doc["_id"].(bson.ObjectId))
+		return nil
+	}
+	removed, _ := normalize(doc)
+	for key, value := range opts.StampDelete(ctx) {
+		removed[key] = value
+	}
+	if opts.Versioned {
+		removed[dbhandler.VersionField] = dbhandler.VersionOf(doc) + 1
+	}
+	return c.replace(dataName, removed)
+}
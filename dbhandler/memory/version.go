@@ -0,0 +1,67 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/doctor-services/services/dbhandler"
+	mongoHelper "github.com/doctor-services/services/helper/mongo"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ConfigureCollection sets the options used to write the items of a collection
+func (m *memoryHandler) ConfigureCollection(dataName string, opts dbhandler.CollectionOptions) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.options == nil {
+		m.options = map[string]dbhandler.CollectionOptions{}
+	}
+	m.options[dataName] = opts
+}
+
+func (m *memoryHandler) collectionOptions(dataName string) dbhandler.CollectionOptions {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.options[dataName]
+}
+
+// UpdateByIDIfVersion replaces an item when it still has the expected version and returns its new version
+func (m *memoryHandler) UpdateByIDIfVersion(ctx context.Context, dataName string, id interface{}, version int64,
+	update map[string]interface{}) (int64, error) {
+	if !m.collectionOptions(dataName).Versioned {
+		return 0, dbhandler.ErrNotVersioned
+	}
+	if version < 0 {
+		return 0, dbhandler.Errorf(dbhandler.ErrConflict, "no item has version %d", version)
+	}
+	return m.replaceByID(ctx, dataName, id, version, update)
+}
+
+// RemoveItemByIDIfVersion removes an item when it still has the expected version
+func (m *memoryHandler) RemoveItemByIDIfVersion(ctx context.Context, dataName string, id interface{}, version int64) error {
+	opts := m.collectionOptions(dataName)
+	if !opts.Versioned {
+		return dbhandler.ErrNotVersioned
+	}
+	objectID, err := mongoHelper.CreateObjectID(id)
+	if err != nil {
+		return err
+	}
+	if err = m.begin(ctx); err != nil {
+		return err
+	}
+	defer m.mu.Unlock()
+	c := m.collection(dataName, false)
+	doc := c.item(objectID, opts, dbhandler.ExcludeDeleted)
+	if doc == nil {
+		return errNotFound
+	}
+	if dbhandler.VersionOf(doc) != version {
+		return versionConflict(objectID, version)
+	}
+	return c.removeItem(ctx, dataName, opts, doc)
+}
+
+func versionConflict(objectID bson.ObjectId, version int64) error {
+	return dbhandler.Errorf(dbhandler.ErrConflict, "item %s is not at version %d", objectID.Hex(), version)
+}
@@ -0,0 +1,186 @@
+package mongo
+
+import (
+	"context"
+	"log"
+
+	"github.com/doctor-services/services/dbhandler"
+	mongoHelper "github.com/doctor-services/services/helper/mongo"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// AddNewItems inserts the items in one unordered bulk, a failing item does not stop the others
+func (m *mongoHandler) AddNewItems(ctx context.Context, dataName string, items []map[string]interface{}) (dbhandler.BulkResult, error) {
+	result := dbhandler.NewBulkResult(len(items))
+	opts := m.collectionOptions(dataName)
+	docs := make([]interface{}, 0, len(items))
+	indexes := make([]int, 0, len(items))
+	for index, item := range items {
+		doc, objectID, err := mongoHelper.NewItemDoc(item)
+		if err != nil {
+			result.Fail(index, InvalidObjectIDError{message: err.Error()})
+			continue
+		}
+		result.Items[index].ID = objectID.Hex()
+		opts.StampNewItem(ctx, doc)
+		docs = append(docs, doc)
+		indexes = append(indexes, index)
+	}
+	_, err := m.runBulk(ctx, dataName, &result, indexes, func(b *mgo.Bulk) {
+		b.Insert(docs...)
+	})
+	return result, err
+}
+
+// UpsertItems replaces the items with the same _id or inserts them when there is none.
+// Items without _id are always inserted. In collections with managed fields the
+// fields of existing items are set one by one, so their version can be incremented
+// and their created fields kept. Upserting a removed item of a soft deleting
+// collection fails with a duplicate key error, restore it first.
+func (m *mongoHandler) UpsertItems(ctx context.Context, dataName string, items []map[string]interface{}) (dbhandler.BulkResult, error) {
+	result := dbhandler.NewBulkResult(len(items))
+	opts := m.collectionOptions(dataName)
+	managed := len(opts.ManagedFields()) > 0
+	pairs := make([]interface{}, 0, 2*len(items))
+	indexes := make([]int, 0, len(items))
+	for index, item := range items {
+		doc, objectID, err := mongoHelper.NewItemDoc(item)
+		if err != nil {
+			result.Fail(index, InvalidObjectIDError{message: err.Error()})
+			continue
+		}
+		result.Items[index].ID = objectID.Hex()
+		if managed {
+			selector := itemSelector(opts, objectID, dbhandler.ExcludeDeleted)
+			pairs = append(pairs, selector, upsertChange(ctx, opts, doc))
+		} else {
+			pairs = append(pairs, bson.M{"_id": objectID}, doc)
+		}
+		indexes = append(indexes, index)
+	}
+	_, err := m.runBulk(ctx, dataName, &result, indexes, func(b *mgo.Bulk) {
+		b.Upsert(pairs...)
+	})
+	return result, err
+}
+
+// upsertChange sets the fields of doc and the managed fields,
+// the created fields are only set when the item is inserted
+func upsertChange(ctx context.Context, opts dbhandler.CollectionOptions, doc bson.M) bson.M {
+	delete(doc, "_id")
+	opts.StripManaged(doc)
+	created, updated := opts.Stamp(ctx)
+	for key, value := range updated {
+		doc[key] = value
+	}
+	change := bson.M{"$set": doc}
+	if len(created) > 0 {
+		change["$setOnInsert"] = created
+	}
+	if opts.Versioned {
+		change["$inc"] = bson.M{dbhandler.VersionField: 1}
+	}
+	return change
+}
+
+// RemoveItemsByIDs removes the items with the given ids in one bulk.
+// An id without item is not an error.
+func (m *mongoHandler) RemoveItemsByIDs(ctx context.Context, dataName string, ids []interface{}) (dbhandler.BulkResult, error) {
+	result := dbhandler.NewBulkResult(len(ids))
+	opts := m.collectionOptions(dataName)
+	change := deleteChange(ctx, opts)
+	selectors := make([]interface{}, 0, 2*len(ids))
+	indexes := make([]int, 0, len(ids))
+	for index, id := range ids {
+		objectID, err := createObjectID(id)
+		if err != nil {
+			result.Fail(index, err)
+			continue
+		}
+		result.Items[index].ID = objectID.Hex()
+		if opts.SoftDelete {
+			selectors = append(selectors, itemSelector(opts, objectID, dbhandler.ExcludeDeleted), change)
+		} else {
+			selectors = append(selectors, bson.M{"_id": objectID})
+		}
+		indexes = append(indexes, index)
+	}
+	_, err := m.runBulk(ctx, dataName, &result, indexes, func(b *mgo.Bulk) {
+		if opts.SoftDelete {
+			b.Update(selectors...)
+			return
+		}
+		b.Remove(selectors...)
+	})
+	return result, err
+}
+
+// RemoveItemsBy removes every item matching the filter and returns how many were removed.
+// The filter must not be empty.
+func (m *mongoHandler) RemoveItemsBy(ctx context.Context, dataName string, filter dbhandler.Filter) (int, error) {
+	if filter.IsEmpty() {
+		return 0, dbhandler.Errorf(dbhandler.ErrInvalidFilter, "an empty filter would remove every item")
+	}
+	if err := filter.Validate(); err != nil {
+		return 0, err
+	}
+	opts := m.collectionOptions(dataName)
+	query := mongoHelper.FilterQuery(dbhandler.And(filter, opts.DeletedFilter(dbhandler.ExcludeDeleted)))
+	result := dbhandler.NewBulkResult(1)
+	bulkResult, err := m.runBulk(ctx, dataName, &result, []int{0}, func(b *mgo.Bulk) {
+		if opts.SoftDelete {
+			b.UpdateAll(query, deleteChange(ctx, opts))
+			return
+		}
+		b.RemoveAll(query)
+	})
+	if err != nil {
+		if bulkErr, ok := err.(*dbhandler.BulkError); ok {
+			return 0, bulkErr.Failed[0].Err
+		}
+		return 0, err
+	}
+	return bulkResult.Matched, nil
+}
+
+// runBulk runs the operations queued by queue as one unordered bulk and marks the failed items.
+// indexes maps the position of every queued operation to its item.
+func (m *mongoHandler) runBulk(ctx context.Context, dataName string, result *dbhandler.BulkResult,
+	indexes []int, queue func(b *mgo.Bulk)) (*mgo.BulkResult, error) {
+	if len(indexes) == 0 {
+		return &mgo.BulkResult{}, result.Err()
+	}
+	var bulkResult *mgo.BulkResult
+	err := m.withCollection(ctx, dataName, func(c *mgo.Collection) error {
+		bulk := c.Bulk()
+		bulk.Unordered()
+		queue(bulk)
+		var err error
+		bulkResult, err = bulk.Run()
+		return err
+	})
+	if err == nil {
+		return bulkResult, result.Err()
+	}
+	bulkErr, ok := err.(*mgo.BulkError)
+	if !ok {
+		log.Printf("[App.db]: Error during bulk operation on %s. %s\n", dataName, err)
+		for _, index := range indexes {
+			result.Fail(index, err)
+		}
+		return nil, err
+	}
+	for _, ecase := range bulkErr.Cases() {
+		if ecase.Index < 0 || ecase.Index >= len(indexes) {
+			// Servers before 2.6 do not tell which item failed
+			for _, index := range indexes {
+				result.Fail(index, mongoHelper.MapError(ecase.Err))
+			}
+			continue
+		}
+		result.Fail(indexes[ecase.Index], mongoHelper.MapError(ecase.Err))
+	}
+	return nil, result.Err()
+}
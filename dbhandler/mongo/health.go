@@ -0,0 +1,119 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+// Health check settings, variables so tests can shorten them
+var (
+	healthCheckInterval = 10 * time.Second
+	healthCheckTimeout  = 5 * time.Second
+	minReconnectBackoff = time.Second
+	maxReconnectBackoff = time.Minute
+)
+
+// Ping tells whether the server answers before the context is done.
+// It opens the connection when needed and fails with ErrUnavailable
+// or ErrTimeout when the server cannot be reached.
+func (m *mongoHandler) Ping(ctx context.Context) error {
+	return m.withCollection(ctx, "", func(c *mgo.Collection) error {
+		return c.Database.Session.Ping()
+	})
+}
+
+// checkHealth pings the server every interval until stop is closed.
+// After a failed ping the sockets are refreshed and, while the server stays
+// unreachable, the session is dialed again with an exponential backoff from minBackoff.
+func (m *mongoHandler) checkHealth(stop <-chan struct{}, interval, minBackoff time.Duration) {
+	wait := interval
+	backoff := minBackoff
+	for {
+		timer := time.NewTimer(wait)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		err := m.pingMain(stop, false)
+		if err == nil {
+			if backoff > minBackoff {
+				log.Printf("[App.db]: Connection recovered\n")
+			}
+			wait, backoff = interval, minBackoff
+			continue
+		}
+		log.Printf("[App.db]: Health check failed, reconnecting: %s\n", err)
+		if err = m.reconnect(stop); err != nil {
+			log.Printf("[App.db]: Error during reconnect: %s\n", err)
+		}
+		wait = backoff
+		backoff = nextBackoff(backoff)
+	}
+}
+
+// nextBackoff doubles the wait up to maxReconnectBackoff
+func nextBackoff(wait time.Duration) time.Duration {
+	wait *= 2
+	if wait > maxReconnectBackoff {
+		return maxReconnectBackoff
+	}
+	return wait
+}
+
+// errNotConnected is returned by pingMain while no dial of the main session succeeded
+var errNotConnected = errors.New("not connected")
+
+// pingMain pings the server with a copy of the main session of the health
+// check stopped by stop, refreshing the main session first when asked.
+// It never opens a connection, so it cannot reopen one closed meanwhile.
+func (m *mongoHandler) pingMain(stop <-chan struct{}, refresh bool) error {
+	m.connMu.Lock()
+	if m.stopHealthCheck != stop {
+		m.connMu.Unlock()
+		return nil
+	}
+	if m.connection == nil {
+		m.connMu.Unlock()
+		return errNotConnected
+	}
+	if refresh {
+		// Drop the sockets to a server which is gone, like a stepped down primary
+		m.connection.Refresh()
+	}
+	session := m.connection.Copy()
+	m.connMu.Unlock()
+	defer session.Close()
+	session.SetSocketTimeout(healthCheckTimeout)
+	session.SetSyncTimeout(healthCheckTimeout)
+	return session.Ping()
+}
+
+// reconnect refreshes the main session and dials a new one when the server
+// still does not answer or the first dial failed. The dial runs without holding
+// connMu and the new session is dropped when the connection was closed meanwhile.
+func (m *mongoHandler) reconnect(stop <-chan struct{}) error {
+	if err := m.pingMain(stop, true); err == nil {
+		return nil
+	}
+	connection, err := m.createMongoSession()
+	if err != nil {
+		return err
+	}
+	m.connMu.Lock()
+	defer m.connMu.Unlock()
+	if m.stopHealthCheck != stop {
+		connection.Close()
+		return nil
+	}
+	if m.connection != nil {
+		m.connection.Close()
+	}
+	m.connection = connection
+	return nil
+}
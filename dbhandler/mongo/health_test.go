@@ -0,0 +1,182 @@
+package mongo
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/doctor-services/services/dbhandler"
+)
+
+func TestNextBackoff(t *testing.T) {
+	tests := []struct {
+		name string
+		wait time.Duration
+		want time.Duration
+	}{
+		{"doubles", time.Second, 2 * time.Second},
+		{"capped", 40 * time.Second, maxReconnectBackoff},
+		{"stays at max", maxReconnectBackoff, maxReconnectBackoff},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextBackoff(tt.wait); got != tt.want {
+				t.Fatalf("nextBackoff must return %v but got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPingMainWithoutConnection(t *testing.T) {
+	handler := NewMongoHandler(DbHost, DbPort, DbName, AuthDb, DbUser, DbPass).(*mongoHandler)
+	// The health check of a closed connection holds a stop channel which is not the current one
+	if err := handler.pingMain(make(chan struct{}), true); err != nil {
+		t.Fatalf("Ping of a closed connection must be skipped but got %v", err)
+	}
+	if handler.IsConnecting() {
+		t.Error("Health check must not open a connection")
+	}
+}
+
+func TestPing(t *testing.T) {
+	handler, err := initDbHandler()
+	defer handler.CloseConnection()
+	if err != nil {
+		t.Fatalf("Fail when init db")
+	}
+	if err = handler.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping must not return error but got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	time.Sleep(time.Millisecond)
+	if err = handler.Ping(ctx); !dbhandler.IsTimeout(err) {
+		t.Fatalf("Expected timeout error but got %v", err)
+	}
+}
+
+func TestPingUnreachable(t *testing.T) {
+	config := dbhandler.DatabaseConfig{Host: DbHost, Port: 1, Database: DbName, ConnectTimeout: 100 * time.Millisecond}
+	handler, err := NewMongoHandlerFromConfig(config)
+	if err != nil {
+		t.Fatalf("Valid config must not return error but got %v", err)
+	}
+	defer handler.CloseConnection()
+	if err = handler.Ping(context.Background()); !dbhandler.IsUnavailable(err) {
+		t.Fatalf("Expected unavailable error but got %v", err)
+	}
+}
+
+func TestConcurrentCloseConnection(t *testing.T) {
+	handler, err := initDbHandler()
+	defer handler.CloseConnection()
+	if err != nil {
+		t.Fatalf("Fail when init db")
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			// Calls either run or reopen the connection, they must never panic
+			handler.FindItemByIDContext(context.Background(), CollectionName, bson.NewObjectId())
+		}()
+		go func() {
+			defer wg.Done()
+			handler.CloseConnection()
+		}()
+	}
+	wg.Wait()
+	if err = handler.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping must reopen the connection but got %v", err)
+	}
+}
+
+// silentServer accepts connections and never answers, so a dial hangs until its timeout
+func silentServer(t *testing.T) (listener net.Listener, config dbhandler.DatabaseConfig, accepted *int32) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen must succeed but got %v", err)
+	}
+	accepted = new(int32)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(accepted, 1)
+			defer conn.Close()
+		}
+	}()
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	return listener, dbhandler.DatabaseConfig{Host: host, Port: portNumber, Database: DbName}, accepted
+}
+
+func TestDialDoesNotBlock(t *testing.T) {
+	listener, config, _ := silentServer(t)
+	defer listener.Close()
+	config.ConnectTimeout = 5 * time.Second
+	handler, err := NewMongoHandlerFromConfig(config)
+	if err != nil {
+		t.Fatalf("Valid config must not return error but got %v", err)
+	}
+	defer handler.CloseConnection()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err = handler.Ping(ctx); !dbhandler.IsTimeout(err) {
+		t.Fatalf("Expected timeout error but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Ping must return when its context is done but took %v", elapsed)
+	}
+	// The dial still runs, it must not hold the connection lock
+	done := make(chan struct{})
+	go func() {
+		handler.IsConnecting()
+		handler.CloseConnection()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("IsConnecting and CloseConnection must not wait for the dial")
+	}
+}
+
+func TestHealthCheckAfterFailedDial(t *testing.T) {
+	defer func(interval, backoff time.Duration) {
+		healthCheckInterval, minReconnectBackoff = interval, backoff
+	}(healthCheckInterval, minReconnectBackoff)
+	healthCheckInterval, minReconnectBackoff = 10*time.Millisecond, 10*time.Millisecond
+
+	listener, config, accepted := silentServer(t)
+	defer listener.Close()
+	handler, err := NewMongoHandlerFromConfig(config)
+	if err != nil {
+		t.Fatalf("Valid config must not return error but got %v", err)
+	}
+	defer handler.CloseConnection()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err = handler.Ping(ctx); err == nil {
+		t.Fatal("Ping of a silent server must fail")
+	}
+	// The first dial opened one connection, the health check keeps dialing meanwhile
+	deadline := time.Now().Add(3 * time.Second)
+	for atomic.LoadInt32(accepted) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Health check must dial again after the first dial failed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,81 @@
+package mongo
+
+import (
+	"context"
+	"log"
+	"sort"
+
+	"github.com/doctor-services/services/dbhandler"
+
+	"gopkg.in/mgo.v2"
+)
+
+// namespaceNotFound is the error code of listing the indexes of a missing collection
+const namespaceNotFound = 26
+
+// EnsureIndexes creates the declared indexes which do not exist yet, in the background.
+// An existing index with the same name but other options is an error, it is never dropped.
+func (m *mongoHandler) EnsureIndexes(ctx context.Context, indexes dbhandler.Indexes) error {
+	if err := indexes.Validate(); err != nil {
+		return err
+	}
+	dataNames := make([]string, 0, len(indexes))
+	for dataName := range indexes {
+		dataNames = append(dataNames, dataName)
+	}
+	sort.Strings(dataNames)
+	for _, dataName := range dataNames {
+		declared := indexes[dataName]
+		err := m.withCollection(ctx, dataName, func(c *mgo.Collection) error {
+			for _, index := range declared {
+				if err := c.EnsureIndex(mgoIndex(index)); err != nil {
+					log.Printf("[App.db]: Error during ensure index %s on %s. %s\n", index.IndexName(), dataName, err)
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListIndexes lists the existing indexes of a collection, a missing collection has none
+func (m *mongoHandler) ListIndexes(ctx context.Context, dataName string) ([]dbhandler.Index, error) {
+	var found []mgo.Index
+	err := m.withCollection(ctx, dataName, func(c *mgo.Collection) error {
+		var err error
+		found, err = c.Indexes()
+		return err
+	})
+	if queryErr, ok := err.(*mgo.QueryError); ok && queryErr.Code == namespaceNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	indexes := make([]dbhandler.Index, len(found))
+	for position, index := range found {
+		indexes[position] = dbhandler.Index{
+			Name:        index.Name,
+			Key:         index.Key,
+			Unique:      index.Unique,
+			Sparse:      index.Sparse,
+			ExpireAfter: index.ExpireAfter,
+		}
+	}
+	return indexes, nil
+}
+
+func mgoIndex(index dbhandler.Index) mgo.Index {
+	return mgo.Index{
+		Name:        index.IndexName(),
+		Key:         index.Key,
+		Unique:      index.Unique,
+		Sparse:      index.Sparse,
+		ExpireAfter: index.ExpireAfter,
+		Background:  true,
+	}
+}
@@ -0,0 +1,100 @@
+package mongo
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/doctor-services/services/dbhandler"
+	mongoHelper "github.com/doctor-services/services/helper/mongo"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// IterateItems streams the listed items through one cursor, fetching opts.BatchSize items per round trip.
+// The iterator holds a copy of the main session until it is closed.
+func (m *mongoHandler) IterateItems(ctx context.Context, dataName string, opts dbhandler.IterateOptions) (dbhandler.Iterator, error) {
+	sortKeys, err := dbhandler.NormalizeSort(opts.Sort)
+	if err != nil {
+		return nil, err
+	}
+	if err = opts.Projection.Validate(); err != nil {
+		return nil, err
+	}
+	opts.Filter = dbhandler.And(opts.Filter, m.collectionOptions(dataName).DeletedFilter(opts.Deleted))
+	query, err := mongoHelper.ListQuery(opts.ListOptions)
+	if err != nil {
+		return nil, err
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = dbhandler.DefaultBatchSize
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, mongoHelper.MapError(err)
+	}
+	session, err := m.session(ctx)
+	if err != nil {
+		log.Printf("[App.db]: Error during create mongo session: %s\n", err)
+		return nil, mongoHelper.MapError(err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := time.Until(deadline)
+		session.SetSocketTimeout(timeout)
+		session.SetSyncTimeout(timeout)
+	}
+	q := session.DB(m.database).C(dataName).Find(query).Select(mongoHelper.ProjectionDoc(opts.Projection))
+	iter := q.Sort(mongoHelper.SortFields(sortKeys)...).Batch(batchSize).Iter()
+	return &iterator{ctx: ctx, session: session, iter: iter}, nil
+}
+
+// iterator reads a mongo cursor
+type iterator struct {
+	ctx     context.Context
+	session *mgo.Session
+	iter    *mgo.Iter
+	item    map[string]interface{}
+	err     error
+}
+
+func (it *iterator) Next() bool {
+	it.item = nil
+	if it.iter == nil {
+		return false
+	}
+	if err := it.ctx.Err(); err != nil {
+		it.err = mongoHelper.MapError(err)
+		it.Close()
+		return false
+	}
+	var doc bson.M
+	if it.iter.Next(&doc) {
+		it.item = mongoHelper.CreateMapFromBsonM(doc)
+		return true
+	}
+	it.Close()
+	return false
+}
+
+func (it *iterator) Item() map[string]interface{} {
+	return it.item
+}
+
+func (it *iterator) Err() error {
+	return it.err
+}
+
+func (it *iterator) Close() error {
+	if it.iter == nil {
+		return it.err
+	}
+	err := it.iter.Close()
+	it.session.Close()
+	it.iter, it.session = nil, nil
+	if it.err == nil && err != nil {
+		log.Printf("[App.db]: Error during iterating items: %s\n", err)
+		it.err = mongoHelper.MapError(err)
+	}
+	return it.err
+}
@@ -1,19 +1,21 @@
 package mongo
 
 import (
+	"context"
+
 	mongoHelper "github.com/doctor-services/services/helper/mongo"
+	paingHelper "github.com/doctor-services/services/helper/paging"
 
 	"github.com/doctor-services/services/dbhandler"
 
 	"log"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
-
-	paingHelper "github.com/doctor-services/helpers/paging"
 )
 
 type mongoHandler struct {
@@ -24,9 +26,31 @@ type mongoHandler struct {
 	username   string
 	password   string
 	connection *mgo.Session
+	// connMu guards connection, the running dial and stopHealthCheck, which stops
+	// the health check started by the first connection attempt. It is never held
+	// while dialing.
+	connMu          sync.Mutex
+	dialing         *dialCall
+	stopHealthCheck chan struct{}
+	// dial is set by the constructors taking a config, NewMongoHandler only uses host and port
+	dial *dialOptions
+
+	// mu guards collections, the options set by ConfigureCollection
+	mu          sync.RWMutex
+	collections map[string]dbhandler.CollectionOptions
 }
 
 func (m *mongoHandler) createMongoSession() (*mgo.Session, error) {
+	if m.dial != nil {
+		info := m.dial.info
+		mongoSession, err := mgo.DialWithInfo(&info)
+		if err != nil {
+			log.Printf("[App.db]: Error during create mongo session with %s: %s\n", strings.Join(info.Addrs, ","), err)
+			return nil, err
+		}
+		m.dial.apply(mongoSession)
+		return mongoSession, nil
+	}
 	mongoDBDialInfo := &mgo.DialInfo{
 		Addrs:    []string{m.host + ":" + strconv.Itoa(m.port)},
 		Timeout:  60 * time.Second,
@@ -44,29 +68,106 @@ func (m *mongoHandler) createMongoSession() (*mgo.Session, error) {
 	return mongoSession, nil
 }
 
-// GetConnection get the singleton connection object
+// dialCall is a dial of the main session shared by the callers waiting for it
+type dialCall struct {
+	done chan struct{}
+	err  error
+}
+
+// GetConnection get the singleton connection object.
+// The first call starts checking the health of the connection in background,
+// which keeps dialing with a backoff while the server cannot be reached.
 func (m *mongoHandler) GetConnection() error {
-	if m.connection == nil {
-		var err error
-		m.connection, err = m.createMongoSession()
-		if err != nil {
-			return err
-		}
+	return m.connect(context.Background())
+}
+
+// connect opens the main session when needed. Concurrent callers share one dial,
+// which runs without holding connMu; a caller gives up waiting once ctx is done.
+func (m *mongoHandler) connect(ctx context.Context) error {
+	m.connMu.Lock()
+	if m.connection != nil {
+		m.connMu.Unlock()
+		return nil
+	}
+	if m.stopHealthCheck == nil {
+		m.stopHealthCheck = make(chan struct{})
+		go m.checkHealth(m.stopHealthCheck, healthCheckInterval, minReconnectBackoff)
+	}
+	call := m.dialing
+	if call == nil {
+		call = &dialCall{done: make(chan struct{})}
+		m.dialing = call
+		go m.dialMain(call, m.stopHealthCheck)
+	}
+	m.connMu.Unlock()
+	select {
+	case <-call.done:
+		return call.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// dialMain creates the main session for the connection stopped by stop. The session
+// is dropped when the connection was closed or reopened by the health check meanwhile.
+func (m *mongoHandler) dialMain(call *dialCall, stop chan struct{}) {
+	defer close(call.done)
+	connection, err := m.createMongoSession()
+	m.connMu.Lock()
+	defer m.connMu.Unlock()
+	if m.dialing == call {
+		m.dialing = nil
+	}
+	switch {
+	case err != nil:
+		call.err = mongoHelper.MapError(err)
+	case m.stopHealthCheck != stop:
+		connection.Close()
+		call.err = dbhandler.Errorf(dbhandler.ErrUnavailable, "connection closed")
+	case m.connection != nil:
+		connection.Close()
+	default:
+		m.connection = connection
 	}
-	return nil
 }
 
+// IsConnecting tells whether a session is open, use Ping to know whether the server answers
 func (m *mongoHandler) IsConnecting() bool {
+	m.connMu.Lock()
+	defer m.connMu.Unlock()
 	return m.connection != nil
 }
 
+// CloseConnection stops the health check and closes the main session.
+// Copies still in use by running calls stay usable until they are done,
+// a dial still running drops its session.
 func (m *mongoHandler) CloseConnection() {
+	m.connMu.Lock()
+	defer m.connMu.Unlock()
+	if m.stopHealthCheck != nil {
+		close(m.stopHealthCheck)
+		m.stopHealthCheck = nil
+	}
 	if m.connection != nil {
 		m.connection.Close()
 		m.connection = nil
 	}
 }
 
+// session opens the connection when needed and returns a copy of the main session
+func (m *mongoHandler) session(ctx context.Context) (*mgo.Session, error) {
+	if err := m.connect(ctx); err != nil {
+		return nil, err
+	}
+	m.connMu.Lock()
+	defer m.connMu.Unlock()
+	if m.connection == nil {
+		// Closed by another goroutine in between
+		return nil, dbhandler.Errorf(dbhandler.ErrUnavailable, "connection closed")
+	}
+	return m.connection.Copy(), nil
+}
+
 // InvalidObjectIDError is returned when wrong object id passed
 type InvalidObjectIDError struct {
 	message string
@@ -76,37 +177,160 @@ func (e InvalidObjectIDError) Error() string {
 	return e.message
 }
 
+// Unwrap makes the error of kind dbhandler.ErrInvalidID
+func (e InvalidObjectIDError) Unwrap() error {
+	return dbhandler.ErrInvalidID
+}
+
+// createObjectID creates a mongo object id, a wrong id is an InvalidObjectIDError
+func createObjectID(id interface{}) (bson.ObjectId, error) {
+	objectID, err := mongoHelper.CreateObjectID(id)
+	if err != nil {
+		return objectID, InvalidObjectIDError{message: err.Error()}
+	}
+	return objectID, nil
+}
+
+// withCollection runs fn against a copy of the main session.
+// The copy gets socket and sync timeouts from the context deadline and the
+// call returns as soon as the context is done, even if mongo has not answered yet.
+func (m *mongoHandler) withCollection(ctx context.Context, dataName string, fn func(c *mgo.Collection) error) (err error) {
+	defer func() {
+		err = mongoHelper.MapError(err)
+	}()
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	// Make sure connection open, waiting for a dial at most until ctx is done
+	workingDBSession, err := m.session(ctx)
+	if err != nil {
+		log.Printf("[App.db]: Error during create mongo session: %s\n", err)
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			workingDBSession.Close()
+			return context.DeadlineExceeded
+		}
+		workingDBSession.SetSocketTimeout(timeout)
+		workingDBSession.SetSyncTimeout(timeout)
+	}
+	done := make(chan error, 1)
+	go func() {
+		defer workingDBSession.Close()
+		done <- fn(workingDBSession.DB(m.database).C(dataName))
+	}()
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// withMaxTime makes the server abort a query which outlives the context deadline
+func withMaxTime(ctx context.Context, q *mgo.Query) *mgo.Query {
+	if deadline, ok := ctx.Deadline(); ok {
+		if timeout := time.Until(deadline); timeout > 0 {
+			return q.SetMaxTime(timeout)
+		}
+	}
+	return q
+}
+
 // GetAllItems get all items with paging infor
 func (m *mongoHandler) GetAllItems(dataname string, limit int, page int, orderBy string,
 	sortBy string, filters map[string]interface{}) (dbhandler.PagedResults, error) {
+	return m.GetAllItemsContext(context.Background(), dataname, limit, page, orderBy, sortBy, filters)
+}
+
+// GetAllItemsContext get all items with paging infor, honoring the context
+func (m *mongoHandler) GetAllItemsContext(ctx context.Context, dataName string, limit int, page int, orderBy string,
+	sortBy string, filters map[string]interface{}) (dbhandler.PagedResults, error) {
+	return m.ListItems(ctx, dataName, limit, page, dbhandler.ListOptions{
+		Filters: filters,
+		Sort:    dbhandler.SortFromOrder(orderBy, sortBy),
+	})
+}
+
+// GetAllItemsByKey get a page of items with only the key field
+func (m *mongoHandler) GetAllItemsByKey(dataname string, limit int, page int, orderBy string,
+	sortBy string, filters map[string]interface{}, key string) (dbhandler.PagedResults, error) {
+	return m.GetAllItemsByKeyContext(context.Background(), dataname, limit, page, orderBy, sortBy, filters, key)
+}
+
+// GetAllItemsByKeyContext get a page of items with only the key field, honoring the context
+func (m *mongoHandler) GetAllItemsByKeyContext(ctx context.Context, dataName string, limit int, page int, orderBy string,
+	sortBy string, filters map[string]interface{}, key string) (dbhandler.PagedResults, error) {
+	return m.ListItems(ctx, dataName, limit, page, dbhandler.ListOptions{
+		Filters:    filters,
+		Sort:       dbhandler.SortFromOrder(orderBy, sortBy),
+		Projection: dbhandler.KeyProjection(key),
+	})
+}
+
+// GetAllItemsNoLimit get every item with only the key field
+func (m *mongoHandler) GetAllItemsNoLimit(dataname string, key string) ([]map[string]interface{}, error) {
+	return m.GetAllItemsNoLimitContext(context.Background(), dataname, key)
+}
 
-	// Make sure connection open
-	err := m.GetConnection()
+// GetAllItemsNoLimitContext get every item with only the key field, honoring the context
+func (m *mongoHandler) GetAllItemsNoLimitContext(ctx context.Context, dataName string, key string) ([]map[string]interface{}, error) {
+	it, err := m.IterateItems(ctx, dataName, dbhandler.IterateOptions{
+		ListOptions: dbhandler.ListOptions{Projection: dbhandler.KeyProjection(key)},
+	})
 	if err != nil {
-		log.Printf("[App.db]: Error during create mongo session: %s\n", err)
+		return nil, err
+	}
+	genericItems := []map[string]interface{}{}
+	err = dbhandler.ForEach(it, func(item map[string]interface{}) error {
+		genericItems = append(genericItems, item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return genericItems, nil
+}
+
+// ListItems get a page of items sorted by every sort key in order
+func (m *mongoHandler) ListItems(ctx context.Context, dataName string, limit int, page int,
+	opts dbhandler.ListOptions) (dbhandler.PagedResults, error) {
+	sortKeys, err := dbhandler.NormalizeSort(opts.Sort)
+	if err != nil {
+		return dbhandler.PagedResults{}, err
+	}
+	if err = opts.Projection.Validate(); err != nil {
 		return dbhandler.PagedResults{}, err
 	}
-	workingDBSession := m.connection.Copy()
-	defer workingDBSession.Close()
-	c := workingDBSession.DB(m.database).C(dataname)
-	// Get total items by filters
-	total, err := c.Find(filters).Count()
+	opts.Filter = dbhandler.And(opts.Filter, m.collectionOptions(dataName).DeletedFilter(opts.Deleted))
+	query, err := mongoHelper.ListQuery(opts)
+	if err != nil {
+		return dbhandler.PagedResults{}, err
+	}
+	var (
+		total int
+		items []interface{}
+	)
+	err = m.withCollection(ctx, dataName, func(c *mgo.Collection) error {
+		// Get total items by filters
+		var err error
+		total, err = withMaxTime(ctx, c.Find(query)).Count()
+		if err != nil {
+			log.Printf("[App.db]: Error during couting items: %s\n", err)
+			return err
+		}
+		// First we need to skip previous page items
+		skip := (page * limit) - limit
+		q := c.Find(query).Select(mongoHelper.ProjectionDoc(opts.Projection))
+		q = q.Sort(mongoHelper.SortFields(sortKeys)...).Skip(skip)
+		return withMaxTime(ctx, q).Limit(limit).All(&items)
+	})
 	if err != nil {
-		log.Printf("[App.db]: Error during couting items: %s\n", err)
 		return dbhandler.PagedResults{}, err
 	}
 	pagingInfor := paingHelper.NewPaginator(total, limit, page)
-	// Create sortby string
-	sortString := "+" + sortBy
-	if strings.ToUpper(orderBy) == "DESC" {
-		sortString = "-" + sortBy
-	}
-	// First we need to skip previous page items
-	skip := (page * limit) - limit
-	q := c.Find(filters).Sort(sortString).Skip(skip)
-	//q := minquery.New(workingDBSession.DB(m.database), dataname, filters).Sort(sortString).Limit(skip)
-	var items []interface{}
-	err = q.Limit(limit).All(&items)
 	genericItems := make([]map[string]interface{}, len(items))
 	for index, item := range items {
 		d := item.(bson.M)
@@ -125,79 +349,119 @@ func (m *mongoHandler) GetAllItems(dataname string, limit int, page int, orderBy
 	}, nil
 }
 
-func (m *mongoHandler) AddNewItem(dataName string, item map[string]interface{}) (map[string]interface{}, error) {
-	// Make sure not modify original map
-	willInsertDoc := mongoHelper.CloneStringMap(item)
-	// Make sure connection open
-	err := m.GetConnection()
+// GetItemsAfter get a page of items following the cursor
+func (m *mongoHandler) GetItemsAfter(ctx context.Context, dataName string, limit int, cursor string,
+	orderBy string, sortBy string, filters map[string]interface{}) (dbhandler.CursorResults, error) {
+	return m.ListItemsAfter(ctx, dataName, limit, cursor, dbhandler.ListOptions{
+		Filters: filters,
+		Sort:    dbhandler.SortFromOrder(orderBy, sortBy),
+	})
+}
+
+// ListItemsAfter get a page of items following the cursor. Unlike ListItems
+// it neither counts nor skips, so reading deep pages costs the same as the first one.
+func (m *mongoHandler) ListItemsAfter(ctx context.Context, dataName string, limit int, cursor string,
+	opts dbhandler.ListOptions) (dbhandler.CursorResults, error) {
+	if limit <= 0 {
+		return dbhandler.CursorResults{}, dbhandler.ErrInvalidLimit
+	}
+	position, err := mongoHelper.ParseCursor(cursor, opts.Sort)
 	if err != nil {
-		log.Printf("[App.db]: Error during save %+v\n. %s\n", item, err)
-		return willInsertDoc, err
+		return dbhandler.CursorResults{}, err
 	}
-	// Create unique id for item
-	if providedID, ok := willInsertDoc["_id"]; !ok || providedID == nil || providedID == "" {
-		willInsertDoc["_id"] = bson.NewObjectId()
+	if err = opts.Projection.Validate(); err != nil {
+		return dbhandler.CursorResults{}, err
 	}
-	if _, ok := willInsertDoc["_id"].(bson.ObjectId); !ok {
-		willInsertDoc["_id"], err = mongoHelper.CreateObjectID(willInsertDoc["_id"])
-		if err != nil {
-			return willInsertDoc, err
-		}
+	opts.Filter = dbhandler.And(opts.Filter, m.collectionOptions(dataName).DeletedFilter(opts.Deleted))
+	query, err := mongoHelper.ListQuery(opts)
+	if err != nil {
+		return dbhandler.CursorResults{}, err
 	}
-	workingDBSession := m.connection.Copy()
-	defer workingDBSession.Close()
-	c := workingDBSession.DB(m.database).C(dataName)
-	indexes, _ := c.Indexes()
-	for _, index := range indexes {
-		err = c.DropIndex(index.Key...)
-		if err != nil {
-		}
+	query = mongoHelper.CursorQuery(position, query)
+	projection := mongoHelper.CursorProjection(position, opts.Projection)
+	var items []bson.M
+	err = m.withCollection(ctx, dataName, func(c *mgo.Collection) error {
+		q := c.Find(query).Select(mongoHelper.ProjectionDoc(projection))
+		q = q.Sort(mongoHelper.SortFields(position.Sort)...).Limit(limit + 1)
+		return withMaxTime(ctx, q).All(&items)
+	})
+	if err != nil {
+		log.Printf("[App.db]: Error during reading items after cursor: %s\n", err)
+		return dbhandler.CursorResults{}, err
+	}
+	return mongoHelper.NewCursorResults(position, items, limit, opts.Projection), nil
+}
+
+func (m *mongoHandler) AddNewItem(dataName string, item map[string]interface{}) (map[string]interface{}, error) {
+	return m.AddNewItemContext(context.Background(), dataName, item)
+}
+
+func (m *mongoHandler) AddNewItemContext(ctx context.Context, dataName string, item map[string]interface{}) (map[string]interface{}, error) {
+	// Create unique id for item
+	willInsertDoc, objectID, err := mongoHelper.NewItemDoc(item)
+	if err != nil {
+		return willInsertDoc, InvalidObjectIDError{message: err.Error()}
 	}
-	err = c.Insert(willInsertDoc)
+	m.collectionOptions(dataName).StampNewItem(ctx, willInsertDoc)
+	err = m.withCollection(ctx, dataName, func(c *mgo.Collection) error {
+		return c.Insert(willInsertDoc)
+	})
 	if err != nil {
+		log.Printf("[App.db]: Error during save %+v\n. %s\n", item, err)
 		return item, err
 	}
 	// return hexid
-	returnedID, _ := willInsertDoc["_id"].(bson.ObjectId).MarshalText()
-	willInsertDoc["_id"] = string(returnedID)
+	willInsertDoc["_id"] = objectID.Hex()
 	return willInsertDoc, err
 }
 
 func (m *mongoHandler) RemoveItemByID(dataName string, id interface{}) error {
-	// Make sure connection open
-	err := m.GetConnection()
+	return m.RemoveItemByIDContext(context.Background(), dataName, id)
+}
+
+func (m *mongoHandler) RemoveItemByIDContext(ctx context.Context, dataName string, id interface{}) error {
 	// Make sure to use correct object id
-	objectID, err := mongoHelper.CreateObjectID(id)
+	objectID, err := createObjectID(id)
 	if err != nil {
 		log.Printf("[App.db]: Error remove item %s. %s\n", id, err)
 		return err
 	}
-	workingDBSession := m.connection.Copy()
-	defer workingDBSession.Close()
-	c := workingDBSession.DB(m.database).C(dataName)
-	response := c.RemoveId(objectID)
-	return response
+	opts := m.collectionOptions(dataName)
+	return m.withCollection(ctx, dataName, func(c *mgo.Collection) error {
+		if opts.SoftDelete {
+			return c.Update(itemSelector(opts, objectID, dbhandler.ExcludeDeleted), deleteChange(ctx, opts))
+		}
+		return c.RemoveId(objectID)
+	})
 }
 
 func (m *mongoHandler) FindItemByID(dataName string, id interface{}) (map[string]interface{}, error) {
+	return m.FindItemByIDContext(context.Background(), dataName, id)
+}
+
+func (m *mongoHandler) FindItemByIDContext(ctx context.Context, dataName string, id interface{}) (map[string]interface{}, error) {
+	return m.FindItemByIDWithOptions(ctx, dataName, id, dbhandler.FindOptions{})
+}
+
+// FindItemByIDWithOptions find an item, only returning the projected fields
+func (m *mongoHandler) FindItemByIDWithOptions(ctx context.Context, dataName string, id interface{},
+	opts dbhandler.FindOptions) (map[string]interface{}, error) {
 	var data map[string]interface{}
-	// Make sure connection open
-	err := m.GetConnection()
-	if err != nil {
-		log.Printf("[App.db]: Error remove item %s. %s\n", id, err)
-		return data, err
-	}
 	// Make sure to use correct object id
-	objectID, err := mongoHelper.CreateObjectID(id)
+	objectID, err := createObjectID(id)
 	if err != nil {
 		log.Printf("[App.db]: Error during create object id %s. %s\n", id, err)
 		return data, err
 	}
-	workingDBSession := m.connection.Copy()
-	defer workingDBSession.Close()
-	c := workingDBSession.DB(m.database).C(dataName)
+	if err = opts.Projection.Validate(); err != nil {
+		return data, err
+	}
+	selector := itemSelector(m.collectionOptions(dataName), objectID, opts.Deleted)
 	var found interface{}
-	err = c.FindId(objectID).One(&found)
+	err = m.withCollection(ctx, dataName, func(c *mgo.Collection) error {
+		q := c.Find(selector).Select(mongoHelper.ProjectionDoc(opts.Projection))
+		return withMaxTime(ctx, q).One(&found)
+	})
 	if err != nil {
 		log.Printf("[App.db]: Error find item %s. %s\n", id, err)
 		return data, err
@@ -207,17 +471,12 @@ func (m *mongoHandler) FindItemByID(dataName string, id interface{}) (map[string
 }
 
 func (m *mongoHandler) UpdateByID(dataName string, id interface{}, update map[string]interface{}) error {
-	// Make sure connection open
-	err := m.GetConnection()
-	if err != nil {
-		log.Printf("[App.db]: Error during get connection for updating item %s. %s\n", id, err)
-		return err
-	}
-	workingDBSession := m.connection.Copy()
-	defer workingDBSession.Close()
-	c := workingDBSession.DB(m.database).C(dataName)
+	return m.UpdateByIDContext(context.Background(), dataName, id, update)
+}
+
+func (m *mongoHandler) UpdateByIDContext(ctx context.Context, dataName string, id interface{}, update map[string]interface{}) error {
 	// Make sure to use correct object id
-	objectID, err := mongoHelper.CreateObjectID(id)
+	objectID, err := createObjectID(id)
 	if err != nil {
 		log.Printf("[App.db]: Error during create object id %s. %s\n", id, err)
 		return err
@@ -225,23 +484,44 @@ func (m *mongoHandler) UpdateByID(dataName string, id interface{}, update map[st
 	// Not allow to update id
 	willUpdateDoc := mongoHelper.CloneStringMap(update)
 	delete(willUpdateDoc, "_id")
-	response := c.UpdateId(objectID, willUpdateDoc)
-	return response
+	if opts := m.collectionOptions(dataName); len(opts.ManagedFields()) > 0 {
+		_, err = m.replaceManaged(ctx, dataName, opts, objectID, -1, willUpdateDoc)
+		return err
+	}
+	return m.withCollection(ctx, dataName, func(c *mgo.Collection) error {
+		return c.UpdateId(objectID, willUpdateDoc)
+	})
 }
 
 func (m *mongoHandler) UpdateBy(dataName string, selector interface{}, update map[string]interface{}) error {
-	// Make sure connection open
-	err := m.GetConnection()
+	return m.UpdateByContext(context.Background(), dataName, selector, update)
+}
+
+func (m *mongoHandler) UpdateByContext(ctx context.Context, dataName string, selector interface{}, update map[string]interface{}) error {
+	query, err := mongoHelper.SelectorQuery(selector)
 	if err != nil {
-		log.Printf("[App.db]: Error during get connection for updating item %s. %s\n", selector, err)
 		return err
 	}
 	willUpdateDoc := mongoHelper.CloneStringMap(update)
 	delete(willUpdateDoc, "_id")
-	workingDBSession := m.connection.Copy()
-	defer workingDBSession.Close()
-	c := workingDBSession.DB(m.database).C(dataName)
-	_, err = c.UpdateAll(selector, bson.M{"$set": willUpdateDoc})
+	opts := m.collectionOptions(dataName)
+	opts.StripManaged(willUpdateDoc)
+	_, updated := opts.Stamp(ctx)
+	for key, value := range updated {
+		willUpdateDoc[key] = value
+	}
+	change := bson.M{"$set": willUpdateDoc}
+	if opts.Versioned {
+		change["$inc"] = bson.M{dbhandler.VersionField: 1}
+	}
+	query = liveQuery(opts, query)
+	err = m.withCollection(ctx, dataName, func(c *mgo.Collection) error {
+		_, err := c.UpdateAll(query, change)
+		return err
+	})
+	if err != nil {
+		log.Printf("[App.db]: Error during updating items %s. %s\n", selector, err)
+	}
 	return err
 }
 
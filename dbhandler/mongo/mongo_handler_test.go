@@ -1,6 +1,7 @@
 package mongo
 
 import (
+	"context"
 	"log"
 	"reflect"
 	"testing"
@@ -9,6 +10,8 @@ import (
 	mgo "gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
+	"github.com/doctor-services/services/dbhandler"
+	"github.com/doctor-services/services/dbhandler/dbhandlertest"
 	mongoHelper "github.com/doctor-services/services/helper/mongo"
 )
 
@@ -470,6 +473,45 @@ func TestInvalidUpdateByID(t *testing.T) {
 	}
 }
 
+func TestContextCancelledBeforeCall(t *testing.T) {
+	dbhandler := NewMongoHandler(DbHost, DbPort, DbName, AuthDb, DbUser, DbPass)
+	defer dbhandler.CloseConnection()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := dbhandler.FindItemByIDContext(ctx, CollectionName, bson.NewObjectId())
+	if err != context.Canceled {
+		t.Fatalf("Expected %v but got %v", context.Canceled, err)
+	}
+	if dbhandler.IsConnecting() {
+		t.Error("Cancelled call must not open a connection")
+	}
+}
+
+func TestGetAllItemsContextDeadline(t *testing.T) {
+	handler, err := initDbHandler()
+	defer handler.CloseConnection()
+	if err != nil {
+		t.Fatalf("Fail when init db")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	time.Sleep(time.Millisecond)
+	_, err = handler.GetAllItemsContext(ctx, CollectionName, 10, 1, "DESC", "createdAt", nil)
+	if !dbhandler.IsTimeout(err) {
+		t.Fatalf("Expected timeout error but got %v", err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	dbhandlertest.Run(t, func(t *testing.T) dbhandler.DatabaseHandler {
+		handler, err := initDbHandler()
+		if err != nil {
+			t.Fatalf("Fail when init db")
+		}
+		return handler
+	})
+}
+
 func TestInvalidObjectIDError_Error(t *testing.T) {
 	type fields struct {
 		message string
@@ -479,7 +521,7 @@ func TestInvalidObjectIDError_Error(t *testing.T) {
 		fields fields
 		want   string
 	}{
-	// TODO: Add test cases.
+		{"message", fields{"Wrong id format"}, "Wrong id format"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -493,6 +535,47 @@ func TestInvalidObjectIDError_Error(t *testing.T) {
 	}
 }
 
+func TestInvalidObjectIDErrorKind(t *testing.T) {
+	handler := NewMongoHandler(DbHost, DbPort, DbName, AuthDb, DbUser, DbPass)
+	handler.ConfigureCollection("versioned", dbhandler.CollectionOptions{Versioned: true, SoftDelete: true})
+	ctx := context.Background()
+	calls := []struct {
+		name string
+		call func() error
+	}{
+		{"FindItemByID", func() error {
+			_, err := handler.FindItemByID(CollectionName, "fdsafas")
+			return err
+		}},
+		{"RemoveItemByID", func() error { return handler.RemoveItemByID(CollectionName, "fdsafas") }},
+		{"UpdateByID", func() error { return handler.UpdateByID(CollectionName, "fdsafas", bson.M{"seen": true}) }},
+		{"RemoveItemsByIDs", func() error {
+			result, _ := handler.RemoveItemsByIDs(ctx, CollectionName, []interface{}{"fdsafas"})
+			return result.Items[0].Err
+		}},
+		{"RestoreItemByID", func() error { return handler.RestoreItemByID(ctx, "versioned", "fdsafas") }},
+		{"UpdateByIDIfVersion", func() error {
+			_, err := handler.UpdateByIDIfVersion(ctx, "versioned", "fdsafas", 1, bson.M{"seen": true})
+			return err
+		}},
+		{"RemoveItemByIDIfVersion", func() error { return handler.RemoveItemByIDIfVersion(ctx, "versioned", "fdsafas", 1) }},
+	}
+	for _, tt := range calls {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if _, ok := err.(InvalidObjectIDError); !ok {
+				t.Fatalf("%s must return InvalidObjectIDError but got %v", tt.name, err)
+			}
+			if !dbhandler.IsInvalidID(err) {
+				t.Errorf("InvalidObjectIDError must be of kind %v", dbhandler.ErrInvalidID)
+			}
+		})
+	}
+	if handler.IsConnecting() {
+		t.Error("Wrong id must not open a connection")
+	}
+}
+
 func Test_initDbHandler(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -0,0 +1,76 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/doctor-services/services/dbhandler"
+	mongoHelper "github.com/doctor-services/services/helper/mongo"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// RestoreItemByID brings back an item removed from a soft deleting collection
+func (m *mongoHandler) RestoreItemByID(ctx context.Context, dataName string, id interface{}) error {
+	opts := m.collectionOptions(dataName)
+	if !opts.SoftDelete {
+		return dbhandler.ErrNotSoftDeleted
+	}
+	objectID, err := createObjectID(id)
+	if err != nil {
+		return err
+	}
+	_, updated := opts.Stamp(ctx)
+	change := bson.M{"$unset": bson.M{dbhandler.DeletedAtField: ""}}
+	if len(updated) > 0 {
+		change["$set"] = updated
+	}
+	if opts.Versioned {
+		change["$inc"] = bson.M{dbhandler.VersionField: 1}
+	}
+	return m.withCollection(ctx, dataName, func(c *mgo.Collection) error {
+		return c.Update(itemSelector(opts, objectID, dbhandler.OnlyDeleted), change)
+	})
+}
+
+// PurgeDeleted permanently removes the items of a soft deleting collection which were
+// removed longer than retention ago and returns how many were purged
+func (m *mongoHandler) PurgeDeleted(ctx context.Context, dataName string, retention time.Duration) (int, error) {
+	if !m.collectionOptions(dataName).SoftDelete {
+		return 0, dbhandler.ErrNotSoftDeleted
+	}
+	var removed int
+	err := m.withCollection(ctx, dataName, func(c *mgo.Collection) error {
+		info, err := c.RemoveAll(mongoHelper.FilterQuery(dbhandler.PurgeFilter(retention)))
+		if info != nil {
+			removed = info.Removed
+		}
+		return err
+	})
+	return removed, err
+}
+
+// itemSelector selects the item with the given id when a read selecting deleted items returns it
+func itemSelector(opts dbhandler.CollectionOptions, objectID bson.ObjectId, deleted dbhandler.DeletedItems) bson.M {
+	selector := mongoHelper.FilterQuery(opts.DeletedFilter(deleted))
+	selector["_id"] = objectID
+	return selector
+}
+
+// liveQuery restricts query to the items of a soft deleting collection which are not removed
+func liveQuery(opts dbhandler.CollectionOptions, query interface{}) interface{} {
+	if !opts.SoftDelete {
+		return query
+	}
+	return bson.M{"$and": []interface{}{query, mongoHelper.FilterQuery(opts.DeletedFilter(dbhandler.ExcludeDeleted))}}
+}
+
+// deleteChange marks an item of a soft deleting collection removed
+func deleteChange(ctx context.Context, opts dbhandler.CollectionOptions) bson.M {
+	change := bson.M{"$set": opts.StampDelete(ctx)}
+	if opts.Versioned {
+		change["$inc"] = bson.M{dbhandler.VersionField: 1}
+	}
+	return change
+}
@@ -0,0 +1,146 @@
+package mongo
+
+import (
+	"context"
+
+	"github.com/doctor-services/services/dbhandler"
+	mongoHelper "github.com/doctor-services/services/helper/mongo"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// maxVersionRetries bounds how often a replace without expected version is retried
+// when other writers keep changing the item
+const maxVersionRetries = 10
+
+// ConfigureCollection sets the options used to write the items of a collection
+func (m *mongoHandler) ConfigureCollection(dataName string, opts dbhandler.CollectionOptions) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.collections == nil {
+		m.collections = map[string]dbhandler.CollectionOptions{}
+	}
+	m.collections[dataName] = opts
+}
+
+func (m *mongoHandler) collectionOptions(dataName string) dbhandler.CollectionOptions {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.collections[dataName]
+}
+
+// UpdateByIDIfVersion replaces an item when it still has the expected version and returns its new version
+func (m *mongoHandler) UpdateByIDIfVersion(ctx context.Context, dataName string, id interface{}, version int64,
+	update map[string]interface{}) (int64, error) {
+	opts := m.collectionOptions(dataName)
+	if !opts.Versioned {
+		return 0, dbhandler.ErrNotVersioned
+	}
+	if version < 0 {
+		return 0, dbhandler.Errorf(dbhandler.ErrConflict, "no item has version %d", version)
+	}
+	objectID, err := createObjectID(id)
+	if err != nil {
+		return 0, err
+	}
+	willUpdateDoc := mongoHelper.CloneStringMap(update)
+	delete(willUpdateDoc, "_id")
+	return m.replaceManaged(ctx, dataName, opts, objectID, version, willUpdateDoc)
+}
+
+// RemoveItemByIDIfVersion removes an item when it still has the expected version
+func (m *mongoHandler) RemoveItemByIDIfVersion(ctx context.Context, dataName string, id interface{}, version int64) error {
+	opts := m.collectionOptions(dataName)
+	if !opts.Versioned {
+		return dbhandler.ErrNotVersioned
+	}
+	objectID, err := createObjectID(id)
+	if err != nil {
+		return err
+	}
+	live := itemSelector(opts, objectID, dbhandler.ExcludeDeleted)
+	selector := itemSelector(opts, objectID, dbhandler.ExcludeDeleted)
+	selector[dbhandler.VersionField] = versionSelector(version)
+	return m.withCollection(ctx, dataName, func(c *mgo.Collection) error {
+		var err error
+		if opts.SoftDelete {
+			err = c.Update(selector, deleteChange(ctx, opts))
+		} else {
+			err = c.Remove(selector)
+		}
+		if err == mgo.ErrNotFound {
+			return versionMismatch(c, live, version)
+		}
+		return err
+	})
+}
+
+// replaceManaged replaces an item of a collection with managed fields. The created
+// fields are kept and in versioned collections the version is incremented. With a
+// negative expected version the current version is read and the replace is retried
+// until no other writer got in between.
+func (m *mongoHandler) replaceManaged(ctx context.Context, dataName string, opts dbhandler.CollectionOptions,
+	objectID bson.ObjectId, expected int64, doc map[string]interface{}) (int64, error) {
+	fields := bson.M{dbhandler.VersionField: 1}
+	for _, field := range opts.CreatedFields() {
+		fields[field] = 1
+	}
+	live := itemSelector(opts, objectID, dbhandler.ExcludeDeleted)
+	var newVersion int64
+	err := m.withCollection(ctx, dataName, func(c *mgo.Collection) error {
+		for attempt := 0; attempt < maxVersionRetries; attempt++ {
+			current := bson.M{}
+			if (opts.Versioned && expected < 0) || len(opts.CreatedFields()) > 0 {
+				if err := c.Find(live).Select(fields).One(&current); err != nil {
+					return err
+				}
+			}
+			opts.StampReplacement(ctx, doc, current)
+			selector := itemSelector(opts, objectID, dbhandler.ExcludeDeleted)
+			version := expected
+			if opts.Versioned {
+				if expected < 0 {
+					version = dbhandler.VersionOf(current)
+				}
+				doc[dbhandler.VersionField] = version + 1
+				selector[dbhandler.VersionField] = versionSelector(version)
+			}
+			err := c.Update(selector, doc)
+			if err == nil {
+				if opts.Versioned {
+					newVersion = version + 1
+				}
+				return nil
+			}
+			if err != mgo.ErrNotFound || !opts.Versioned {
+				return err
+			}
+			if expected >= 0 {
+				return versionMismatch(c, live, version)
+			}
+		}
+		return dbhandler.Errorf(dbhandler.ErrConflict, "item %s kept changing", objectID.Hex())
+	})
+	return newVersion, err
+}
+
+// versionSelector matches the version, items written before the collection was versioned have version 0
+func versionSelector(version int64) interface{} {
+	if version == 0 {
+		return bson.M{"$in": []interface{}{nil, 0}}
+	}
+	return version
+}
+
+// versionMismatch tells why a version checked write of the item selected by live matched no item
+func versionMismatch(c *mgo.Collection, live bson.M, version int64) error {
+	count, err := c.Find(live).Count()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return mgo.ErrNotFound
+	}
+	return dbhandler.Errorf(dbhandler.ErrConflict, "item %s is not at version %d", live["_id"].(bson.ObjectId).Hex(), version)
+}
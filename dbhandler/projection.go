@@ -0,0 +1,111 @@
+package dbhandler
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidProjection is returned when a projection cannot be applied
+var ErrInvalidProjection = errors.New("invalid projection")
+
+// Projection selects the fields returned for each item. Either list the fields
+// to include or the fields to exclude; the only field which may be excluded
+// while including others is _id. An empty projection returns whole items.
+type Projection struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// FindOptions changes what a find by id returns
+type FindOptions struct {
+	Projection Projection
+	// Deleted tells whether removed items of soft deleting collections are found
+	Deleted DeletedItems
+}
+
+// KeyProjection returns only the given field and _id, or whole items when key is empty
+func KeyProjection(key string) Projection {
+	if key == "" {
+		return Projection{}
+	}
+	return Projection{Include: []string{key}}
+}
+
+// IsEmpty tells whether the projection returns whole items
+func (p Projection) IsEmpty() bool {
+	return len(p.Include) == 0 && len(p.Exclude) == 0
+}
+
+// Validate checks field names and rejects projections mixing inclusion and exclusion
+func (p Projection) Validate() error {
+	fields := append(append([]string{}, p.Include...), p.Exclude...)
+	for index, field := range fields {
+		if !sortFieldPattern.MatchString(field) || strings.HasPrefix(field, "-") {
+			return Errorf(ErrInvalidProjection, "bad field name %q", field)
+		}
+		for _, other := range fields[:index] {
+			if other == field || strings.HasPrefix(other, field+".") || strings.HasPrefix(field, other+".") {
+				return Errorf(ErrInvalidProjection, "path collision at %q", field)
+			}
+		}
+	}
+	if len(p.Include) > 0 {
+		for _, field := range p.Exclude {
+			if field != "_id" {
+				return Errorf(ErrInvalidProjection, "cannot exclude %q while including fields", field)
+			}
+		}
+	}
+	return nil
+}
+
+// WithFields returns a projection which also returns the given fields
+func (p Projection) WithFields(fields ...string) Projection {
+	if p.IsEmpty() {
+		return p
+	}
+	result := Projection{}
+	for _, field := range p.Exclude {
+		if !overlapsPath(fields, field) {
+			result.Exclude = append(result.Exclude, field)
+		}
+	}
+	if len(p.Include) == 0 {
+		return result
+	}
+	result.Include = append(result.Include, p.Include...)
+	for _, field := range fields {
+		if field == "_id" || containsPath(result.Include, field) {
+			continue
+		}
+		// A parent replaces the children included before
+		included := result.Include[:0]
+		for _, listed := range result.Include {
+			if !strings.HasPrefix(listed, field+".") {
+				included = append(included, listed)
+			}
+		}
+		result.Include = append(included, field)
+	}
+	return result
+}
+
+// overlapsPath tells whether path, one of its parents or one of its children is listed
+func overlapsPath(paths []string, path string) bool {
+	for _, listed := range paths {
+		if listed == path || strings.HasPrefix(path, listed+".") || strings.HasPrefix(listed, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// containsPath tells whether path or one of its parents is listed
+func containsPath(paths []string, path string) bool {
+	for _, listed := range paths {
+		if listed == path || strings.HasPrefix(path, listed+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package dbhandler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProjectionValidate(t *testing.T) {
+	valid := []Projection{
+		{},
+		{Include: []string{"name", "address.city"}},
+		{Include: []string{"name"}, Exclude: []string{"_id"}},
+		{Exclude: []string{"schedule", "history"}},
+	}
+	for _, projection := range valid {
+		if err := projection.Validate(); err != nil {
+			t.Errorf("Projection %v must be valid but got %v", projection, err)
+		}
+	}
+	invalid := []Projection{
+		{Include: []string{"name"}, Exclude: []string{"history"}},
+		{Include: []string{"$where"}},
+		{Exclude: []string{""}},
+		{Include: []string{"address", "address.city"}},
+		{Include: []string{"name", "name"}},
+	}
+	for _, projection := range invalid {
+		if err := projection.Validate(); err == nil {
+			t.Errorf("Projection %v must be rejected", projection)
+		}
+	}
+}
+
+func TestProjectionWithFields(t *testing.T) {
+	tests := []struct {
+		name       string
+		projection Projection
+		fields     []string
+		want       Projection
+	}{
+		{"empty", Projection{}, []string{"rating"}, Projection{}},
+		{"include", Projection{Include: []string{"name"}}, []string{"rating", "_id"},
+			Projection{Include: []string{"name", "rating"}}},
+		{"already included", Projection{Include: []string{"address"}}, []string{"address.city"},
+			Projection{Include: []string{"address"}}},
+		{"parent replaces children", Projection{Include: []string{"address.city", "name"}}, []string{"address"},
+			Projection{Include: []string{"name", "address"}}},
+		{"excluded id", Projection{Include: []string{"name"}, Exclude: []string{"_id"}}, []string{"_id"},
+			Projection{Include: []string{"name"}}},
+		{"exclude", Projection{Exclude: []string{"address", "history"}}, []string{"address.city"},
+			Projection{Exclude: []string{"history"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.projection.WithFields(tt.fields...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("WithFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package dbhandler
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// DeletedAtField holds the time an item of a soft deleting collection was removed
+const DeletedAtField = "deletedAt"
+
+// ErrNotSoftDeleted is returned by restore and purge on a collection which does not soft delete
+var ErrNotSoftDeleted = errors.New("collection does not soft delete")
+
+// DeletedItems tells which items reads of a soft deleting collection return
+type DeletedItems int
+
+const (
+	// ExcludeDeleted only returns items which are not removed, reads do this by default
+	ExcludeDeleted DeletedItems = iota
+	// IncludeDeleted returns removed items too
+	IncludeDeleted
+	// OnlyDeleted only returns removed items
+	OnlyDeleted
+)
+
+// DeletedFilter returns the filter selecting the items a read returns.
+// It is empty on collections which do not soft delete.
+func (o CollectionOptions) DeletedFilter(deleted DeletedItems) Filter {
+	if !o.SoftDelete {
+		return Filter{}
+	}
+	switch deleted {
+	case IncludeDeleted:
+		return Filter{}
+	case OnlyDeleted:
+		return Exists(DeletedAtField, true)
+	}
+	return Exists(DeletedAtField, false)
+}
+
+// Visible tells whether a read selecting deleted items returns item
+func (o CollectionOptions) Visible(item map[string]interface{}, deleted DeletedItems) bool {
+	if !o.SoftDelete || deleted == IncludeDeleted {
+		return true
+	}
+	_, removed := item[DeletedAtField]
+	return removed == (deleted == OnlyDeleted)
+}
+
+// PurgeFilter selects the removed items which were kept longer than retention
+func PurgeFilter(retention time.Duration) Filter {
+	return Lte(DeletedAtField, now().Add(-retention))
+}
+
+// StampDelete returns the fields set on an item removed with ctx from a soft deleting collection:
+// DeletedAtField and the updated audit fields. The version is left to the handler.
+func (o CollectionOptions) StampDelete(ctx context.Context) map[string]interface{} {
+	_, fields := o.Stamp(ctx)
+	fields[DeletedAtField] = now().Truncate(time.Millisecond)
+	return fields
+}
@@ -0,0 +1,52 @@
+package dbhandler
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDeletedFilter(t *testing.T) {
+	soft := CollectionOptions{SoftDelete: true}
+	removed := map[string]interface{}{"name": "Anna", DeletedAtField: time.Now()}
+	kept := map[string]interface{}{"name": "Binh"}
+	tests := []struct {
+		name    string
+		opts    CollectionOptions
+		deleted DeletedItems
+		filter  Filter
+		removed bool
+		kept    bool
+	}{
+		{"hard delete", CollectionOptions{}, OnlyDeleted, Filter{}, true, true},
+		{"exclude", soft, ExcludeDeleted, Exists(DeletedAtField, false), false, true},
+		{"include", soft, IncludeDeleted, Filter{}, true, true},
+		{"only", soft, OnlyDeleted, Exists(DeletedAtField, true), true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if filter := tt.opts.DeletedFilter(tt.deleted); !reflect.DeepEqual(filter, tt.filter) {
+				t.Errorf("Expected filter %v but got %v", tt.filter, filter)
+			}
+			if tt.opts.Visible(removed, tt.deleted) != tt.removed || tt.opts.Visible(kept, tt.deleted) != tt.kept {
+				t.Errorf("Expected removed item visible %v and kept item visible %v", tt.removed, tt.kept)
+			}
+		})
+	}
+}
+
+func TestStampDelete(t *testing.T) {
+	at := time.Date(2018, 3, 4, 5, 6, 7, 8999999, time.UTC)
+	now = func() time.Time { return at }
+	defer func() { now = time.Now }()
+	fields := CollectionOptions{SoftDelete: true, Timestamps: true}.StampDelete(context.Background())
+	truncated := at.Truncate(time.Millisecond)
+	expected := map[string]interface{}{DeletedAtField: truncated, UpdatedAtField: truncated}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Fatalf("Expected %v but got %v", expected, fields)
+	}
+	if filter := PurgeFilter(time.Hour); !reflect.DeepEqual(filter, Lte(DeletedAtField, at.Add(-time.Hour))) {
+		t.Fatalf("Unexpected purge filter %v", filter)
+	}
+}
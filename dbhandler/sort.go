@@ -0,0 +1,96 @@
+package dbhandler
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidSort is returned when a sort key names an unusable field
+var ErrInvalidSort = errors.New("invalid sort")
+
+var sortFieldPattern = regexp.MustCompile(`^[A-Za-z0-9_\-]+(\.[A-Za-z0-9_\-]+)*$`)
+
+// SortKey is one field of an ordered listing
+type SortKey struct {
+	Field string `json:"field" bson:"f"`
+	Desc  bool   `json:"desc,omitempty" bson:"d,omitempty"`
+}
+
+func (k SortKey) String() string {
+	if k.Desc {
+		return "-" + k.Field
+	}
+	return "+" + k.Field
+}
+
+// ListOptions selects and orders the items of a listing
+type ListOptions struct {
+	// Filter selects the listed items
+	Filter Filter
+	// Filters is a mongo style filter map, see ParseFilterMap. It is combined with Filter.
+	Filters map[string]interface{}
+	// Sort keys are applied in order, _id is always appended as tie-breaker
+	Sort []SortKey
+	// Projection selects the returned fields
+	Projection Projection
+	// Deleted selects the removed items listed from soft deleting collections
+	Deleted DeletedItems
+}
+
+// ParseSort parses a comma separated list of fields like "specialty,-rating".
+// A "-" prefix sorts that field descending, "+" or no prefix ascending.
+func ParseSort(spec string) ([]SortKey, error) {
+	var keys []SortKey
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key := SortKey{Field: strings.TrimPrefix(field, "+")}
+		if strings.HasPrefix(field, "-") {
+			key = SortKey{Field: field[1:], Desc: true}
+		}
+		keys = append(keys, key)
+	}
+	return keys, ValidateSort(keys)
+}
+
+// SortFromOrder creates the sort keys of the single field sortBy/orderBy arguments
+func SortFromOrder(orderBy string, sortBy string) []SortKey {
+	if sortBy == "" {
+		return nil
+	}
+	return []SortKey{{Field: sortBy, Desc: strings.ToUpper(orderBy) == "DESC"}}
+}
+
+// ValidateSort checks every field name and rejects fields used twice
+func ValidateSort(keys []SortKey) error {
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if !sortFieldPattern.MatchString(key.Field) || strings.HasPrefix(key.Field, "-") {
+			return Errorf(ErrInvalidSort, "bad field name %q", key.Field)
+		}
+		if seen[key.Field] {
+			return Errorf(ErrInvalidSort, "field %q used twice", key.Field)
+		}
+		seen[key.Field] = true
+	}
+	return nil
+}
+
+// NormalizeSort validates the keys and makes them end with _id, so no two items
+// compare equal and pages never overlap. Keys following _id can never apply and are dropped.
+func NormalizeSort(keys []SortKey) ([]SortKey, error) {
+	if err := ValidateSort(keys); err != nil {
+		return nil, err
+	}
+	normalized := make([]SortKey, 0, len(keys)+1)
+	for _, key := range keys {
+		normalized = append(normalized, key)
+		if key.Field == "_id" {
+			return normalized, nil
+		}
+	}
+	return append(normalized, SortKey{Field: "_id"}), nil
+}
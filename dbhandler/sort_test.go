@@ -0,0 +1,59 @@
+package dbhandler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSort(t *testing.T) {
+	keys, err := ParseSort("specialty, -rating,+name")
+	if err != nil {
+		t.Fatalf("Valid sort must not return error but got %v", err)
+	}
+	expected := []SortKey{{Field: "specialty"}, {Field: "rating", Desc: true}, {Field: "name"}}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("Expected %v but got %v", expected, keys)
+	}
+	keys, err = ParseSort("")
+	if err != nil || len(keys) != 0 {
+		t.Fatalf("Empty sort must give no keys but got %v, %v", keys, err)
+	}
+	for _, invalid := range []string{"$where", "name,-name", "--name", "address..city", "a b"} {
+		if _, err = ParseSort(invalid); err == nil {
+			t.Errorf("Sort %q must be rejected", invalid)
+		}
+	}
+}
+
+func TestNormalizeSort(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []SortKey
+		want []SortKey
+	}{
+		{"empty", nil, []SortKey{{Field: "_id"}}},
+		{"append id", []SortKey{{Field: "rating", Desc: true}}, []SortKey{{Field: "rating", Desc: true}, {Field: "_id"}}},
+		{"keep id direction", []SortKey{{Field: "_id", Desc: true}}, []SortKey{{Field: "_id", Desc: true}}},
+		{"drop after id", []SortKey{{Field: "_id"}, {Field: "name"}}, []SortKey{{Field: "_id"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeSort(tt.keys)
+			if err != nil {
+				t.Fatalf("NormalizeSort() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NormalizeSort() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortFromOrder(t *testing.T) {
+	if keys := SortFromOrder("desc", "createdAt"); !reflect.DeepEqual(keys, []SortKey{{Field: "createdAt", Desc: true}}) {
+		t.Errorf("Expected createdAt descending but got %v", keys)
+	}
+	if keys := SortFromOrder("ASC", ""); keys != nil {
+		t.Errorf("Expected no keys but got %v", keys)
+	}
+}
@@ -0,0 +1,116 @@
+package transfer
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/doctor-services/services/dbhandler"
+)
+
+// ExportOptions configures Export
+type ExportOptions struct {
+	// IterateOptions select, order and project the exported items
+	dbhandler.IterateOptions
+	Format Format
+	// Columns are the CSV columns. When empty they are the fields of the first item,
+	// so fields missing from it are not exported.
+	Columns []Column
+}
+
+// Export streams the items of a collection to w and returns how many were written.
+// CSV cells holding arrays or documents are written as JSON, times as RFC 3339.
+func Export(ctx context.Context, handler dbhandler.IteratingDatabaseHandler, dataName string,
+	w io.Writer, opts ExportOptions) (int, error) {
+	var write func(item map[string]interface{}) error
+	var flush func() error
+	switch opts.Format {
+	case CSV:
+		writer := newCSVWriter(w, opts.Columns)
+		write, flush = writer.write, writer.flush
+	case NDJSON:
+		buffered := bufio.NewWriter(w)
+		encoder := json.NewEncoder(buffered)
+		write, flush = func(item map[string]interface{}) error {
+			return encoder.Encode(item)
+		}, buffered.Flush
+	default:
+		return 0, fmt.Errorf("unsupported format %q", opts.Format)
+	}
+	it, err := handler.IterateItems(ctx, dataName, opts.IterateOptions)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	err = dbhandler.ForEach(it, func(item map[string]interface{}) error {
+		if err := write(item); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if flushErr := flush(); err == nil {
+		err = flushErr
+	}
+	return count, err
+}
+
+// csvWriter writes the header before the first item
+type csvWriter struct {
+	writer  *csv.Writer
+	columns []Column
+	started bool
+	record  []string
+}
+
+func newCSVWriter(w io.Writer, columns []Column) *csvWriter {
+	return &csvWriter{writer: csv.NewWriter(w), columns: columns}
+}
+
+func (c *csvWriter) start(item map[string]interface{}) error {
+	c.started = true
+	if len(c.columns) == 0 && item != nil {
+		for _, path := range flatten(item) {
+			c.columns = append(c.columns, Column{Field: path})
+		}
+	}
+	if len(c.columns) == 0 {
+		return nil
+	}
+	header := make([]string, len(c.columns))
+	for index, column := range c.columns {
+		header[index] = column.header()
+	}
+	c.record = make([]string, len(c.columns))
+	return c.writer.Write(header)
+}
+
+func (c *csvWriter) write(item map[string]interface{}) error {
+	if !c.started {
+		if err := c.start(item); err != nil {
+			return err
+		}
+	}
+	for index, column := range c.columns {
+		cell, err := format(lookup(item, column.Field))
+		if err != nil {
+			return fmt.Errorf("column %s: %s", column.header(), err)
+		}
+		c.record[index] = cell
+	}
+	return c.writer.Write(c.record)
+}
+
+// flush writes the header of an empty export when the columns are known
+func (c *csvWriter) flush() error {
+	if !c.started {
+		if err := c.start(nil); err != nil {
+			return err
+		}
+	}
+	c.writer.Flush()
+	return c.writer.Error()
+}
@@ -0,0 +1,117 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doctor-services/services/dbhandler"
+	"github.com/doctor-services/services/dbhandler/memory"
+)
+
+const (
+	firstID  = "5a0b1c2d3e4f5a6b7c8d9e01"
+	secondID = "5a0b1c2d3e4f5a6b7c8d9e02"
+)
+
+func seed(t *testing.T) dbhandler.DatabaseHandler {
+	handler := memory.NewMemoryHandler()
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	_, err := handler.AddNewItems(context.Background(), "doctors", []map[string]interface{}{
+		{"_id": firstID, "name": "Ann", "rating": 4.5, "since": created,
+			"address": map[string]interface{}{"city": "Hanoi", "zip": "100000"}, "tags": []interface{}{"a", "b"}},
+		{"_id": secondID, "name": "Bob, Jr.", "rating": 3,
+			"address": map[string]interface{}{"city": "Hue"}},
+	})
+	if err != nil {
+		t.Fatalf("seeding must succeed but got %v", err)
+	}
+	return handler
+}
+
+func TestExportCSV(t *testing.T) {
+	handler := seed(t)
+	tests := []struct {
+		name    string
+		opts    ExportOptions
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "inferred columns",
+			opts: ExportOptions{Format: CSV},
+			want: "_id,address.city,address.zip,name,rating,since,tags\n" +
+				firstID + ",Hanoi,100000,Ann,4.5,2020-01-02T03:04:05Z,\"[\"\"a\"\",\"\"b\"\"]\"\n" +
+				secondID + ",Hue,,\"Bob, Jr.\",3,,\n",
+		},
+		{
+			name: "mapped columns",
+			opts: ExportOptions{Format: CSV, Columns: []Column{{Header: "City", Field: "address.city"}, {Field: "name"}}},
+			want: "City,name\nHanoi,Ann\nHue,\"Bob, Jr.\"\n",
+		},
+		{
+			name: "filtered and sorted",
+			opts: ExportOptions{
+				Format:         CSV,
+				Columns:        []Column{{Field: "name"}},
+				IterateOptions: dbhandler.IterateOptions{ListOptions: dbhandler.ListOptions{Filters: map[string]interface{}{"address.city": "Hue"}}},
+			},
+			want: "name\n\"Bob, Jr.\"\n",
+		},
+		{
+			name: "header of an empty export",
+			opts: ExportOptions{
+				Format:         CSV,
+				Columns:        []Column{{Field: "name"}},
+				IterateOptions: dbhandler.IterateOptions{ListOptions: dbhandler.ListOptions{Filters: map[string]interface{}{"name": "Eve"}}},
+			},
+			want: "name\n",
+		},
+		{name: "unsupported format", opts: ExportOptions{Format: "xml"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			_, err := Export(context.Background(), handler, "doctors", &out, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("export error must be %v but got %v", tt.wantErr, err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Fatalf("export must write\n%s\nbut got\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestExportNDJSONRoundTrip(t *testing.T) {
+	handler := seed(t)
+	var out bytes.Buffer
+	count, err := Export(context.Background(), handler, "doctors", &out, ExportOptions{
+		Format:         NDJSON,
+		IterateOptions: dbhandler.IterateOptions{ListOptions: dbhandler.ListOptions{Sort: []dbhandler.SortKey{{Field: "name", Desc: true}}}},
+	})
+	if err != nil || count != 2 {
+		t.Fatalf("export must write 2 items but got %d, %v", count, err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"name":"Bob, Jr."`) {
+		t.Fatalf("export must write one sorted item per line but got %q", out.String())
+	}
+
+	report, err := Import(context.Background(), handler, "copies", &out, ImportOptions{
+		Format:  NDJSON,
+		Columns: []Column{{Field: "since", Type: Time}},
+	})
+	if err != nil || report.Written != 2 || report.Failed != 0 {
+		t.Fatalf("import must write 2 items but got %+v, %v", report, err)
+	}
+	item, err := handler.FindItemByIDContext(context.Background(), "copies", firstID)
+	if err != nil {
+		t.Fatalf("imported item must be found but got %v", err)
+	}
+	if since, ok := item["since"].(time.Time); !ok || !since.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatalf("since must be imported as a time but got %#v", item["since"])
+	}
+}
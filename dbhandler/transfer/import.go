@@ -0,0 +1,335 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/doctor-services/services/dbhandler"
+)
+
+// ErrTooManyErrors is returned when an import stops after ImportOptions.MaxErrors failed rows
+var ErrTooManyErrors = errors.New("too many failed rows")
+
+// Mode tells how imported items are written
+type Mode string
+
+// Import modes
+const (
+	// Insert fails the rows whose _id is already used
+	Insert Mode = "insert"
+	// Upsert replaces the items with the same _id
+	Upsert Mode = "upsert"
+)
+
+// ImportOptions configures Import
+type ImportOptions struct {
+	Format Format
+	// Columns give the field and type of the CSV headers, matched by Header or Field.
+	// The other headers are imported as strings at the path they name.
+	// With NDJSON the string values of the column fields are converted to their type.
+	Columns []Column
+	// Mode is Insert when empty
+	Mode Mode
+	// BatchSize is the number of items written in one round trip, dbhandler.DefaultBatchSize when zero
+	BatchSize int
+	// DryRun reads and validates the rows without writing them
+	DryRun bool
+	// Validate rejects an item before it is written, the error is reported with its row
+	Validate func(item map[string]interface{}) error
+	// MaxErrors stops the import after that many failed rows, zero never stops
+	MaxErrors int
+}
+
+// RowError is a row which was not imported
+type RowError struct {
+	// Row is the position of the row in the input, from 1 and without the CSV header
+	Row int `json:"row"`
+	// ID is the hex id of the item when the database reported it
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error"`
+}
+
+// Report tells the outcome of an import
+type Report struct {
+	Read    int        `json:"read"`
+	Written int        `json:"written"`
+	Failed  int        `json:"failed"`
+	DryRun  bool       `json:"dryRun,omitempty"`
+	Errors  []RowError `json:"errors,omitempty"`
+}
+
+// Import streams the items of r into a collection in batches.
+// A row which cannot be read, converted, validated or written is added to the report
+// and the import goes on. The returned error is set when the import stopped early,
+// the report then tells what was done until then. handler may be nil in a dry run.
+func Import(ctx context.Context, handler dbhandler.BulkDatabaseHandler, dataName string,
+	r io.Reader, opts ImportOptions) (report Report, err error) {
+	report.DryRun = opts.DryRun
+	// Write errors of a batch come after the read errors of later rows
+	defer func() {
+		sort.SliceStable(report.Errors, func(i, j int) bool {
+			return report.Errors[i].Row < report.Errors[j].Row
+		})
+	}()
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = dbhandler.DefaultBatchSize
+	}
+	var write func(ctx context.Context, dataName string, items []map[string]interface{}) (dbhandler.BulkResult, error)
+	switch opts.Mode {
+	case "", Insert:
+		write = func(ctx context.Context, dataName string, items []map[string]interface{}) (dbhandler.BulkResult, error) {
+			return handler.AddNewItems(ctx, dataName, items)
+		}
+	case Upsert:
+		write = func(ctx context.Context, dataName string, items []map[string]interface{}) (dbhandler.BulkResult, error) {
+			return handler.UpsertItems(ctx, dataName, items)
+		}
+	default:
+		return report, fmt.Errorf("unsupported import mode %q", opts.Mode)
+	}
+	var read func() (map[string]interface{}, error)
+	switch opts.Format {
+	case CSV:
+		reader, err := newCSVReader(r, opts.Columns)
+		if err != nil {
+			return report, err
+		}
+		read = reader.read
+	case NDJSON:
+		reader := &ndjsonReader{reader: bufio.NewReader(r), columns: opts.Columns}
+		read = reader.read
+	default:
+		return report, fmt.Errorf("unsupported format %q", opts.Format)
+	}
+
+	importer := &importer{opts: opts, report: &report}
+	flush := func() error {
+		if len(importer.items) == 0 || opts.DryRun {
+			importer.items, importer.rows = importer.items[:0], importer.rows[:0]
+			return nil
+		}
+		result, err := write(ctx, dataName, importer.items)
+		if _, ok := err.(*dbhandler.BulkError); err != nil && !ok {
+			return err
+		}
+		report.Written += result.Succeeded
+		for _, item := range result.Items {
+			if item.Err == nil {
+				continue
+			}
+			switch dbhandler.KindOf(item.Err) {
+			case dbhandler.ErrUnavailable, dbhandler.ErrTimeout:
+				return item.Err
+			}
+			importer.fail(importer.rows[item.Index], item.ID, item.Err)
+		}
+		importer.items, importer.rows = importer.items[:0], importer.rows[:0]
+		return importer.stopped()
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		item, err := read()
+		if err == io.EOF {
+			break
+		}
+		if _, ok := err.(rowError); err != nil && !ok {
+			return report, err
+		}
+		report.Read++
+		if err == nil && opts.Validate != nil {
+			err = opts.Validate(item)
+		}
+		if err != nil {
+			importer.fail(report.Read, "", err)
+			if err := importer.stopped(); err != nil {
+				return report, err
+			}
+			continue
+		}
+		importer.items = append(importer.items, item)
+		importer.rows = append(importer.rows, report.Read)
+		if len(importer.items) >= opts.BatchSize {
+			if err := flush(); err != nil {
+				return report, err
+			}
+		}
+	}
+	// The last batch is written whole, reaching MaxErrors there does not stop anything
+	if err := flush(); err != ErrTooManyErrors {
+		return report, err
+	}
+	return report, nil
+}
+
+// importer holds the pending batch of an import
+type importer struct {
+	opts   ImportOptions
+	report *Report
+	items  []map[string]interface{}
+	// rows are the input positions of items
+	rows []int
+}
+
+func (i *importer) fail(row int, id string, err error) {
+	i.report.Failed++
+	i.report.Errors = append(i.report.Errors, RowError{Row: row, ID: id, Error: err.Error()})
+}
+
+func (i *importer) stopped() error {
+	if i.opts.MaxErrors > 0 && i.report.Failed >= i.opts.MaxErrors {
+		return ErrTooManyErrors
+	}
+	return nil
+}
+
+// rowError is an invalid row, the next rows can still be read
+type rowError struct {
+	err error
+}
+
+func (e rowError) Error() string {
+	return e.err.Error()
+}
+
+// csvReader maps the records to items by their header
+type csvReader struct {
+	reader  *csv.Reader
+	columns []Column
+}
+
+func newCSVReader(r io.Reader, columns []Column) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return &csvReader{reader: reader}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading csv header: %s", err)
+	}
+	byHeader := make(map[string]Column, len(columns))
+	for _, column := range columns {
+		byHeader[column.header()] = column
+	}
+	mapped := make([]Column, len(header))
+	for index, name := range header {
+		column, ok := byHeader[name]
+		if !ok {
+			column = Column{Field: name}
+		}
+		delete(byHeader, name)
+		mapped[index] = column
+	}
+	for _, column := range columns {
+		if _, ok := byHeader[column.header()]; ok {
+			return nil, fmt.Errorf("column %s is missing from the csv header", column.header())
+		}
+	}
+	return &csvReader{reader: reader, columns: mapped}, nil
+}
+
+// read converts the next record, empty cells are left out of the item
+func (c *csvReader) read() (map[string]interface{}, error) {
+	record, err := c.reader.Read()
+	if err != nil {
+		if _, ok := err.(*csv.ParseError); ok {
+			return nil, rowError{err}
+		}
+		return nil, err
+	}
+	item := make(map[string]interface{}, len(record))
+	for index, cell := range record {
+		if cell == "" {
+			continue
+		}
+		column := c.columns[index]
+		value, err := convert(cell, column.Type)
+		if err == nil {
+			err = assign(item, column.Field, value)
+		}
+		if err != nil {
+			return nil, rowError{fmt.Errorf("column %s: %s", column.header(), err)}
+		}
+	}
+	return item, nil
+}
+
+// ndjsonReader decodes one document per line, blank lines are skipped
+type ndjsonReader struct {
+	reader  *bufio.Reader
+	columns []Column
+}
+
+func (n *ndjsonReader) read() (map[string]interface{}, error) {
+	for {
+		line, err := n.reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			continue
+		}
+		return n.decode(line)
+	}
+}
+
+func (n *ndjsonReader) decode(line []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	var item map[string]interface{}
+	if err := decoder.Decode(&item); err != nil {
+		return nil, rowError{fmt.Errorf("invalid json: %s", err)}
+	}
+	if item == nil {
+		return nil, rowError{errors.New("invalid json: not an object")}
+	}
+	numbers(item)
+	for _, column := range n.columns {
+		text, ok := lookup(item, column.Field).(string)
+		if !ok {
+			continue
+		}
+		value, err := convert(text, column.Type)
+		if err == nil {
+			err = assign(item, column.Field, value)
+		}
+		if err != nil {
+			return nil, rowError{fmt.Errorf("field %s: %s", column.Field, err)}
+		}
+	}
+	return item, nil
+}
+
+// numbers replaces the decoded json numbers by ints when they are integral, by floats otherwise
+func numbers(value interface{}) interface{} {
+	switch value := value.(type) {
+	case json.Number:
+		if number, err := strconv.ParseInt(string(value), 10, 64); err == nil {
+			return number
+		}
+		number, _ := value.Float64()
+		return number
+	case map[string]interface{}:
+		for key, nested := range value {
+			value[key] = numbers(nested)
+		}
+	case []interface{}:
+		for index, nested := range value {
+			value[index] = numbers(nested)
+		}
+	}
+	return value
+}
@@ -0,0 +1,150 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/doctor-services/services/dbhandler/memory"
+)
+
+const doctorsCSV = "_id,name,rating,City,active\n" +
+	firstID + ",Ann,4.5,Hanoi,true\n" +
+	secondID + ",Bob,high,Hue,false\n" +
+	",Cid,3\n" +
+	",Dan,5,,true\n"
+
+func TestImportCSV(t *testing.T) {
+	columns := []Column{{Field: "rating", Type: Float}, {Header: "City", Field: "address.city"}, {Field: "active", Type: Bool}}
+	tests := []struct {
+		name       string
+		opts       ImportOptions
+		wantReport Report
+		wantErr    error
+		wantCount  int
+	}{
+		{
+			name: "reports failed rows",
+			opts: ImportOptions{Format: CSV, Columns: columns, BatchSize: 2},
+			wantReport: Report{Read: 4, Written: 2, Failed: 2, Errors: []RowError{
+				{Row: 2, Error: `column rating: strconv.ParseFloat: parsing "high": invalid syntax`},
+				{Row: 3, Error: "record on line 4: wrong number of fields"},
+			}},
+			wantCount: 2,
+		},
+		{
+			name: "dry run",
+			opts: ImportOptions{Format: CSV, Columns: columns, DryRun: true},
+			wantReport: Report{Read: 4, Failed: 2, DryRun: true, Errors: []RowError{
+				{Row: 2, Error: `column rating: strconv.ParseFloat: parsing "high": invalid syntax`},
+				{Row: 3, Error: "record on line 4: wrong number of fields"},
+			}},
+		},
+		{
+			name: "validate",
+			opts: ImportOptions{Format: CSV, Columns: columns, Validate: func(item map[string]interface{}) error {
+				if _, ok := item["address"]; !ok {
+					return errors.New("address is required")
+				}
+				return nil
+			}},
+			wantReport: Report{Read: 4, Written: 1, Failed: 3, Errors: []RowError{
+				{Row: 2, Error: `column rating: strconv.ParseFloat: parsing "high": invalid syntax`},
+				{Row: 3, Error: "record on line 4: wrong number of fields"},
+				{Row: 4, Error: "address is required"},
+			}},
+			wantCount: 1,
+		},
+		{
+			name: "max errors",
+			opts: ImportOptions{Format: CSV, Columns: columns, MaxErrors: 1},
+			wantReport: Report{Read: 2, Failed: 1, Errors: []RowError{
+				{Row: 2, Error: `column rating: strconv.ParseFloat: parsing "high": invalid syntax`},
+			}},
+			wantErr: ErrTooManyErrors,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := memory.NewMemoryHandler()
+			report, err := Import(context.Background(), handler, "doctors", strings.NewReader(doctorsCSV), tt.opts)
+			if err != tt.wantErr {
+				t.Fatalf("import error must be %v but got %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(report, tt.wantReport) {
+				t.Fatalf("import must report %+v but got %+v", tt.wantReport, report)
+			}
+			items, err := handler.GetAllItemsNoLimit("doctors", "")
+			if err != nil || len(items) != tt.wantCount {
+				t.Fatalf("import must write %d items but got %d, %v", tt.wantCount, len(items), err)
+			}
+		})
+	}
+}
+
+func TestImportCSVConvertsColumns(t *testing.T) {
+	handler := memory.NewMemoryHandler()
+	input := "_id,name,rating,City,active\n" + firstID + ",Ann,4.5,Hanoi,true\n"
+	columns := []Column{{Field: "rating", Type: Float}, {Header: "City", Field: "address.city"}, {Field: "active", Type: Bool}}
+	if _, err := Import(context.Background(), handler, "doctors", strings.NewReader(input), ImportOptions{Format: CSV, Columns: columns}); err != nil {
+		t.Fatalf("import must succeed but got %v", err)
+	}
+	item, err := handler.FindItemByIDContext(context.Background(), "doctors", firstID)
+	if err != nil {
+		t.Fatalf("imported item must be found but got %v", err)
+	}
+	address, _ := document(item["address"])
+	if item["name"] != "Ann" || item["rating"] != 4.5 || item["active"] != true || address["city"] != "Hanoi" {
+		t.Fatalf("imported item must hold the converted columns but got %v", item)
+	}
+
+	if _, err := Import(context.Background(), handler, "doctors", strings.NewReader("name\nAnn\n"),
+		ImportOptions{Format: CSV, Columns: columns}); err == nil {
+		t.Fatalf("import must fail when a column is missing from the header")
+	}
+}
+
+func TestImportModes(t *testing.T) {
+	handler := memory.NewMemoryHandler()
+	input := `{"_id":"` + firstID + `","name":"Ann","visits":3}` + "\n\n" + `{"_id":"` + firstID + `","name":"Anne"}` + "\nnot json\n"
+
+	report, err := Import(context.Background(), handler, "doctors", strings.NewReader(input), ImportOptions{Format: NDJSON})
+	if err != nil || report.Read != 3 || report.Written != 1 || report.Failed != 2 {
+		t.Fatalf("insert must write the first item only but got %+v, %v", report, err)
+	}
+	if report.Errors[0].Row != 2 || report.Errors[0].ID != firstID || report.Errors[1].Row != 3 {
+		t.Fatalf("insert must report the duplicate and invalid rows but got %+v", report.Errors)
+	}
+	item, _ := handler.FindItemByIDContext(context.Background(), "doctors", firstID)
+	if item["visits"] != int64(3) {
+		t.Fatalf("integral numbers must be imported as ints but got %#v", item["visits"])
+	}
+
+	report, err = Import(context.Background(), handler, "doctors", strings.NewReader(input), ImportOptions{Format: NDJSON, Mode: Upsert})
+	if err != nil || report.Written != 2 || report.Failed != 1 {
+		t.Fatalf("upsert must write both items but got %+v, %v", report, err)
+	}
+	item, _ = handler.FindItemByIDContext(context.Background(), "doctors", firstID)
+	if item["name"] != "Anne" {
+		t.Fatalf("upsert must replace the item but got %v", item)
+	}
+
+	if _, err := Import(context.Background(), handler, "doctors", strings.NewReader(input), ImportOptions{Format: NDJSON, Mode: "merge"}); err == nil {
+		t.Fatalf("import must reject an unsupported mode")
+	}
+}
+
+func TestParseColumns(t *testing.T) {
+	columns, err := ParseColumns("name, price:float,City=address.city,since:time")
+	want := []Column{{Field: "name"}, {Field: "price", Type: Float}, {Header: "City", Field: "address.city"}, {Field: "since", Type: Time}}
+	if err != nil || !reflect.DeepEqual(columns, want) {
+		t.Fatalf("columns must be %v but got %v, %v", want, columns, err)
+	}
+	for _, spec := range []string{"price:money", "City=", ":int"} {
+		if _, err := ParseColumns(spec); err == nil {
+			t.Fatalf("columns %q must be rejected", spec)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package transfer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Format of the exported and imported files
+type Format string
+
+// Supported formats
+const (
+	CSV Format = "csv"
+	// NDJSON writes one JSON document per line
+	NDJSON Format = "ndjson"
+)
+
+// ParseFormat reads a format name, "jsonl" is an alias of ndjson
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "csv":
+		return CSV, nil
+	case "ndjson", "jsonl":
+		return NDJSON, nil
+	}
+	return "", fmt.Errorf("unsupported format %q, use csv or ndjson", name)
+}
+
+// Type tells how imported text values are converted
+type Type string
+
+// Supported types
+const (
+	String   Type = "string"
+	Int      Type = "int"
+	Float    Type = "float"
+	Bool     Type = "bool"
+	Time     Type = "time"
+	ObjectID Type = "objectid"
+	// JSON decodes arrays and documents, which are exported to CSV as JSON
+	JSON Type = "json"
+)
+
+// Column maps a CSV column to a field
+type Column struct {
+	// Header is the CSV header, Field when empty
+	Header string
+	// Field is the dotted path of the field, like "address.city"
+	Field string
+	// Type converts the imported values, String when empty
+	Type Type
+}
+
+func (c Column) header() string {
+	if c.Header == "" {
+		return c.Field
+	}
+	return c.Header
+}
+
+// ParseColumns reads comma separated columns like "name,price:float,City=address.city".
+// Each column is an optional "header=" before the field and an optional ":type" after it.
+func ParseColumns(spec string) ([]Column, error) {
+	var columns []Column
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var column Column
+		if index := strings.Index(part, "="); index >= 0 {
+			column.Header, part = part[:index], part[index+1:]
+		}
+		if index := strings.LastIndex(part, ":"); index >= 0 {
+			column.Type, part = Type(part[index+1:]), part[:index]
+			switch column.Type {
+			case String, Int, Float, Bool, Time, ObjectID, JSON:
+			default:
+				return nil, fmt.Errorf("unsupported type %q of column %q", column.Type, part)
+			}
+		}
+		if column.Field = part; column.Field == "" {
+			return nil, fmt.Errorf("column without field in %q", spec)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// flatten lists the dotted paths of the leaves of item, sorted with _id first.
+// Arrays are leaves.
+func flatten(item map[string]interface{}) []string {
+	var paths []string
+	var walk func(prefix string, doc map[string]interface{})
+	walk = func(prefix string, doc map[string]interface{}) {
+		for key, value := range doc {
+			if nested, ok := document(value); ok && len(nested) > 0 {
+				walk(prefix+key+".", nested)
+				continue
+			}
+			paths = append(paths, prefix+key)
+		}
+	}
+	walk("", item)
+	sort.Slice(paths, func(i, j int) bool {
+		if paths[i] == "_id" || paths[j] == "_id" {
+			return paths[i] == "_id"
+		}
+		return paths[i] < paths[j]
+	})
+	return paths
+}
+
+// document returns value as a map when it is a nested document
+func document(value interface{}) (map[string]interface{}, bool) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return value, true
+	case bson.M:
+		return value, true
+	}
+	return nil, false
+}
+
+// lookup finds the value at a dotted path
+func lookup(item map[string]interface{}, path string) interface{} {
+	var current interface{} = item
+	for _, key := range strings.Split(path, ".") {
+		doc, ok := document(current)
+		if !ok {
+			return nil
+		}
+		current = doc[key]
+	}
+	return current
+}
+
+// assign sets the value at a dotted path, creating the missing documents
+func assign(item map[string]interface{}, path string, value interface{}) error {
+	keys := strings.Split(path, ".")
+	doc := item
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := doc[key]
+		if !ok {
+			created := map[string]interface{}{}
+			doc[key] = created
+			doc = created
+			continue
+		}
+		if doc, ok = document(next); !ok {
+			return fmt.Errorf("%s is not a document", key)
+		}
+	}
+	doc[keys[len(keys)-1]] = value
+	return nil
+}
+
+// format prints an exported value in a CSV cell
+func format(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case time.Time:
+		return value.UTC().Format(time.RFC3339Nano), nil
+	case bson.ObjectId:
+		return value.Hex(), nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	case []interface{}, map[string]interface{}, bson.M:
+		data, err := json.Marshal(value)
+		return string(data), err
+	}
+	return fmt.Sprint(value), nil
+}
+
+// convert parses an imported text value
+func convert(value string, t Type) (interface{}, error) {
+	switch t {
+	case "", String:
+		return value, nil
+	case Int:
+		return strconv.Atoi(value)
+	case Float:
+		return strconv.ParseFloat(value, 64)
+	case Bool:
+		return strconv.ParseBool(value)
+	case Time:
+		return time.Parse(time.RFC3339Nano, value)
+	case ObjectID:
+		if !bson.IsObjectIdHex(value) {
+			return nil, fmt.Errorf("%q is not an object id", value)
+		}
+		return bson.ObjectIdHex(value), nil
+	case JSON:
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+			return nil, err
+		}
+		return decoded, nil
+	}
+	return nil, fmt.Errorf("unsupported type %q", t)
+}
@@ -0,0 +1,52 @@
+package dbhandler
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// VersionField holds the version of the items of versioned collections.
+// New items get version 1 and every write increments it, callers cannot set it.
+const VersionField = "_version"
+
+var (
+	// ErrNotVersioned is returned by version checked writes on a collection which is not versioned
+	ErrNotVersioned = errors.New("collection is not versioned")
+	// ErrInvalidETag is returned when an entity tag, like the value of an If-Match header, is malformed
+	ErrInvalidETag = errors.New("invalid entity tag")
+)
+
+// VersionOf returns the version of an item, 0 when it has none
+func VersionOf(item map[string]interface{}) int64 {
+	switch version := item[VersionField].(type) {
+	case int64:
+		return version
+	case int:
+		return int64(version)
+	case int32:
+		return int64(version)
+	case float64:
+		return int64(version)
+	}
+	return 0
+}
+
+// ETag formats a version as a HTTP entity tag
+func ETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ParseETag reads the version of an entity tag created by ETag, like the value of an If-Match header.
+// Weak tags are accepted, a malformed tag is an error of kind ErrInvalidETag.
+func ParseETag(etag string) (int64, error) {
+	etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+	if len(etag) < 2 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		return 0, Errorf(ErrInvalidETag, "malformed entity tag %q", etag)
+	}
+	version, err := strconv.ParseInt(etag[1:len(etag)-1], 10, 64)
+	if err != nil || version < 0 {
+		return 0, Errorf(ErrInvalidETag, "malformed entity tag %q", etag)
+	}
+	return version, nil
+}
@@ -0,0 +1,37 @@
+package dbhandler
+
+import "testing"
+
+func TestVersionOf(t *testing.T) {
+	tests := []struct {
+		item map[string]interface{}
+		want int64
+	}{
+		{map[string]interface{}{}, 0},
+		{map[string]interface{}{VersionField: int64(3)}, 3},
+		{map[string]interface{}{VersionField: 3}, 3},
+		{map[string]interface{}{VersionField: float64(3)}, 3},
+		{map[string]interface{}{VersionField: "3"}, 0},
+	}
+	for _, tt := range tests {
+		if got := VersionOf(tt.item); got != tt.want {
+			t.Errorf("VersionOf(%v) = %d, want %d", tt.item, got, tt.want)
+		}
+	}
+}
+
+func TestETag(t *testing.T) {
+	if got := ETag(7); got != `"7"` {
+		t.Fatalf("ETag(7) = %s", got)
+	}
+	for _, etag := range []string{`"7"`, `W/"7"`, ` "7" `} {
+		if version, err := ParseETag(etag); err != nil || version != 7 {
+			t.Errorf("ParseETag(%s) must return 7 but got %d, %v", etag, version, err)
+		}
+	}
+	for _, etag := range []string{``, `7`, `"seven"`, `"-1"`, `*`} {
+		if _, err := ParseETag(etag); KindOf(err) != ErrInvalidETag {
+			t.Errorf("ParseETag(%s) must return an invalid entity tag error but got %v", etag, err)
+		}
+	}
+}
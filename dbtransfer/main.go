@@ -0,0 +1,226 @@
+// Command dbtransfer exports the items of a collection to CSV or NDJSON and imports them back.
+//
+//	dbtransfer export -mongo.uri mongodb://localhost/products -collection products -format csv -file products.csv
+//	dbtransfer import -mongo.uri mongodb://localhost/products -collection products -format csv -file products.csv -dry-run
+//
+// The settings are read like in the services, see helper/config, with the DBTRANSFER_ prefix
+// on the environment variables. Logs are written to stderr, so an export can go to stdout.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/doctor-services/services/dbhandler"
+	"github.com/doctor-services/services/dbhandler/mongo"
+	"github.com/doctor-services/services/dbhandler/transfer"
+	"github.com/doctor-services/services/helper/config"
+
+	kitlog "github.com/go-kit/kit/log"
+)
+
+const usage = `usage: dbtransfer export|import [flags]
+
+Run "dbtransfer export -h" or "dbtransfer import -h" for the flags.
+`
+
+// settings are loaded by config.Load from the flags following the command, the environment
+// and the -config file
+type settings struct {
+	MongoURI   string `config:"mongo.uri" env:"MONGO_URI" secret:"true" usage:"mongodb:// connection string, not needed by a dry run import"`
+	Collection string `config:"collection" required:"true" usage:"Collection exported or imported"`
+	Format     string `config:"format" default:"ndjson" usage:"File format, csv or ndjson"`
+	Columns    string `config:"columns" usage:"Columns like \"name,price:float,City=address.city\", CSV exports every field of the first item when empty"`
+	File       string `config:"file" usage:"File written by export or read by import, stdout or stdin when empty"`
+	BatchSize  int    `config:"batch-size" default:"500" usage:"Items read or written per round trip"`
+
+	Filter string `config:"export.filter" usage:"Mongo style JSON filter of the exported items, like {\"status\":\"active\"}"`
+	Sort   string `config:"export.sort" usage:"Sort of the exported items, like \"category,-price\""`
+
+	Mode      string `config:"import.mode" default:"insert" usage:"insert fails the items whose _id exists, upsert replaces them"`
+	DryRun    bool   `config:"import.dry-run" usage:"Read and check the items without writing them"`
+	MaxErrors int    `config:"import.max-errors" usage:"Stop the import after that many failed rows, never when zero"`
+	Report    string `config:"import.report" usage:"File the JSON import report is written to, the failed rows are logged when empty"`
+}
+
+func main() {
+	var logger kitlog.Logger
+	logger = kitlog.NewLogfmtLogger(kitlog.NewSyncWriter(os.Stderr))
+	logger = kitlog.With(logger, "ts", kitlog.DefaultTimestamp)
+	if len(os.Args) < 2 || (os.Args[1] != "export" && os.Args[1] != "import") {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	command := os.Args[1]
+	var cfg settings
+	values, err := config.Load(&cfg, config.Options{
+		Name:      "dbtransfer " + command,
+		Args:      os.Args[2:],
+		EnvPrefix: "DBTRANSFER_",
+	})
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		logger.Log("terminated", err)
+		os.Exit(2)
+	}
+	values.Log(logger)
+	format, err := transfer.ParseFormat(cfg.Format)
+	if err != nil {
+		logger.Log("terminated", err)
+		os.Exit(2)
+	}
+	columns, err := transfer.ParseColumns(cfg.Columns)
+	if err != nil {
+		logger.Log("terminated", err)
+		os.Exit(2)
+	}
+	var db dbhandler.DatabaseHandler
+	if command == "export" || !cfg.DryRun {
+		if cfg.MongoURI == "" {
+			logger.Log("terminated", "mongo.uri is required")
+			os.Exit(2)
+		}
+		if db, err = mongo.NewMongoHandlerFromURI(cfg.MongoURI); err != nil {
+			logger.Log("terminated", err)
+			os.Exit(2)
+		}
+	}
+	// Stop between two items on SIGINT or SIGTERM
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		logger.Log("signal", sig)
+		cancel()
+	}()
+
+	code := 0
+	if command == "export" {
+		err = export(ctx, logger, db, cfg, format, columns)
+	} else {
+		code, err = importFile(ctx, logger, db, cfg, format, columns)
+	}
+	cancel()
+	if err != nil {
+		logger.Log("terminated", err)
+		code = 1
+	}
+	if db != nil {
+		db.CloseConnection()
+	}
+	os.Exit(code)
+}
+
+// export writes the collection to the file or stdout. The file is written under a temporary
+// name and renamed once the export succeeded, so a failed export leaves the previous file.
+func export(ctx context.Context, logger kitlog.Logger, db dbhandler.DatabaseHandler, cfg settings,
+	format transfer.Format, columns []transfer.Column) error {
+	opts := transfer.ExportOptions{Format: format, Columns: columns}
+	opts.BatchSize = cfg.BatchSize
+	if cfg.Filter != "" {
+		if err := json.Unmarshal([]byte(cfg.Filter), &opts.Filters); err != nil {
+			return fmt.Errorf("export.filter: %s", err)
+		}
+	}
+	if cfg.Sort != "" {
+		sort, err := dbhandler.ParseSort(cfg.Sort)
+		if err != nil {
+			return fmt.Errorf("export.sort: %s", err)
+		}
+		opts.Sort = sort
+	}
+	out := os.Stdout
+	if cfg.File != "" {
+		file, err := ioutil.TempFile(filepath.Dir(cfg.File), "."+filepath.Base(cfg.File)+".")
+		if err != nil {
+			return err
+		}
+		out = file
+	}
+	count, err := transfer.Export(ctx, db, cfg.Collection, out, opts)
+	logger.Log("exported", count, "collection", cfg.Collection)
+	if out != os.Stdout {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			// TempFile creates the file readable by the owner only
+			err = os.Chmod(out.Name(), 0644)
+		}
+		if err == nil {
+			err = os.Rename(out.Name(), cfg.File)
+		}
+		if err != nil {
+			os.Remove(out.Name())
+		}
+	}
+	return err
+}
+
+// importFile reads the file or stdin into the collection, the exit code is 1 when rows failed
+func importFile(ctx context.Context, logger kitlog.Logger, db dbhandler.DatabaseHandler, cfg settings,
+	format transfer.Format, columns []transfer.Column) (int, error) {
+	var in io.Reader = os.Stdin
+	if cfg.File != "" {
+		file, err := os.Open(cfg.File)
+		if err != nil {
+			return 0, err
+		}
+		defer file.Close()
+		in = file
+	}
+	report, err := transfer.Import(ctx, db, cfg.Collection, in, transfer.ImportOptions{
+		Format:    format,
+		Columns:   columns,
+		Mode:      transfer.Mode(cfg.Mode),
+		BatchSize: cfg.BatchSize,
+		DryRun:    cfg.DryRun,
+		MaxErrors: cfg.MaxErrors,
+	})
+	logger.Log("read", report.Read, "written", report.Written, "failed", report.Failed, "dryRun", report.DryRun,
+		"collection", cfg.Collection)
+	if cfg.Report != "" {
+		if reportErr := writeReport(cfg.Report, report); reportErr != nil {
+			logger.Log("report", cfg.Report, "err", reportErr)
+		}
+	} else {
+		for _, rowError := range report.Errors {
+			logger.Log("row", rowError.Row, "id", rowError.ID, "err", rowError.Error)
+		}
+	}
+	if err != nil {
+		return 1, err
+	}
+	if report.Failed > 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// writeReport writes the import report as indented JSON
+func writeReport(path string, report transfer.Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,457 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Sources of a setting, from the lowest to the highest precedence
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+	// SourceUnset is the source of settings left empty
+	SourceUnset = "unset"
+)
+
+// Redacted replaces the value of secret settings in Values
+const Redacted = "[REDACTED]"
+
+// DefaultFileFlag is the flag giving the config file when Options leaves it unset
+const DefaultFileFlag = "config"
+
+// Options configures Load
+type Options struct {
+	// Name is the name of the program in flag usage, os.Args[0] when empty
+	Name string
+	// Args are the command line arguments, os.Args[1:] when nil
+	Args []string
+	// LookupEnv reads environment variables, os.LookupEnv when nil
+	LookupEnv func(key string) (string, bool)
+	// EnvPrefix is put before the variable names derived from setting names
+	EnvPrefix string
+	// File is the YAML or JSON file read when the file flag is not given, none when empty.
+	// Files ending in .json are read as JSON, any other as YAML.
+	File string
+	// FileFlag names the flag and, through the env rules, the variable giving the file.
+	// DefaultFileFlag when empty.
+	FileFlag string
+}
+
+// Value is the effective value of one setting
+type Value struct {
+	Name   string
+	Value  string
+	Source string
+	Secret bool
+}
+
+// Values lists the config file and the effective settings sorted by name, secrets are redacted
+type Values []Value
+
+// Log logs one line per setting
+func (v Values) Log(logger kitlog.Logger) {
+	for _, value := range v {
+		logger.Log("config", value.Name, "value", value.Value, "source", value.Source)
+	}
+}
+
+func (v Values) String() string {
+	lines := make([]string, len(v))
+	for index, value := range v {
+		lines[index] = fmt.Sprintf("%s=%q (%s)", value.Name, value.Value, value.Source)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// field is a setting of the loaded struct
+type field struct {
+	name     string
+	env      string
+	def      string
+	usage    string
+	required bool
+	secret   bool
+	value    reflect.Value
+	source   string
+}
+
+// flagValue records the value given on the command line, it is applied last
+type flagValue struct {
+	field *field
+	set   *string
+}
+
+func (f flagValue) String() string {
+	if f.set == nil {
+		return ""
+	}
+	return *f.set
+}
+
+func (f flagValue) Set(value string) error {
+	*f.set = value
+	return nil
+}
+
+// IsBoolFlag lets bool settings be given as -name
+func (f flagValue) IsBoolFlag() bool {
+	return f.field != nil && f.field.value.Kind() == reflect.Bool
+}
+
+// Load fills the struct pointed by dst from, in increasing precedence, the default
+// tags, the config file, the environment and the command line flags.
+//
+// Every exported field is a setting configured by its tags:
+//
+//	Port   int           `config:"http.port" default:"80" usage:"HTTP listen port"`
+//	APIKey string        `config:"api.key" env:"API_KEY" required:"true" secret:"true"`
+//	Hosts  []string      `config:"mongo.hosts"`
+//	Wait   time.Duration `config:"shutdown.timeout" default:"30s"`
+//
+// The name is the flag name and the file key, a dotted name also matches nested keys.
+// The variable name defaults to the upper cased name with dots and dashes
+// replaced by underscores after EnvPrefix. Struct fields are nested settings named
+// after their config tag. Supported types are strings, bools, ints, uints, floats,
+// time.Duration, url.URL and *url.URL and slices of strings, given comma separated.
+//
+// Load returns flag.ErrHelp when help was asked and an error listing every bad
+// or missing setting otherwise.
+func Load(dst interface{}, opts Options) (Values, error) {
+	target := reflect.ValueOf(dst)
+	if target.Kind() != reflect.Ptr || target.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("config: destination must be a pointer to a struct")
+	}
+	if opts.Name == "" {
+		opts.Name = filepath.Base(os.Args[0])
+	}
+	if opts.Args == nil {
+		opts.Args = os.Args[1:]
+	}
+	if opts.LookupEnv == nil {
+		opts.LookupEnv = os.LookupEnv
+	}
+	if opts.FileFlag == "" {
+		opts.FileFlag = DefaultFileFlag
+	}
+	fields, err := collect(target.Elem(), "", opts.EnvPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := flag.NewFlagSet(opts.Name, flag.ContinueOnError)
+	given := make(map[string]*string, len(fields))
+	file := opts.File
+	flags.StringVar(&file, opts.FileFlag, file, "YAML or JSON config file")
+	for _, f := range fields {
+		given[f.name] = new(string)
+		flags.Var(flagValue{field: f, set: given[f.name]}, f.name, f.usage)
+		flags.Lookup(f.name).DefValue = f.def
+	}
+	if err = flags.Parse(opts.Args); err != nil {
+		return nil, err
+	}
+	explicit := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	fileSource := SourceFlag
+	if !explicit[opts.FileFlag] {
+		fileSource = SourceDefault
+		if path, ok := opts.LookupEnv(envName(opts.EnvPrefix, opts.FileFlag)); ok && path != "" {
+			file, fileSource = path, SourceEnv
+		}
+	}
+	var fileValues map[string]interface{}
+	if file != "" {
+		if fileValues, err = readFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	var problems []string
+	for _, f := range fields {
+		raw, source := f.def, SourceDefault
+		if value, ok := lookupFile(fileValues, f.name); ok {
+			raw, source = value, SourceFile
+		}
+		if value, ok := opts.LookupEnv(f.env); ok && value != "" {
+			raw, source = value, SourceEnv
+		}
+		if explicit[f.name] {
+			raw, source = *given[f.name], SourceFlag
+		}
+		if raw == "" {
+			if f.required {
+				problems = append(problems, fmt.Sprintf("%s is required, set -%s or %s", f.name, f.name, f.env))
+			}
+			continue
+		}
+		if err = set(f.value, raw); err != nil {
+			problems = append(problems, fmt.Sprintf("%s from %s: %s", f.name, source, err))
+			continue
+		}
+		f.source = source
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("config: %s", strings.Join(problems, "; "))
+	}
+	list := values(fields)
+	if file != "" {
+		list = append(Values{{Name: opts.FileFlag, Value: file, Source: fileSource}}, list...)
+	}
+	return list, nil
+}
+
+// collect lists the settings of the struct v
+func collect(v reflect.Value, prefix string, envPrefix string) ([]*field, error) {
+	var fields []*field
+	t := v.Type()
+	for index := 0; index < t.NumField(); index++ {
+		sf := t.Field(index)
+		if sf.PkgPath != "" || sf.Tag.Get("config") == "-" {
+			continue
+		}
+		name := sf.Tag.Get("config")
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		value := v.Field(index)
+		if sf.Type.Kind() == reflect.Struct && sf.Type != urlType {
+			nested, err := collect(value, name, envPrefix)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, nested...)
+			continue
+		}
+		if !supported(sf.Type) {
+			return nil, fmt.Errorf("config: unsupported type %s of %s", sf.Type, name)
+		}
+		f := &field{
+			name:     name,
+			env:      sf.Tag.Get("env"),
+			def:      sf.Tag.Get("default"),
+			usage:    sf.Tag.Get("usage"),
+			required: sf.Tag.Get("required") == "true",
+			secret:   sf.Tag.Get("secret") == "true",
+			value:    value,
+		}
+		if f.env == "" {
+			f.env = envName(envPrefix, name)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// envName derives the variable name of a setting
+func envName(prefix string, name string) string {
+	return prefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(name))
+}
+
+// values lists the effective settings
+func values(fields []*field) Values {
+	list := make(Values, 0, len(fields))
+	for _, f := range fields {
+		value := Value{Name: f.name, Source: f.source, Secret: f.secret}
+		switch {
+		case f.source == "":
+			value.Source = SourceUnset
+		case f.secret:
+			value.Value = Redacted
+		default:
+			value.Value = format(f.value)
+		}
+		list = append(list, value)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	urlType      = reflect.TypeOf(url.URL{})
+)
+
+// supported tells whether set can parse settings of type t
+func supported(t reflect.Type) bool {
+	if t == durationType || t == urlType || t == reflect.PtrTo(urlType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// set parses raw into v
+func set(v reflect.Value, raw string) error {
+	switch v.Type() {
+	case durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	case urlType, reflect.PtrTo(urlType):
+		u, err := url.Parse(raw)
+		if err != nil {
+			return err
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("%q is not an absolute URL", raw)
+		}
+		if v.Kind() == reflect.Ptr {
+			v.Set(reflect.ValueOf(u))
+		} else {
+			v.Set(reflect.ValueOf(*u))
+		}
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		list := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for index, item := range items {
+			list.Index(index).SetString(item)
+		}
+		v.Set(list)
+	}
+	return nil
+}
+
+// format prints v the way set parses it
+func format(v reflect.Value) string {
+	switch value := v.Interface().(type) {
+	case time.Duration:
+		return value.String()
+	case url.URL:
+		return value.String()
+	case *url.URL:
+		if value == nil {
+			return ""
+		}
+		return value.String()
+	case []string:
+		return strings.Join(value, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// readFile reads a YAML or JSON config file
+func readFile(path string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: %s", err)
+	}
+	values := map[string]interface{}{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &values)
+	} else {
+		err = yaml.Unmarshal(data, &values)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config: bad file %s: %s", path, err)
+	}
+	return values, nil
+}
+
+// lookupFile finds the value of a setting in the file, by its full name first
+// and then through nested keys, and prints it the way set parses it
+func lookupFile(values map[string]interface{}, name string) (string, bool) {
+	if value, ok := values[name]; ok {
+		return fileString(value), true
+	}
+	parts := strings.SplitN(name, ".", 2)
+	if len(parts) < 2 {
+		return "", false
+	}
+	switch nested := values[parts[0]].(type) {
+	case map[string]interface{}:
+		return lookupFile(nested, parts[1])
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(nested))
+		for key, value := range nested {
+			converted[fmt.Sprint(key)] = value
+		}
+		return lookupFile(converted, parts[1])
+	}
+	return "", false
+}
+
+// fileString prints a file value, lists are joined with commas
+func fileString(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		items := make([]string, len(value))
+		for index, item := range value {
+			items[index] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	case float64:
+		// JSON numbers
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
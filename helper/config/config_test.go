@@ -0,0 +1,165 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+)
+
+type testSettings struct {
+	Port     int           `config:"http.port" default:"80" usage:"HTTP listen port"`
+	Debug    bool          `config:"debug"`
+	Timeout  time.Duration `config:"shutdown.timeout" default:"30s"`
+	Ratio    float64       `config:"ratio" default:"0.5"`
+	Hosts    []string      `config:"mongo.hosts" default:"localhost:27017"`
+	API      *url.URL      `config:"api.user"`
+	Password string        `config:"mongo.pass" env:"MONGO_PASS" secret:"true"`
+	Mail     mailSettings  `config:"mail"`
+}
+
+type mailSettings struct {
+	Host  string `config:"host" required:"true"`
+	Retry uint   `config:"retry" default:"3"`
+}
+
+func env(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := values[key]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("Create temp dir must not return error but got %v", err)
+	}
+	path := filepath.Join(dir, name)
+	if err = ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Write file must not return error but got %v", err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "service.yaml", `
+http:
+  port: 8000
+debug: true
+mongo:
+  hosts: [db1:27017, db2:27017]
+  pass: from-file
+mail.host: mail.local
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+	var settings testSettings
+	values, err := Load(&settings, Options{
+		Args:      []string{"-config", path, "-http.port", "9000", "-api.user", "http://users.local/users"},
+		LookupEnv: env(map[string]string{"APP_SHUTDOWN_TIMEOUT": "5s", "MONGO_PASS": "s3cret", "APP_DEBUG": ""}),
+		EnvPrefix: "APP_",
+	})
+	if err != nil {
+		t.Fatalf("Load must not return error but got %v", err)
+	}
+	expected := testSettings{
+		Port:     9000,
+		Debug:    true,
+		Timeout:  5 * time.Second,
+		Ratio:    0.5,
+		Hosts:    []string{"db1:27017", "db2:27017"},
+		API:      &url.URL{Scheme: "http", Host: "users.local", Path: "/users"},
+		Password: "s3cret",
+		Mail:     mailSettings{Host: "mail.local", Retry: 3},
+	}
+	if !reflect.DeepEqual(settings, expected) {
+		t.Fatalf("Expected %+v but got %+v", expected, settings)
+	}
+	sources := map[string]string{}
+	for _, value := range values {
+		sources[value.Name] = value.Source + " " + value.Value
+	}
+	want := map[string]string{
+		"config":           "flag " + path,
+		"http.port":        "flag 9000",
+		"debug":            "file true",
+		"shutdown.timeout": "env 5s",
+		"ratio":            "default 0.5",
+		"mongo.hosts":      "file db1:27017,db2:27017",
+		"api.user":         "flag http://users.local/users",
+		"mongo.pass":       "env " + Redacted,
+		"mail.host":        "file mail.local",
+		"mail.retry":       "default 3",
+	}
+	if !reflect.DeepEqual(sources, want) {
+		t.Fatalf("Expected values %v but got %v", want, sources)
+	}
+}
+
+func TestLoadJSONFileFromEnv(t *testing.T) {
+	path := writeFile(t, "service.json", `{"http": {"port": 8080}, "mail": {"host": "mail.local"}}`)
+	defer os.RemoveAll(filepath.Dir(path))
+	var settings testSettings
+	_, err := Load(&settings, Options{Args: []string{}, LookupEnv: env(map[string]string{"CONFIG": path})})
+	if err != nil {
+		t.Fatalf("Load must not return error but got %v", err)
+	}
+	if settings.Port != 8080 || settings.Mail.Host != "mail.local" {
+		t.Fatalf("Settings must be read from the JSON file but got %+v", settings)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	var settings testSettings
+	_, err := Load(&settings, Options{
+		Args:      []string{"-http.port", "eighty", "-api.user", "users"},
+		LookupEnv: env(nil),
+	})
+	if err == nil {
+		t.Fatalf("Load must return error")
+	}
+	for _, problem := range []string{"http.port from flag", "api.user from flag", "mail.host is required, set -mail.host or MAIL_HOST"} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("Error must mention %q but got %v", problem, err)
+		}
+	}
+	if _, err = Load(&settings, Options{Args: []string{"-h"}, LookupEnv: env(nil)}); err != flag.ErrHelp {
+		t.Errorf("Expected %v but got %v", flag.ErrHelp, err)
+	}
+	if _, err = Load(settings, Options{Args: []string{}}); err == nil {
+		t.Errorf("Load of a struct value must return error")
+	}
+	var unsupported struct {
+		Items map[string]string
+	}
+	if _, err = Load(&unsupported, Options{Args: []string{}}); err == nil {
+		t.Errorf("Load of an unsupported type must return error")
+	}
+}
+
+func TestValuesLog(t *testing.T) {
+	var settings testSettings
+	values, err := Load(&settings, Options{
+		Args:      []string{"-mail.host", "mail.local"},
+		LookupEnv: env(map[string]string{"MONGO_PASS": "s3cret"}),
+	})
+	if err != nil {
+		t.Fatalf("Load must not return error but got %v", err)
+	}
+	var buf bytes.Buffer
+	values.Log(kitlog.NewLogfmtLogger(&buf))
+	if strings.Contains(buf.String(), "s3cret") || strings.Contains(values.String(), "s3cret") {
+		t.Fatalf("Secrets must be redacted but got %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "config=api.user value= source=unset") {
+		t.Fatalf("Unset settings must be logged but got %s", buf.String())
+	}
+}
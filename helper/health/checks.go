@@ -0,0 +1,54 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Pinger is implemented by dbhandler.DatabaseHandler
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// DatabaseCheck tells whether the database answers a ping
+func DatabaseCheck(db Pinger) CheckFunc {
+	return db.Ping
+}
+
+// HTTPCheck tells whether a GET of url answers with a 2xx or 3xx status.
+// A nil client uses http.DefaultClient.
+func HTTPCheck(url string, client *http.Client) CheckFunc {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 399 {
+			return fmt.Errorf("%s answered %s", url, resp.Status)
+		}
+		return nil
+	}
+}
+
+// DiskCheck tells whether the file system holding path has at least minFree bytes available
+func DiskCheck(path string, minFree uint64) CheckFunc {
+	return func(ctx context.Context) error {
+		free, err := freeSpace(path)
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("%d bytes free on %s, %d needed", free, path, minFree)
+		}
+		return nil
+	}
+}
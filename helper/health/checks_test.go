@@ -0,0 +1,58 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/doctor-services/services/dbhandler/memory"
+)
+
+func TestDatabaseCheck(t *testing.T) {
+	check := DatabaseCheck(memory.NewMemoryHandler())
+	if err := check(context.Background()); err != nil {
+		t.Fatalf("Database check must not return error but got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := check(ctx); err != context.Canceled {
+		t.Fatalf("Expected %v but got %v", context.Canceled, err)
+	}
+}
+
+func TestHTTPCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{"up", server.URL + "/up", false},
+		{"bad status", server.URL + "/down", true},
+		{"unreachable", "http://127.0.0.1:1/", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := HTTPCheck(tt.url, nil)(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("HTTPCheck error must be %v but got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDiskCheck(t *testing.T) {
+	if err := DiskCheck(os.TempDir(), 1)(context.Background()); err != nil {
+		t.Fatalf("Disk check must not return error but got %v", err)
+	}
+	if err := DiskCheck(os.TempDir(), 1<<62)(context.Background()); err == nil {
+		t.Fatalf("Disk check must fail when not enough space is free")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd && !windows
+// +build !linux,!darwin,!freebsd,!windows
+
+package health
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// freeSpace is not supported on this system
+func freeSpace(path string) (uint64, error) {
+	return 0, fmt.Errorf("disk check is not supported on %s", runtime.GOOS)
+}
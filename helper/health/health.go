@@ -0,0 +1,214 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Paths the probes are served on by Register
+const (
+	LivePath  = "/healthz"
+	ReadyPath = "/readyz"
+)
+
+// Defaults used when Options leaves them unset
+const (
+	DefaultTimeout  = 2 * time.Second
+	DefaultCacheTTL = 5 * time.Second
+)
+
+// ShutdownCheck is the check failing the readiness probe after Shutdown
+const ShutdownCheck = "shutdown"
+
+// Check status values
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// CheckFunc tells whether a dependency works, it must give up once ctx is done
+type CheckFunc func(ctx context.Context) error
+
+// Options configures a Health
+type Options struct {
+	// Timeout bounds every run of a check, DefaultTimeout when zero
+	Timeout time.Duration
+	// CacheTTL is how long the result of a check is reused, DefaultCacheTTL when zero.
+	// A negative value runs the checks on every request.
+	CacheTTL time.Duration
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Latency   string    `json:"latency"`
+	LatencyMS float64   `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report is the body of the probe responses
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// check is a registered check with its cached result
+type check struct {
+	name string
+	fn   CheckFunc
+	// mu is held while the check runs, so concurrent probes share one run
+	mu      sync.Mutex
+	result  Result
+	expires time.Time
+}
+
+// Health runs the checks registered by a service and serves them as probes.
+// Liveness checks tell whether the process must be restarted, readiness checks
+// whether it can take traffic. Readiness also runs the liveness checks.
+type Health struct {
+	opts Options
+
+	mu           sync.RWMutex
+	live         []*check
+	ready        []*check
+	shuttingDown bool
+}
+
+// New creates a Health without checks, its probes answer ok until checks are added
+func New(opts Options) *Health {
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.CacheTTL == 0 {
+		opts.CacheTTL = DefaultCacheTTL
+	}
+	return &Health{opts: opts}
+}
+
+// AddLivenessCheck adds a check to both probes, keep it to failures a restart fixes
+func (h *Health) AddLivenessCheck(name string, fn CheckFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.live = append(h.live, &check{name: name, fn: fn})
+}
+
+// AddReadinessCheck adds a check to the readiness probe, like the reachability of the database
+func (h *Health) AddReadinessCheck(name string, fn CheckFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ready = append(h.ready, &check{name: name, fn: fn})
+}
+
+// Shutdown makes the readiness probe fail from now on, so no new traffic is sent
+// while the service drains its requests
+func (h *Health) Shutdown() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.shuttingDown = true
+}
+
+// Live runs the liveness checks
+func (h *Health) Live(ctx context.Context) Report {
+	h.mu.RLock()
+	checks := append([]*check(nil), h.live...)
+	h.mu.RUnlock()
+	return h.run(ctx, checks)
+}
+
+// Ready runs the liveness and readiness checks
+func (h *Health) Ready(ctx context.Context) Report {
+	h.mu.RLock()
+	checks := append(append([]*check(nil), h.live...), h.ready...)
+	shuttingDown := h.shuttingDown
+	h.mu.RUnlock()
+	report := h.run(ctx, checks)
+	if shuttingDown {
+		report.Status = StatusFail
+		report.Checks[ShutdownCheck] = Result{Status: StatusFail, Error: "shutting down", Latency: "0s", CheckedAt: time.Now()}
+	}
+	return report
+}
+
+// LiveHandler serves the liveness report, with status 503 when a check fails
+func (h *Health) LiveHandler() http.Handler {
+	return reportHandler(h.Live)
+}
+
+// ReadyHandler serves the readiness report, with status 503 when a check fails
+func (h *Health) ReadyHandler() http.Handler {
+	return reportHandler(h.Ready)
+}
+
+// Register serves the probes on LivePath and ReadyPath of mux
+func (h *Health) Register(mux *http.ServeMux) {
+	mux.Handle(LivePath, h.LiveHandler())
+	mux.Handle(ReadyPath, h.ReadyHandler())
+}
+
+// run runs the checks in parallel
+func (h *Health) run(ctx context.Context, checks []*check) Report {
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for index, c := range checks {
+		wg.Add(1)
+		go func(index int, c *check) {
+			defer wg.Done()
+			results[index] = c.run(ctx, h.opts)
+		}(index, c)
+	}
+	wg.Wait()
+	for index, c := range checks {
+		report.Checks[c.name] = results[index]
+		if results[index].Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+// run returns the cached result or runs the check
+func (c *check) run(ctx context.Context, opts Options) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Now().Before(c.expires) {
+		return c.result
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	started := time.Now()
+	err := c.fn(checkCtx)
+	latency := time.Since(started)
+	c.result = Result{
+		Status:    StatusOK,
+		Latency:   latency.String(),
+		LatencyMS: float64(latency) / float64(time.Millisecond),
+		CheckedAt: started,
+	}
+	if err != nil {
+		c.result.Status = StatusFail
+		c.result.Error = err.Error()
+	}
+	// A probe which gave up does not tell anything about the dependency
+	if opts.CacheTTL > 0 && ctx.Err() == nil {
+		c.expires = started.Add(opts.CacheTTL)
+	}
+	return c.result
+}
+
+// reportHandler serves the report made by run as JSON
+func reportHandler(run func(ctx context.Context) Report) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := run(r.Context())
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		if report.Status != StatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
@@ -0,0 +1,119 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProbes(t *testing.T) {
+	h := New(Options{})
+	h.AddLivenessCheck("process", func(ctx context.Context) error { return nil })
+	h.AddReadinessCheck("database", func(ctx context.Context) error { return errors.New("no reachable servers") })
+	mux := http.NewServeMux()
+	h.Register(mux)
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		checks []string
+	}{
+		{"liveness", LivePath, http.StatusOK, []string{"process"}},
+		{"readiness", ReadyPath, http.StatusServiceUnavailable, []string{"process", "database"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if recorder.Code != tt.status {
+				t.Fatalf("Probe must answer %d but got %d", tt.status, recorder.Code)
+			}
+			var report Report
+			if err := json.NewDecoder(recorder.Body).Decode(&report); err != nil {
+				t.Fatalf("Probe must answer JSON but got %v", err)
+			}
+			if len(report.Checks) != len(tt.checks) {
+				t.Fatalf("Expected checks %v but got %v", tt.checks, report.Checks)
+			}
+			for _, name := range tt.checks {
+				if _, ok := report.Checks[name]; !ok {
+					t.Fatalf("Expected check %s in %v", name, report.Checks)
+				}
+			}
+		})
+	}
+	report := h.Ready(context.Background())
+	if result := report.Checks["database"]; result.Status != StatusFail || result.Error != "no reachable servers" {
+		t.Fatalf("Failed check must report its error but got %+v", result)
+	}
+}
+
+func TestCachedResult(t *testing.T) {
+	var runs int32
+	h := New(Options{CacheTTL: time.Hour})
+	h.AddReadinessCheck("counted", func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	})
+	for i := 0; i < 3; i++ {
+		h.Ready(context.Background())
+	}
+	if runs != 1 {
+		t.Fatalf("Cached check must run once but ran %d times", runs)
+	}
+	uncached := New(Options{CacheTTL: -1})
+	uncached.AddReadinessCheck("counted", func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	})
+	uncached.Ready(context.Background())
+	uncached.Ready(context.Background())
+	if runs != 3 {
+		t.Fatalf("Uncached check must run on every probe but counted %d runs", runs)
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	h := New(Options{Timeout: time.Millisecond})
+	h.AddReadinessCheck("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	report := h.Ready(context.Background())
+	if report.Status != StatusFail || report.Checks["slow"].Error != context.DeadlineExceeded.Error() {
+		t.Fatalf("Slow check must fail with its timeout but got %+v", report)
+	}
+}
+
+func TestCancelledProbeNotCached(t *testing.T) {
+	var runs int32
+	h := New(Options{CacheTTL: time.Hour})
+	h.AddReadinessCheck("counted", func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return ctx.Err()
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h.Ready(ctx)
+	if report := h.Ready(context.Background()); report.Status != StatusOK || runs != 2 {
+		t.Fatalf("Result of a cancelled probe must not be cached but got %+v after %d runs", report, runs)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	h := New(Options{})
+	h.AddReadinessCheck("database", func(ctx context.Context) error { return nil })
+	h.Shutdown()
+	report := h.Ready(context.Background())
+	if report.Status != StatusFail || report.Checks[ShutdownCheck].Status != StatusFail {
+		t.Fatalf("Readiness must fail after shutdown but got %+v", report)
+	}
+	if report := h.Live(context.Background()); report.Status != StatusOK {
+		t.Fatalf("Liveness must not fail after shutdown but got %+v", report)
+	}
+}
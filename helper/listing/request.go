@@ -0,0 +1,340 @@
+package listing
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doctor-services/services/dbhandler"
+	mongoHelper "github.com/doctor-services/services/helper/mongo"
+	paingHelper "github.com/doctor-services/services/helper/paging"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Reserved query parameters, every other parameter is a filter
+const (
+	ParamPage   = "page"
+	ParamLimit  = "limit"
+	ParamSort   = "sort"
+	ParamCursor = "cursor"
+)
+
+// Default limits used when Options leaves them unset
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// FieldType tells how the values of a filter field are coerced
+type FieldType int
+
+// Supported field types
+const (
+	String FieldType = iota
+	Int
+	Float
+	Bool
+	// Time accepts RFC 3339 timestamps and plain dates like 2018-05-31
+	Time
+	ObjectID
+)
+
+// Options configures the parsing of list requests
+type Options struct {
+	// DefaultLimit is used when no limit is given, DefaultLimit const when zero
+	DefaultLimit int
+	// MaxLimit is the largest accepted limit, MaxLimit const when zero
+	MaxLimit int
+	// DefaultSort is used when no sort is given, like "-createdAt"
+	DefaultSort string
+	// SortFields lists the fields which can be sorted by. When empty, any filter field and _id can.
+	SortFields []string
+	// Fields lists the fields which can be filtered by and the type of their values
+	Fields map[string]FieldType
+}
+
+// Request is a validated list request
+type Request struct {
+	Limit  int
+	Page   int
+	Cursor string
+	Sort   []dbhandler.SortKey
+	Filter dbhandler.Filter
+}
+
+// FieldError describes one bad query parameter
+type FieldError struct {
+	Param   string `json:"param"`
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message"`
+}
+
+// Error is returned by Parse with every bad query parameter
+type Error struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *Error) Error() string {
+	messages := make([]string, len(e.Errors))
+	for index, fieldError := range e.Errors {
+		messages[index] = fieldError.Param + ": " + fieldError.Message
+	}
+	return "invalid list request: " + strings.Join(messages, "; ")
+}
+
+func (e *Error) add(param string, value string, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{Param: param, Value: value, Message: fmt.Sprintf(format, args...)})
+}
+
+// paramPattern splits a filter parameter like "age[gte]" into field and operator
+var paramPattern = regexp.MustCompile(`^([^\[\]]+)(?:\[([a-z]+)\])?$`)
+
+// Parse turns query parameters like ?page=2&limit=20&sort=-createdAt&status=active&age[gte]=30
+// into a list request. Filter parameters are "field=value" or "field[op]=value" with op one of
+// eq, ne, gt, gte, lt, lte, in, nin (comma separated values), prefix and exists.
+// Repeating "field=value" matches any of the values.
+// Every problem is reported in the returned *Error.
+func Parse(values url.Values, opts Options) (Request, error) {
+	defaultLimit, maxLimit := opts.DefaultLimit, opts.MaxLimit
+	if defaultLimit <= 0 {
+		defaultLimit = DefaultLimit
+	}
+	if maxLimit <= 0 {
+		maxLimit = MaxLimit
+	}
+	request := Request{Limit: defaultLimit, Page: 1}
+	invalid := &Error{}
+
+	if value, ok := single(values, ParamLimit, invalid); ok {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxLimit {
+			invalid.add(ParamLimit, value, "must be a number between 1 and %d", maxLimit)
+		} else {
+			request.Limit = limit
+		}
+	}
+	if value, ok := single(values, ParamPage, invalid); ok {
+		page, err := strconv.Atoi(value)
+		if err != nil || page < 1 {
+			invalid.add(ParamPage, value, "must be a number greater than 0")
+		} else {
+			request.Page = page
+		}
+	}
+	if value, ok := single(values, ParamCursor, invalid); ok {
+		if _, hasPage := values[ParamPage]; hasPage {
+			invalid.add(ParamCursor, value, "cannot be used together with page")
+		}
+		request.Cursor = value
+	}
+
+	// An empty sort, like "?sort=", sorts by the default as well
+	spec, ok := single(values, ParamSort, invalid)
+	if !ok || spec == "" {
+		spec = opts.DefaultSort
+	}
+	if keys, err := dbhandler.ParseSort(spec); err != nil {
+		invalid.add(ParamSort, spec, "%v", err)
+	} else {
+		for _, key := range keys {
+			if !opts.sortable(key.Field) {
+				invalid.add(ParamSort, spec, "cannot sort by %q", key.Field)
+			}
+		}
+		request.Sort = keys
+	}
+
+	var filters []dbhandler.Filter
+	for _, param := range sortedParams(values) {
+		switch param {
+		case ParamPage, ParamLimit, ParamSort, ParamCursor:
+			continue
+		}
+		filter, ok := opts.parseFilter(param, values[param], invalid)
+		if ok {
+			filters = append(filters, filter)
+		}
+	}
+	request.Filter = dbhandler.And(filters...)
+
+	if len(invalid.Errors) > 0 {
+		return Request{}, invalid
+	}
+	return request, nil
+}
+
+// OrderBy is the orderBy argument of GetAllItems, it only reflects the first sort key
+func (r Request) OrderBy() string {
+	if len(r.Sort) > 0 && r.Sort[0].Desc {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// SortBy is the sortBy argument of GetAllItems, it only reflects the first sort key
+func (r Request) SortBy() string {
+	if len(r.Sort) == 0 {
+		return ""
+	}
+	return r.Sort[0].Field
+}
+
+// Filters is the filters argument of GetAllItems
+func (r Request) Filters() map[string]interface{} {
+	return map[string]interface{}(mongoHelper.FilterQuery(r.Filter))
+}
+
+// ListOptions are the options of ListItems and ListItemsAfter
+func (r Request) ListOptions() dbhandler.ListOptions {
+	return dbhandler.ListOptions{Filter: r.Filter, Sort: r.Sort}
+}
+
+// Paginator creates the pagination information of the requested page
+func (r Request) Paginator(total int) paingHelper.Paginator {
+	return paingHelper.NewPaginator(total, r.Limit, r.Page)
+}
+
+func (opts Options) sortable(field string) bool {
+	if len(opts.SortFields) == 0 {
+		_, ok := opts.Fields[field]
+		return ok || field == "_id"
+	}
+	for _, allowed := range opts.SortFields {
+		if allowed == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (opts Options) parseFilter(param string, values []string, invalid *Error) (dbhandler.Filter, bool) {
+	match := paramPattern.FindStringSubmatch(param)
+	if match == nil {
+		invalid.add(param, "", "is not a valid parameter")
+		return dbhandler.Filter{}, false
+	}
+	field, op := match[1], match[2]
+	fieldType, ok := opts.Fields[field]
+	if !ok {
+		invalid.add(param, "", "cannot filter by %q", field)
+		return dbhandler.Filter{}, false
+	}
+	if op == "" {
+		op = string(dbhandler.OpEq)
+		if len(values) > 1 {
+			op = string(dbhandler.OpIn)
+		}
+	} else if len(values) > 1 {
+		invalid.add(param, "", "must be given once")
+		return dbhandler.Filter{}, false
+	}
+
+	switch dbhandler.Operator(op) {
+	case dbhandler.OpIn, dbhandler.OpNin:
+		if len(values) == 1 {
+			values = strings.Split(values[0], ",")
+		}
+		converted := make([]interface{}, len(values))
+		for index, value := range values {
+			if converted[index], ok = coerce(fieldType, value); !ok {
+				invalid.add(param, value, "must be %s", fieldType)
+				return dbhandler.Filter{}, false
+			}
+		}
+		if dbhandler.Operator(op) == dbhandler.OpNin {
+			return dbhandler.NotIn(field, converted...), true
+		}
+		return dbhandler.In(field, converted...), true
+	case dbhandler.OpExists:
+		exists, err := strconv.ParseBool(values[0])
+		if err != nil {
+			invalid.add(param, values[0], "must be true or false")
+			return dbhandler.Filter{}, false
+		}
+		return dbhandler.Exists(field, exists), true
+	case "prefix":
+		if fieldType != String {
+			invalid.add(param, values[0], "prefix only applies to text fields")
+			return dbhandler.Filter{}, false
+		}
+		return dbhandler.Prefix(field, values[0]), true
+	case dbhandler.OpEq, dbhandler.OpNe, dbhandler.OpGt, dbhandler.OpGte, dbhandler.OpLt, dbhandler.OpLte:
+		value, ok := coerce(fieldType, values[0])
+		if !ok {
+			invalid.add(param, values[0], "must be %s", fieldType)
+			return dbhandler.Filter{}, false
+		}
+		return dbhandler.Filter{Op: dbhandler.Operator(op), Field: field, Value: value}, true
+	}
+	invalid.add(param, "", "unknown operator %q", op)
+	return dbhandler.Filter{}, false
+}
+
+func (t FieldType) String() string {
+	switch t {
+	case Int:
+		return "an integer"
+	case Float:
+		return "a number"
+	case Bool:
+		return "true or false"
+	case Time:
+		return "a date or RFC 3339 time"
+	case ObjectID:
+		return "an id"
+	}
+	return "a text"
+}
+
+func coerce(fieldType FieldType, value string) (interface{}, bool) {
+	switch fieldType {
+	case Int:
+		number, err := strconv.ParseInt(value, 10, 64)
+		return number, err == nil
+	case Float:
+		number, err := strconv.ParseFloat(value, 64)
+		return number, err == nil
+	case Bool:
+		flag, err := strconv.ParseBool(value)
+		return flag, err == nil
+	case Time:
+		if date, err := time.Parse("2006-01-02", value); err == nil {
+			return date, true
+		}
+		timestamp, err := time.Parse(time.RFC3339, value)
+		return timestamp, err == nil
+	case ObjectID:
+		if !bson.IsObjectIdHex(value) {
+			return nil, false
+		}
+		return bson.ObjectIdHex(value), true
+	}
+	return value, true
+}
+
+// single returns the value of a parameter which must be given at most once
+func single(values url.Values, param string, invalid *Error) (string, bool) {
+	given, ok := values[param]
+	if !ok || len(given) == 0 {
+		return "", false
+	}
+	if len(given) > 1 {
+		invalid.add(param, "", "must be given once")
+		return "", false
+	}
+	return given[0], true
+}
+
+func sortedParams(values url.Values) []string {
+	params := make([]string, 0, len(values))
+	for param := range values {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+	return params
+}
@@ -0,0 +1,154 @@
+package listing
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/doctor-services/services/dbhandler"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+var doctorOptions = Options{
+	MaxLimit:    50,
+	DefaultSort: "-createdAt",
+	Fields: map[string]FieldType{
+		"status":    String,
+		"name":      String,
+		"age":       Int,
+		"rating":    Float,
+		"verified":  Bool,
+		"createdAt": Time,
+		"clinicId":  ObjectID,
+	},
+}
+
+func TestParse(t *testing.T) {
+	values, _ := url.ParseQuery("page=2&limit=30&sort=name,-age&status=active&age[gte]=30&age[lt]=60&verified=true&createdAt[gte]=2018-05-01")
+	request, err := Parse(values, doctorOptions)
+	if err != nil {
+		t.Fatalf("Parse must not return error but got %v", err)
+	}
+	expected := Request{
+		Limit: 30,
+		Page:  2,
+		Sort:  []dbhandler.SortKey{{Field: "name"}, {Field: "age", Desc: true}},
+		Filter: dbhandler.And(
+			dbhandler.Gte("age", int64(30)),
+			dbhandler.Lt("age", int64(60)),
+			dbhandler.Gte("createdAt", time.Date(2018, 5, 1, 0, 0, 0, 0, time.UTC)),
+			dbhandler.Eq("status", "active"),
+			dbhandler.Eq("verified", true),
+		),
+	}
+	if !reflect.DeepEqual(request, expected) {
+		t.Fatalf("Expected %+v but got %+v", expected, request)
+	}
+	if request.OrderBy() != "ASC" || request.SortBy() != "name" {
+		t.Errorf("Expected ASC name but got %s %s", request.OrderBy(), request.SortBy())
+	}
+	if _, err := dbhandler.ParseFilterMap(request.Filters()); err != nil {
+		t.Errorf("Filters must be accepted by GetAllItems but got %v", err)
+	}
+	if paginator := request.Paginator(65); paginator.TotalPage != 3 || paginator.NextPage != 3 || paginator.PreviousPage != 1 {
+		t.Errorf("Unexpected paginator %+v", paginator)
+	}
+}
+
+func TestParseDefaults(t *testing.T) {
+	request, err := Parse(url.Values{}, doctorOptions)
+	if err != nil {
+		t.Fatalf("Parse must not return error but got %v", err)
+	}
+	expected := Request{Limit: DefaultLimit, Page: 1, Sort: []dbhandler.SortKey{{Field: "createdAt", Desc: true}}}
+	if !reflect.DeepEqual(request, expected) {
+		t.Fatalf("Expected %+v but got %+v", expected, request)
+	}
+	if request.OrderBy() != "DESC" || request.SortBy() != "createdAt" || len(request.Filters()) != 0 {
+		t.Errorf("Unexpected GetAllItems arguments %s %s %v", request.OrderBy(), request.SortBy(), request.Filters())
+	}
+	request, err = Parse(url.Values{"sort": {""}}, doctorOptions)
+	if err != nil || !reflect.DeepEqual(request, expected) {
+		t.Fatalf("Empty sort must use the default sort, expected %+v but got %+v, %v", expected, request, err)
+	}
+}
+
+func TestParseFilterOperators(t *testing.T) {
+	id := bson.NewObjectId()
+	tests := []struct {
+		query string
+		want  dbhandler.Filter
+	}{
+		{"status=active&status=pending", dbhandler.In("status", "active", "pending")},
+		{"status[in]=active,pending", dbhandler.In("status", "active", "pending")},
+		{"age[nin]=1,2", dbhandler.NotIn("age", int64(1), int64(2))},
+		{"rating[ne]=4.5", dbhandler.Ne("rating", 4.5)},
+		{"name[prefix]=Ng", dbhandler.Prefix("name", "Ng")},
+		{"clinicId[exists]=false", dbhandler.Exists("clinicId", false)},
+		{"clinicId=" + id.Hex(), dbhandler.Eq("clinicId", id)},
+		{"createdAt[lt]=2018-05-01T10:00:00Z", dbhandler.Lt("createdAt", time.Date(2018, 5, 1, 10, 0, 0, 0, time.UTC))},
+	}
+	for _, tt := range tests {
+		values, _ := url.ParseQuery(tt.query)
+		request, err := Parse(values, doctorOptions)
+		if err != nil {
+			t.Errorf("Parse %q must not return error but got %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(request.Filter, tt.want) {
+			t.Errorf("Parse %q: expected %+v but got %+v", tt.query, tt.want, request.Filter)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query  string
+		params []string
+	}{
+		{"limit=0", []string{"limit"}},
+		{"limit=51", []string{"limit"}},
+		{"page=first&limit=x", []string{"limit", "page"}},
+		{"page=2&cursor=abc", []string{"cursor"}},
+		{"sort=password", []string{"sort"}},
+		{"sort=$where", []string{"sort"}},
+		{"sort=a&sort=b", []string{"sort"}},
+		{"password=secret", []string{"password"}},
+		{"age=thirty", []string{"age"}},
+		{"age[where]=1", []string{"age[where]"}},
+		{"age[gte]=1&age[gte]=2", []string{"age[gte]"}},
+		{"age[prefix]=1", []string{"age[prefix]"}},
+		{"clinicId=1234", []string{"clinicId"}},
+		{"verified[exists]=maybe&status[in]=a", []string{"verified[exists]"}},
+		{"a[b]c=1", []string{"a[b]c"}},
+	}
+	for _, tt := range tests {
+		values, _ := url.ParseQuery(tt.query)
+		_, err := Parse(values, doctorOptions)
+		invalid, ok := err.(*Error)
+		if !ok {
+			t.Errorf("Parse %q must return *Error but got %v", tt.query, err)
+			continue
+		}
+		var params []string
+		for _, fieldError := range invalid.Errors {
+			params = append(params, fieldError.Param)
+		}
+		if !reflect.DeepEqual(params, tt.params) {
+			t.Errorf("Parse %q: expected errors for %v but got %v", tt.query, tt.params, invalid.Errors)
+		}
+	}
+}
+
+func TestParseSortFields(t *testing.T) {
+	opts := doctorOptions
+	opts.SortFields = []string{"name"}
+	if _, err := Parse(url.Values{"sort": {"-name"}}, opts); err != nil {
+		t.Errorf("Sort by allowed field must not return error but got %v", err)
+	}
+	if _, err := Parse(url.Values{"sort": {"age"}}, opts); err == nil {
+		t.Errorf("Sort by field not in SortFields must return error")
+	}
+}
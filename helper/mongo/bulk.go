@@ -0,0 +1,19 @@
+package mongo
+
+import "gopkg.in/mgo.v2/bson"
+
+// NewItemDoc copies an item to insert and makes sure its _id is an object id,
+// a new one is created when the item has no _id
+func NewItemDoc(item map[string]interface{}) (map[string]interface{}, bson.ObjectId, error) {
+	// Make sure not modify original map
+	doc := CloneStringMap(item)
+	if providedID, ok := doc["_id"]; !ok || providedID == nil || providedID == "" {
+		doc["_id"] = bson.NewObjectId()
+	}
+	objectID, err := CreateObjectID(doc["_id"])
+	if err != nil {
+		return doc, objectID, err
+	}
+	doc["_id"] = objectID
+	return doc, objectID, nil
+}
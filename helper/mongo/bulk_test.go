@@ -0,0 +1,25 @@
+package mongo
+
+import (
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestNewItemDoc(t *testing.T) {
+	item := map[string]interface{}{"name": "Anna"}
+	doc, objectID, err := NewItemDoc(item)
+	if err != nil || !objectID.Valid() || doc["_id"] != objectID {
+		t.Fatalf("NewItemDoc must create an id but got %v, %v, %v", doc, objectID, err)
+	}
+	if _, ok := item["_id"]; ok {
+		t.Errorf("NewItemDoc must not modify the item")
+	}
+	hexID := bson.NewObjectId().Hex()
+	if doc, objectID, err = NewItemDoc(map[string]interface{}{"_id": hexID}); err != nil || objectID.Hex() != hexID || doc["_id"] != objectID {
+		t.Errorf("NewItemDoc must convert a hex id but got %v, %v", doc, err)
+	}
+	if _, _, err = NewItemDoc(map[string]interface{}{"_id": "fdsafas"}); err == nil {
+		t.Errorf("NewItemDoc must reject a malformed id")
+	}
+}
@@ -0,0 +1,156 @@
+package mongo
+
+import (
+	"encoding/base64"
+	"strings"
+
+	"github.com/doctor-services/services/dbhandler"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// LookupField gets the value of a dotted path in a document
+func LookupField(doc map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = doc
+	for _, segment := range strings.Split(path, ".") {
+		var (
+			value interface{}
+			ok    bool
+		)
+		switch sub := current.(type) {
+		case bson.M:
+			value, ok = sub[segment]
+		case map[string]interface{}:
+			value, ok = sub[segment]
+		}
+		if !ok {
+			return nil, false
+		}
+		current = value
+	}
+	return current, true
+}
+
+// EncodeCursor creates the opaque token handed to clients
+func EncodeCursor(cursor dbhandler.Cursor) string {
+	data, err := bson.Marshal(cursor)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor decodes a token created by EncodeCursor and makes sure it was
+// created for the same sort, see dbhandler.Cursor.Check. An empty token is the
+// start of the listing.
+func ParseCursor(token string, sort []dbhandler.SortKey) (dbhandler.Cursor, error) {
+	normalized, err := dbhandler.NormalizeSort(sort)
+	if err != nil {
+		return dbhandler.Cursor{}, err
+	}
+	cursor := dbhandler.Cursor{Sort: normalized}
+	if token == "" {
+		return cursor, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor, dbhandler.ErrInvalidCursor
+	}
+	var decoded dbhandler.Cursor
+	if err = bson.Unmarshal(data, &decoded); err != nil {
+		return cursor, dbhandler.ErrInvalidCursor
+	}
+	if err = decoded.Check(normalized); err != nil {
+		return cursor, err
+	}
+	return decoded, nil
+}
+
+// SortFields converts sort keys into mgo sort fields like "+name" or "-rating"
+func SortFields(keys []dbhandler.SortKey) []string {
+	fields := make([]string, len(keys))
+	for index, key := range keys {
+		fields[index] = key.String()
+	}
+	return fields
+}
+
+// CursorQuery creates the filter selecting the items after a cursor. An item
+// comes after the cursor when it equals the cursor on the first sort keys and
+// comes after it on the next one. Missing values sort lowest, like in mongo.
+func CursorQuery(cursor dbhandler.Cursor, filters map[string]interface{}) bson.M {
+	var position []interface{}
+	for index, key := range cursor.Sort {
+		if cursor.IsStart() {
+			break
+		}
+		clause := make([]interface{}, 0, index+1)
+		for previous, previousKey := range cursor.Sort[:index] {
+			clause = append(clause, bson.M{previousKey.Field: cursor.Values[previous]})
+		}
+		value := cursor.Values[index]
+		switch {
+		case value == nil && key.Desc:
+			// Nothing sorts after a missing value in a descending order
+			continue
+		case value == nil:
+			clause = append(clause, bson.M{key.Field: bson.M{"$ne": nil}})
+		case key.Desc:
+			clause = append(clause, bson.M{"$or": []interface{}{
+				bson.M{key.Field: bson.M{"$lt": value}},
+				bson.M{key.Field: nil},
+			}})
+		default:
+			clause = append(clause, bson.M{key.Field: bson.M{"$gt": value}})
+		}
+		position = append(position, bson.M{"$and": clause})
+	}
+	if position == nil {
+		query := bson.M{}
+		for key, value := range filters {
+			query[key] = value
+		}
+		return query
+	}
+	if len(filters) == 0 {
+		return bson.M{"$or": position}
+	}
+	return bson.M{"$and": []interface{}{filters, bson.M{"$or": position}}}
+}
+
+// NextCursor creates the cursor pointing at an item read with the given cursor
+func NextCursor(cursor dbhandler.Cursor, doc bson.M) dbhandler.Cursor {
+	next := dbhandler.Cursor{Sort: cursor.Sort, Values: make([]interface{}, len(cursor.Sort))}
+	for index, key := range cursor.Sort {
+		next.Values[index], _ = LookupField(doc, key.Field)
+	}
+	return next
+}
+
+// CursorProjection returns the projection to read items with, it keeps the sort
+// fields which are needed to create the next cursor
+func CursorProjection(cursor dbhandler.Cursor, projection dbhandler.Projection) dbhandler.Projection {
+	fields := make([]string, len(cursor.Sort))
+	for index, key := range cursor.Sort {
+		fields[index] = key.Field
+	}
+	return projection.WithFields(fields...)
+}
+
+// NewCursorResults creates the results from the items read with CursorQuery
+// and CursorProjection. Items must be read with a limit of one more than the
+// page size, the extra item only tells whether there is a next page.
+func NewCursorResults(cursor dbhandler.Cursor, docs []bson.M, limit int, projection dbhandler.Projection) dbhandler.CursorResults {
+	results := dbhandler.CursorResults{}
+	if len(docs) > limit {
+		docs = docs[:limit]
+		results.HasNextPage = true
+		results.NextCursor = EncodeCursor(NextCursor(cursor, docs[limit-1]))
+	}
+	results.PageSize = len(docs)
+	results.Items = make([]map[string]interface{}, len(docs))
+	for index, doc := range docs {
+		results.Items[index] = CreateMapFromBsonM(Project(doc, projection))
+	}
+	return results
+}
@@ -0,0 +1,72 @@
+package mongo
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/doctor-services/services/dbhandler"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestParseCursor(t *testing.T) {
+	start, err := ParseCursor("", []dbhandler.SortKey{{Field: "_id", Desc: true}})
+	if err != nil {
+		t.Fatalf("Empty cursor must not return error but got %v", err)
+	}
+	expected := dbhandler.Cursor{Sort: []dbhandler.SortKey{{Field: "_id", Desc: true}}}
+	if !reflect.DeepEqual(start, expected) || !start.IsStart() {
+		t.Fatalf("Expected %v but got %v", expected, start)
+	}
+
+	createdAt := time.Date(2018, 7, 5, 11, 36, 4, 0, time.UTC)
+	id := bson.NewObjectId()
+	sort := []dbhandler.SortKey{{Field: "createdAt"}}
+	cursor := dbhandler.Cursor{Sort: []dbhandler.SortKey{{Field: "createdAt"}, {Field: "_id"}}, Values: []interface{}{createdAt, id}}
+	parsed, err := ParseCursor(EncodeCursor(cursor), sort)
+	if err != nil {
+		t.Fatalf("Encoded cursor must be parsed but got %v", err)
+	}
+	if parsed.Values[1] != id || !parsed.Values[0].(time.Time).Equal(createdAt) || parsed.IsStart() {
+		t.Fatalf("Expected %v but got %v", cursor, parsed)
+	}
+
+	if _, err = ParseCursor(EncodeCursor(cursor), []dbhandler.SortKey{{Field: "createdAt", Desc: true}}); err != dbhandler.ErrInvalidCursor {
+		t.Errorf("Cursor of another order must be rejected but got %v", err)
+	}
+	if _, err = ParseCursor(EncodeCursor(cursor), []dbhandler.SortKey{{Field: "name"}}); err != dbhandler.ErrInvalidCursor {
+		t.Errorf("Cursor of another field must be rejected but got %v", err)
+	}
+	if _, err = ParseCursor("!!!", sort); err != dbhandler.ErrInvalidCursor {
+		t.Errorf("Malformed cursor must be rejected but got %v", err)
+	}
+	if _, err = ParseCursor(EncodeCursor(expected), expected.Sort); err != dbhandler.ErrInvalidCursor {
+		t.Errorf("Start cursor must not be accepted as a token but got %v", err)
+	}
+	if _, err = ParseCursor("", []dbhandler.SortKey{{Field: "$where"}}); err == nil {
+		t.Errorf("Cursor of an invalid sort must be rejected")
+	}
+}
+
+func TestParseCursorRejectsTamperedValues(t *testing.T) {
+	sort := []dbhandler.SortKey{{Field: "name"}}
+	tests := []struct {
+		name  string
+		value interface{}
+	}{
+		{"operator document", bson.M{"$ne": nil}},
+		{"where document", bson.M{"$where": "sleep(1000)"}},
+		{"ordered document", bson.D{{Name: "$gt", Value: ""}}},
+		{"array", []interface{}{"a"}},
+		{"javascript", bson.JavaScript{Code: "true"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := dbhandler.Cursor{Sort: []dbhandler.SortKey{{Field: "name"}, {Field: "_id"}}, Values: []interface{}{tt.value, bson.NewObjectId()}}
+			if _, err := ParseCursor(EncodeCursor(tampered), sort); err != dbhandler.ErrInvalidCursor {
+				t.Fatalf("Cursor with a %s must be rejected but got %v", tt.name, err)
+			}
+		})
+	}
+}
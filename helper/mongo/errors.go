@@ -0,0 +1,72 @@
+package mongo
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/doctor-services/services/dbhandler"
+
+	"gopkg.in/mgo.v2"
+)
+
+// Mongo error codes with a dbhandler error kind
+const (
+	codeExceededTimeLimit     = 50
+	codeIndexOptionsConflict  = 85
+	codeIndexKeySpecsConflict = 86
+)
+
+// MapError maps mgo errors to the dbhandler error kinds, other errors are returned as they are
+func MapError(err error) error {
+	switch err.(type) {
+	case nil, *dbhandler.Error, *dbhandler.BulkError, *mgo.BulkError:
+		return err
+	}
+	switch {
+	case err == mgo.ErrNotFound:
+		return dbhandler.NewError(dbhandler.ErrNotFound, err)
+	case err == context.DeadlineExceeded:
+		return dbhandler.NewError(dbhandler.ErrTimeout, err)
+	case mgo.IsDup(err):
+		return dbhandler.NewError(dbhandler.ErrDuplicateKey, err)
+	}
+	switch code := errorCode(err); code {
+	case codeExceededTimeLimit:
+		return dbhandler.NewError(dbhandler.ErrTimeout, err)
+	case codeIndexOptionsConflict, codeIndexKeySpecsConflict:
+		return dbhandler.NewError(dbhandler.ErrConflict, err)
+	}
+	if netErr, ok := err.(net.Error); ok {
+		if netErr.Timeout() {
+			return dbhandler.NewError(dbhandler.ErrTimeout, err)
+		}
+		return dbhandler.NewError(dbhandler.ErrUnavailable, err)
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF || isConnectionMessage(err.Error()) {
+		return dbhandler.NewError(dbhandler.ErrUnavailable, err)
+	}
+	return err
+}
+
+func errorCode(err error) int {
+	switch e := err.(type) {
+	case *mgo.QueryError:
+		return e.Code
+	case *mgo.LastError:
+		return e.Code
+	}
+	return 0
+}
+
+// isConnectionMessage tells whether mgo reports a lost or missing connection,
+// mgo creates those errors with errors.New
+func isConnectionMessage(message string) bool {
+	for _, prefix := range []string{"no reachable servers", "Closed explicitly", "connection reset", "EOF"} {
+		if strings.HasPrefix(message, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/doctor-services/services/dbhandler"
+
+	"gopkg.in/mgo.v2"
+)
+
+func TestMapError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"not found", mgo.ErrNotFound, dbhandler.ErrNotFound},
+		{"duplicate", &mgo.LastError{Code: 11000, Err: "E11000 duplicate key error"}, dbhandler.ErrDuplicateKey},
+		{"index conflict", &mgo.QueryError{Code: 85, Message: "Index with name: a_1 already exists with different options"}, dbhandler.ErrConflict},
+		{"max time", &mgo.QueryError{Code: 50, Message: "operation exceeded time limit"}, dbhandler.ErrTimeout},
+		{"deadline", context.DeadlineExceeded, dbhandler.ErrTimeout},
+		{"unreachable", errors.New("no reachable servers"), dbhandler.ErrUnavailable},
+		{"closed", io.EOF, dbhandler.ErrUnavailable},
+		{"invalid id", dbhandler.NewError(dbhandler.ErrInvalidID, nil), dbhandler.ErrInvalidID},
+		{"cancelled", context.Canceled, nil},
+		{"other", &mgo.QueryError{Code: 2, Message: "bad value"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dbhandler.KindOf(MapError(tt.err)); got != tt.want {
+				t.Errorf("KindOf(MapError()) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if MapError(nil) != nil {
+		t.Errorf("MapError(nil) must be nil")
+	}
+	if err := MapError(context.Canceled); err != context.Canceled {
+		t.Errorf("MapError must return unknown errors as they are but got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package mongo
+
+import (
+	"github.com/doctor-services/services/dbhandler"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// FilterQuery translates a filter into a mongo query document.
+// The filter must be valid, see dbhandler.Filter.Validate.
+func FilterQuery(f dbhandler.Filter) bson.M {
+	switch f.Op {
+	case "":
+		return bson.M{}
+	case dbhandler.OpAnd, dbhandler.OpOr:
+		clauses := make([]interface{}, len(f.Filters))
+		for index, filter := range f.Filters {
+			clauses[index] = FilterQuery(filter)
+		}
+		return bson.M{"$" + string(f.Op): clauses}
+	}
+	return bson.M{f.Field: bson.M{"$" + string(f.Op): f.Value}}
+}
+
+// ListQuery creates the mongo query document of a listing, combining the
+// typed filter and the legacy filter map. Both are checked against the
+// allowed operators first.
+func ListQuery(opts dbhandler.ListOptions) (bson.M, error) {
+	if err := opts.Filter.Validate(); err != nil {
+		return nil, err
+	}
+	legacy, err := ParseFilterMap(opts.Filters)
+	if err != nil {
+		return nil, err
+	}
+	return FilterQuery(dbhandler.And(opts.Filter, legacy)), nil
+}
+
+// SelectorQuery checks a selector against the allowed operators. Selectors must
+// be nil, filter maps or bson.D documents, others like structs are rejected as
+// their encoding could hide operators.
+func SelectorQuery(selector interface{}) (interface{}, error) {
+	var filters map[string]interface{}
+	switch s := selector.(type) {
+	case nil:
+		return bson.M{}, nil
+	case bson.M:
+		filters = s
+	case map[string]interface{}:
+		filters = s
+	case bson.D:
+		filters = s.Map()
+	default:
+		return nil, dbhandler.Errorf(dbhandler.ErrInvalidFilter, "selector cannot be a %T", selector)
+	}
+	filter, err := ParseFilterMap(filters)
+	if err != nil {
+		return nil, err
+	}
+	return FilterQuery(filter), nil
+}
+
+// ParseFilterMap is dbhandler.ParseFilterMap accepting the mgo types: bson.RegEx
+// values are read as $regex conditions and bson.D documents as maps
+func ParseFilterMap(filters map[string]interface{}) (dbhandler.Filter, error) {
+	if filters == nil {
+		return dbhandler.ParseFilterMap(nil)
+	}
+	return dbhandler.ParseFilterMap(plainFilterValue(filters).(map[string]interface{}))
+}
+
+// plainFilterValue replaces the mgo types of a filter value by maps
+func plainFilterValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.RegEx:
+		return map[string]interface{}{"$regex": v.Pattern, "$options": v.Options}
+	case bson.D:
+		return plainFilterValue(v.Map())
+	case bson.M:
+		return plainFilterValue(map[string]interface{}(v))
+	case map[string]interface{}:
+		plain := make(map[string]interface{}, len(v))
+		for key, nested := range v {
+			plain[key] = plainFilterValue(nested)
+		}
+		return plain
+	case []interface{}:
+		plain := make([]interface{}, len(v))
+		for index, nested := range v {
+			plain[index] = plainFilterValue(nested)
+		}
+		return plain
+	}
+	return value
+}
@@ -0,0 +1,53 @@
+package mongo
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/doctor-services/services/dbhandler"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestParseFilterMap(t *testing.T) {
+	filters := map[string]interface{}{
+		"name":    bson.RegEx{Pattern: "^an", Options: "i"},
+		"address": bson.D{{Name: "city", Value: "Hanoi"}},
+		"$or":     []interface{}{bson.D{{Name: "rating", Value: bson.D{{Name: "$gte", Value: 4}}}}},
+	}
+	f, err := ParseFilterMap(filters)
+	if err != nil {
+		t.Fatalf("ParseFilterMap must not return error but got %v", err)
+	}
+	expected := dbhandler.And(
+		dbhandler.Filter{Op: dbhandler.OpOr, Filters: []dbhandler.Filter{dbhandler.Gte("rating", 4)}},
+		dbhandler.Eq("address", map[string]interface{}{"city": "Hanoi"}),
+		dbhandler.Regex("name", "(?i)^an"),
+	)
+	if !reflect.DeepEqual(f, expected) {
+		t.Fatalf("Expected %+v but got %+v", expected, f)
+	}
+	if _, err := ParseFilterMap(map[string]interface{}{"name": bson.D{{Name: "$where", Value: "true"}}}); err == nil {
+		t.Errorf("ParseFilterMap must reject operators in bson.D documents")
+	}
+}
+
+func TestSelectorQuery(t *testing.T) {
+	query, err := SelectorQuery(bson.D{{Name: "name", Value: "Anna"}})
+	if err != nil || !reflect.DeepEqual(query, bson.M{"name": bson.M{"$eq": "Anna"}}) {
+		t.Fatalf("bson.D selector must be translated but got %v, %v", query, err)
+	}
+	rejected := []interface{}{
+		bson.D{{Name: "$where", Value: "true"}},
+		bson.D{{Name: "name", Value: bson.M{"$where": "true"}}},
+		struct {
+			Where string `bson:"$where"`
+		}{"true"},
+		[]interface{}{},
+	}
+	for _, selector := range rejected {
+		if _, err := SelectorQuery(selector); dbhandler.KindOf(err) != dbhandler.ErrInvalidFilter {
+			t.Errorf("SelectorQuery must reject %#v but got %v", selector, err)
+		}
+	}
+}
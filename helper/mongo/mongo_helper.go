@@ -1,7 +1,7 @@
 package mongo
 
 import (
-	"errors"
+	"github.com/doctor-services/services/dbhandler"
 
 	"gopkg.in/mgo.v2/bson"
 )
@@ -46,19 +46,19 @@ func CreateObjectID(id interface{}) (bson.ObjectId, error) {
 		stringID, ok := id.(string)
 		if ok {
 			if !bson.IsObjectIdHex(stringID) {
-				return bson.ObjectId(""), errors.New("Wrong id format")
+				return bson.ObjectId(""), dbhandler.Errorf(dbhandler.ErrInvalidID, "Wrong id format")
 			}
 			return bson.ObjectIdHex(stringID), nil
 		}
 		bytesID, ok := id.([]byte)
 		if !ok {
-			return bson.ObjectId(""), errors.New("Unsuported input: only support string and []byte")
+			return bson.ObjectId(""), dbhandler.Errorf(dbhandler.ErrInvalidID, "Unsuported input: only support string and []byte")
 		}
 		// create a (may be invalid) object type of ObjectId
 		var result = bson.ObjectId(bytesID)
 		err := result.UnmarshalText(bytesID)
 		if err != nil {
-			return bson.ObjectId(""), errors.New("Wrong id format")
+			return bson.ObjectId(""), dbhandler.Errorf(dbhandler.ErrInvalidID, "Wrong id format")
 		}
 
 		return result, nil
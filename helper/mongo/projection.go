@@ -0,0 +1,114 @@
+package mongo
+
+import (
+	"strings"
+
+	"github.com/doctor-services/services/dbhandler"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ProjectionDoc converts a projection into an mgo select document, nil selects everything
+func ProjectionDoc(p dbhandler.Projection) bson.M {
+	if p.IsEmpty() {
+		return nil
+	}
+	doc := bson.M{}
+	for _, field := range p.Include {
+		doc[field] = 1
+	}
+	for _, field := range p.Exclude {
+		doc[field] = 0
+	}
+	return doc
+}
+
+// Project applies a projection to a document the way mongo does,
+// paths going through arrays apply to every element of the array
+func Project(doc bson.M, p dbhandler.Projection) bson.M {
+	if p.IsEmpty() {
+		return doc
+	}
+	var result bson.M
+	if len(p.Include) > 0 {
+		result = bson.M{}
+		if id, ok := doc["_id"]; ok {
+			result["_id"] = id
+		}
+		for _, field := range p.Include {
+			includePath(doc, result, strings.Split(field, "."))
+		}
+	} else {
+		result = CloneStringMap(doc)
+	}
+	for _, field := range p.Exclude {
+		result = excludePath(result, strings.Split(field, "."))
+	}
+	return result
+}
+
+func includePath(source bson.M, target bson.M, path []string) {
+	value, ok := source[path[0]]
+	if !ok {
+		return
+	}
+	if len(path) == 1 {
+		target[path[0]] = value
+		return
+	}
+	switch sub := value.(type) {
+	case bson.M:
+		nested, _ := target[path[0]].(bson.M)
+		if nested == nil {
+			nested = bson.M{}
+		}
+		includePath(sub, nested, path[1:])
+		target[path[0]] = nested
+	case []interface{}:
+		elements, _ := target[path[0]].([]interface{})
+		if elements == nil {
+			elements = make([]interface{}, 0, len(sub))
+			for _, element := range sub {
+				if _, ok := element.(bson.M); ok {
+					elements = append(elements, bson.M{})
+				}
+			}
+		}
+		position := 0
+		for _, element := range sub {
+			if subDoc, ok := element.(bson.M); ok {
+				includePath(subDoc, elements[position].(bson.M), path[1:])
+				position++
+			}
+		}
+		target[path[0]] = elements
+	}
+}
+
+// excludePath removes a path and returns the document, nested documents on the
+// path are copied so the source document is never changed
+func excludePath(doc bson.M, path []string) bson.M {
+	result := CloneStringMap(doc)
+	value, ok := result[path[0]]
+	if !ok {
+		return result
+	}
+	if len(path) == 1 {
+		delete(result, path[0])
+		return result
+	}
+	switch sub := value.(type) {
+	case bson.M:
+		result[path[0]] = excludePath(sub, path[1:])
+	case []interface{}:
+		elements := make([]interface{}, len(sub))
+		for index, element := range sub {
+			elements[index] = element
+			if subDoc, ok := element.(bson.M); ok {
+				elements[index] = excludePath(subDoc, path[1:])
+			}
+		}
+		result[path[0]] = elements
+	}
+	return result
+}
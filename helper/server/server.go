@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/doctor-services/services/helper/health"
+
+	kitlog "github.com/go-kit/kit/log"
+)
+
+// DefaultShutdownTimeout is how long in-flight requests are waited for when Config leaves it unset
+const DefaultShutdownTimeout = 30 * time.Second
+
+// Config configures a Runner
+type Config struct {
+	// Addr is the listen address, like ":80"
+	Addr    string
+	Handler http.Handler
+	// ShutdownTimeout bounds the draining of in-flight requests, DefaultShutdownTimeout when zero
+	ShutdownTimeout time.Duration
+	// DrainDelay is how long the readiness probe fails before the listener is closed,
+	// so load balancers stop sending requests first
+	DrainDelay time.Duration
+	// Health, when set, has its readiness probe failed once shutdown starts
+	Health *health.Health
+	// Logger defaults to a no-op logger
+	Logger kitlog.Logger
+	// Signals start the shutdown, SIGINT and SIGTERM when empty
+	Signals []os.Signal
+}
+
+// closer is a resource closed on shutdown
+type closer struct {
+	name  string
+	close func() error
+}
+
+// Runner serves HTTP until a signal arrives or its context is done, then shuts down gracefully:
+// readiness fails, the listener is closed, in-flight requests are drained and the
+// registered resources are closed in the order they were registered.
+type Runner struct {
+	config  Config
+	closers []closer
+}
+
+// New creates a Runner
+func New(config Config) *Runner {
+	if config.ShutdownTimeout == 0 {
+		config.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if config.Logger == nil {
+		config.Logger = kitlog.NewNopLogger()
+	}
+	if len(config.Signals) == 0 {
+		config.Signals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+	return &Runner{config: config}
+}
+
+// OnShutdown registers a resource, like a database handler, closed once the requests are drained
+func (r *Runner) OnShutdown(name string, close func() error) {
+	r.closers = append(r.closers, closer{name: name, close: close})
+}
+
+// Run listens on the configured address and serves until shutdown.
+// It returns the error which stopped the server early or the first shutdown error.
+func (r *Runner) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", r.config.Addr)
+	if err != nil {
+		return r.closeAll(err)
+	}
+	return r.serve(ctx, listener)
+}
+
+func (r *Runner) serve(ctx context.Context, listener net.Listener) error {
+	logger := r.config.Logger
+	server := &http.Server{Handler: r.config.Handler}
+	errs := make(chan error, 1)
+	go func() {
+		logger.Log("transport", "http", "address", listener.Addr().String(), "msg", "listening")
+		errs <- server.Serve(listener)
+	}()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, r.config.Signals...)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-errs:
+		// The server stopped by itself, there is nothing to drain
+		return r.closeAll(err)
+	case sig := <-signals:
+		logger.Log("msg", "shutting down", "signal", sig)
+	case <-ctx.Done():
+		logger.Log("msg", "shutting down", "reason", ctx.Err())
+	}
+	if r.config.Health != nil {
+		r.config.Health.Shutdown()
+	}
+	if r.config.DrainDelay > 0 {
+		time.Sleep(r.config.DrainDelay)
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), r.config.ShutdownTimeout)
+	defer cancel()
+	err := server.Shutdown(shutdownCtx)
+	if err != nil {
+		logger.Log("msg", "requests not drained", "err", err)
+		err = fmt.Errorf("drain requests: %s", err)
+	}
+	return r.closeAll(err)
+}
+
+// closeAll closes every resource in order and returns err or the first close error
+func (r *Runner) closeAll(err error) error {
+	for _, c := range r.closers {
+		if closeErr := c.close(); closeErr != nil {
+			r.config.Logger.Log("msg", "close failed", "resource", c.name, "err", closeErr)
+			if err == nil {
+				err = fmt.Errorf("close %s: %s", c.name, closeErr)
+			}
+		}
+	}
+	return err
+}
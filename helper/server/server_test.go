@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/doctor-services/services/helper/health"
+)
+
+func TestGracefulShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+	probes := health.New(health.Options{})
+	runner := New(Config{Handler: handler, Health: probes, ShutdownTimeout: time.Second})
+	var closed []string
+	runner.OnShutdown("database", func() error {
+		closed = append(closed, "database")
+		return nil
+	})
+	runner.OnShutdown("cache", func() error {
+		closed = append(closed, "cache")
+		return errors.New("already closed")
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen must not return error but got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- runner.serve(ctx, listener)
+	}()
+
+	bodies := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			bodies <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		bodies <- string(body)
+	}()
+	<-started
+	cancel()
+	// Wait for the shutdown to start before finishing the request
+	for probes.Ready(context.Background()).Status == health.StatusOK {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	if body := <-bodies; body != "done" {
+		t.Fatalf("In-flight request must complete but got %q", body)
+	}
+	err = <-done
+	if err == nil || err.Error() != "close cache: already closed" {
+		t.Fatalf("Run must return the close error but got %v", err)
+	}
+	if expected := []string{"database", "cache"}; !reflect.DeepEqual(closed, expected) {
+		t.Fatalf("Resources must be closed in order %v but got %v", expected, closed)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	runner := New(Config{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+		}),
+		ShutdownTimeout: 10 * time.Millisecond,
+	})
+	closed := false
+	runner.OnShutdown("database", func() error {
+		closed = true
+		return nil
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen must not return error but got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- runner.serve(ctx, listener)
+	}()
+	go http.Get("http://" + listener.Addr().String())
+	<-started
+	cancel()
+	if err = <-done; err == nil {
+		t.Fatalf("Run must fail when requests are not drained in time")
+	}
+	if !closed {
+		t.Fatalf("Resources must be closed even when requests are not drained")
+	}
+}
+
+func TestListenError(t *testing.T) {
+	runner := New(Config{Addr: "bad address"})
+	closed := false
+	runner.OnShutdown("database", func() error {
+		closed = true
+		return nil
+	})
+	if err := runner.Run(context.Background()); err == nil {
+		t.Fatalf("Run must fail when it cannot listen")
+	}
+	if !closed {
+		t.Fatalf("Resources must be closed when the server cannot start")
+	}
+}
@@ -0,0 +1,100 @@
+package catalog
+
+import (
+	"context"
+
+	"github.com/doctor-services/services/helper/listing"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// Endpoints are the go-kit endpoints of a Service
+type Endpoints struct {
+	Create endpoint.Endpoint
+	Get    endpoint.Endpoint
+	Update endpoint.Endpoint
+	Delete endpoint.Endpoint
+	List   endpoint.Endpoint
+}
+
+// MakeEndpoints creates the endpoints of s
+func MakeEndpoints(s Service) Endpoints {
+	return Endpoints{
+		Create: makeCreateEndpoint(s),
+		Get:    makeGetEndpoint(s),
+		Update: makeUpdateEndpoint(s),
+		Delete: makeDeleteEndpoint(s),
+		List:   makeListEndpoint(s),
+	}
+}
+
+type createRequest struct {
+	Product Product
+}
+
+type getRequest struct {
+	ID string
+}
+
+type updateRequest struct {
+	ID      string
+	Product Product
+}
+
+type deleteRequest struct {
+	ID string
+}
+
+type listRequest struct {
+	Request listing.Request
+}
+
+// createdResponse is encoded with status 201
+type createdResponse struct {
+	Product Product
+}
+
+// emptyResponse is encoded with status 204
+type emptyResponse struct{}
+
+func makeCreateEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(createRequest)
+		p, err := s.CreateProduct(ctx, req.Product)
+		if err != nil {
+			return nil, err
+		}
+		return createdResponse{Product: p}, nil
+	}
+}
+
+func makeGetEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getRequest)
+		return s.GetProduct(ctx, req.ID)
+	}
+}
+
+func makeUpdateEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(updateRequest)
+		return s.UpdateProduct(ctx, req.ID, req.Product)
+	}
+}
+
+func makeDeleteEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(deleteRequest)
+		if err := s.DeleteProduct(ctx, req.ID); err != nil {
+			return nil, err
+		}
+		return emptyResponse{}, nil
+	}
+}
+
+func makeListEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listRequest)
+		return s.ListProducts(ctx, req.Request)
+	}
+}
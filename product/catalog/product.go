@@ -0,0 +1,146 @@
+package catalog
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Status tells whether a product is sold
+type Status string
+
+// Product statuses, new products are drafts unless told otherwise
+const (
+	StatusDraft    Status = "draft"
+	StatusActive   Status = "active"
+	StatusArchived Status = "archived"
+)
+
+// Limits checked by Validate
+const (
+	MaxNameLength = 200
+	MaxImages     = 20
+)
+
+// skuPattern allows letters, digits, dashes and underscores
+var skuPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+// Product is an item of the catalog. ID, Version and the timestamps are set by the database.
+type Product struct {
+	ID        string    `json:"id,omitempty" bson:"_id,omitempty"`
+	Name      string    `json:"name" bson:"name"`
+	SKU       string    `json:"sku" bson:"sku"`
+	Category  string    `json:"category" bson:"category"`
+	Price     float64   `json:"price" bson:"price"`
+	Stock     int       `json:"stock" bson:"stock"`
+	Images    []string  `json:"images" bson:"images"`
+	Status    Status    `json:"status" bson:"status"`
+	Version   int64     `json:"version,omitempty" bson:"_version,omitempty"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt,omitempty"`
+}
+
+// FieldError describes one invalid field of a product
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned with every invalid field of a product
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for index, fieldError := range e.Errors {
+		messages[index] = fieldError.Field + ": " + fieldError.Message
+	}
+	return "invalid product: " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) add(field string, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Normalize trims the text fields and defaults the status to draft
+func (p *Product) Normalize() {
+	p.Name = strings.TrimSpace(p.Name)
+	p.SKU = strings.TrimSpace(p.SKU)
+	p.Category = strings.TrimSpace(p.Category)
+	if p.Status == "" {
+		p.Status = StatusDraft
+	}
+}
+
+// Validate returns a *ValidationError listing every invalid field
+func (p Product) Validate() error {
+	invalid := &ValidationError{}
+	switch {
+	case p.Name == "":
+		invalid.add("name", "is required")
+	case len(p.Name) > MaxNameLength:
+		invalid.add("name", "must be at most %d characters", MaxNameLength)
+	}
+	if !skuPattern.MatchString(p.SKU) {
+		invalid.add("sku", "must be 1 to 64 letters, digits, dashes or underscores")
+	}
+	if p.Category == "" {
+		invalid.add("category", "is required")
+	}
+	if p.Price < 0 {
+		invalid.add("price", "must not be negative")
+	}
+	if p.Stock < 0 {
+		invalid.add("stock", "must not be negative")
+	}
+	if len(p.Images) > MaxImages {
+		invalid.add("images", "must be at most %d", MaxImages)
+	}
+	for index, image := range p.Images {
+		u, err := url.Parse(image)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid.add(fmt.Sprintf("images[%d]", index), "must be an http or https URL")
+		}
+	}
+	switch p.Status {
+	case StatusDraft, StatusActive, StatusArchived:
+	default:
+		invalid.add("status", "must be one of %s, %s or %s", StatusDraft, StatusActive, StatusArchived)
+	}
+	if len(invalid.Errors) > 0 {
+		return invalid
+	}
+	return nil
+}
+
+// item is the stored document of p, without the fields set by the database
+func (p Product) item() map[string]interface{} {
+	images := p.Images
+	if images == nil {
+		images = []string{}
+	}
+	return map[string]interface{}{
+		"name":     p.Name,
+		"sku":      p.SKU,
+		"category": p.Category,
+		"price":    p.Price,
+		"stock":    p.Stock,
+		"images":   images,
+		"status":   string(p.Status),
+	}
+}
+
+// fromItem reads a stored document
+func fromItem(item map[string]interface{}) (Product, error) {
+	var p Product
+	data, err := bson.Marshal(item)
+	if err == nil {
+		err = bson.Unmarshal(data, &p)
+	}
+	return p, err
+}
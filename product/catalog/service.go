@@ -0,0 +1,164 @@
+package catalog
+
+import (
+	"context"
+
+	"github.com/doctor-services/services/dbhandler"
+	"github.com/doctor-services/services/helper/listing"
+)
+
+// Collection stores the products
+const Collection = "products"
+
+// CollectionOptions are set on Collection by NewService
+var CollectionOptions = dbhandler.CollectionOptions{Versioned: true, Timestamps: true}
+
+// Indexes of Collection, ensure them at startup. SKUs are unique.
+var Indexes = dbhandler.Indexes{
+	Collection: {
+		{Key: []string{"sku"}, Unique: true},
+		{Key: []string{"category", "status"}},
+	},
+}
+
+// ListOptions configures the parsing of list requests
+var ListOptions = listing.Options{
+	DefaultSort: "name",
+	SortFields:  []string{"name", "sku", "price", "stock", "createdAt", "updatedAt"},
+	Fields: map[string]listing.FieldType{
+		"name":     listing.String,
+		"sku":      listing.String,
+		"category": listing.String,
+		"status":   listing.String,
+		"price":    listing.Float,
+		"stock":    listing.Int,
+	},
+}
+
+// Page is a page of products. A page read with a cursor only has PageSize,
+// NextCursor and HasNextPage set besides the items.
+type Page struct {
+	Total           int       `json:"total"`
+	CurrentPage     int       `json:"currentPage"`
+	TotalPage       int       `json:"totalPage"`
+	PageSize        int       `json:"pageSize"`
+	NextPage        int       `json:"nextPage,omitempty"`
+	PreviousPage    int       `json:"previousPage,omitempty"`
+	HasNextPage     bool      `json:"hasNextPage,omitempty"`
+	HasPreviousPage bool      `json:"hasPreviousPage,omitempty"`
+	NextCursor      string    `json:"nextCursor,omitempty"`
+	Items           []Product `json:"items"`
+}
+
+// Service manages the product catalog
+type Service interface {
+	CreateProduct(ctx context.Context, p Product) (Product, error)
+	GetProduct(ctx context.Context, id string) (Product, error)
+	// UpdateProduct replaces the product. A non zero p.Version must be the stored
+	// version, otherwise the update fails with dbhandler.ErrConflict.
+	UpdateProduct(ctx context.Context, id string, p Product) (Product, error)
+	DeleteProduct(ctx context.Context, id string) error
+	ListProducts(ctx context.Context, request listing.Request) (Page, error)
+}
+
+type service struct {
+	db dbhandler.DatabaseHandler
+}
+
+// NewService creates a product service storing the products in db
+func NewService(db dbhandler.DatabaseHandler) Service {
+	db.ConfigureCollection(Collection, CollectionOptions)
+	return &service{db: db}
+}
+
+func (s *service) CreateProduct(ctx context.Context, p Product) (Product, error) {
+	p.Normalize()
+	if err := p.Validate(); err != nil {
+		return Product{}, err
+	}
+	inserted, err := s.db.AddNewItemContext(ctx, Collection, p.item())
+	if err != nil {
+		return Product{}, err
+	}
+	return fromItem(inserted)
+}
+
+func (s *service) GetProduct(ctx context.Context, id string) (Product, error) {
+	item, err := s.db.FindItemByIDContext(ctx, Collection, id)
+	if err != nil {
+		return Product{}, err
+	}
+	return fromItem(item)
+}
+
+func (s *service) UpdateProduct(ctx context.Context, id string, p Product) (Product, error) {
+	p.Normalize()
+	if err := p.Validate(); err != nil {
+		return Product{}, err
+	}
+	var err error
+	if p.Version != 0 {
+		_, err = s.db.UpdateByIDIfVersion(ctx, Collection, id, p.Version, p.item())
+	} else {
+		err = s.db.UpdateByIDContext(ctx, Collection, id, p.item())
+	}
+	if err != nil {
+		return Product{}, err
+	}
+	return s.GetProduct(ctx, id)
+}
+
+func (s *service) DeleteProduct(ctx context.Context, id string) error {
+	return s.db.RemoveItemByIDContext(ctx, Collection, id)
+}
+
+func (s *service) ListProducts(ctx context.Context, request listing.Request) (Page, error) {
+	if request.Cursor != "" {
+		results, err := s.db.ListItemsAfter(ctx, Collection, request.Limit, request.Cursor, request.ListOptions())
+		if err != nil {
+			return Page{}, err
+		}
+		items, err := products(results.Items)
+		if err != nil {
+			return Page{}, err
+		}
+		return Page{
+			PageSize:    results.PageSize,
+			NextCursor:  results.NextCursor,
+			HasNextPage: results.HasNextPage,
+			Items:       items,
+		}, nil
+	}
+	results, err := s.db.ListItems(ctx, Collection, request.Limit, request.Page, request.ListOptions())
+	if err != nil {
+		return Page{}, err
+	}
+	items, err := products(results.Items)
+	if err != nil {
+		return Page{}, err
+	}
+	return Page{
+		Total:           results.Total,
+		CurrentPage:     results.CurrentPage,
+		TotalPage:       results.TotalPage,
+		PageSize:        results.PageSize,
+		NextPage:        results.NextPage,
+		PreviousPage:    results.PreviousPage,
+		HasNextPage:     results.HasNextPage,
+		HasPreviousPage: results.HasPreviousPage,
+		Items:           items,
+	}, nil
+}
+
+// products converts the listed items
+func products(items []map[string]interface{}) ([]Product, error) {
+	converted := make([]Product, 0, len(items))
+	for _, item := range items {
+		p, err := fromItem(item)
+		if err != nil {
+			return nil, err
+		}
+		converted = append(converted, p)
+	}
+	return converted, nil
+}
@@ -0,0 +1,199 @@
+package catalog
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/doctor-services/services/dbhandler"
+	"github.com/doctor-services/services/dbhandler/memory"
+	"github.com/doctor-services/services/helper/listing"
+)
+
+func newTestService(t *testing.T) Service {
+	db := memory.NewMemoryHandler()
+	if err := db.EnsureIndexes(context.Background(), Indexes); err != nil {
+		t.Fatalf("Ensure indexes must not return error but got %v", err)
+	}
+	return NewService(db)
+}
+
+func newProduct(sku string) Product {
+	return Product{
+		Name:     " Stethoscope ",
+		SKU:      sku,
+		Category: "devices",
+		Price:    89.5,
+		Stock:    12,
+		Images:   []string{"https://cdn.example.com/stethoscope.png"},
+	}
+}
+
+func TestCreateAndGetProduct(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	created, err := s.CreateProduct(ctx, newProduct("ST-1"))
+	if err != nil {
+		t.Fatalf("Create must not return error but got %v", err)
+	}
+	if created.ID == "" || created.Version != 1 || created.CreatedAt.IsZero() {
+		t.Fatalf("Created product must have id, version and timestamps but got %+v", created)
+	}
+	if created.Name != "Stethoscope" || created.Status != StatusDraft {
+		t.Fatalf("Created product must be normalized but got %+v", created)
+	}
+	found, err := s.GetProduct(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("Get must not return error but got %v", err)
+	}
+	if found.SKU != "ST-1" || found.Stock != 12 || found.Price != 89.5 || len(found.Images) != 1 {
+		t.Fatalf("Expected %+v but got %+v", created, found)
+	}
+	if _, err = s.CreateProduct(ctx, newProduct("ST-1")); !dbhandler.IsDuplicateKey(err) {
+		t.Fatalf("Expected duplicate key error but got %v", err)
+	}
+}
+
+func TestCreateInvalidProduct(t *testing.T) {
+	s := newTestService(t)
+	_, err := s.CreateProduct(context.Background(), Product{SKU: "bad sku", Price: -1, Stock: -1,
+		Images: []string{"ftp://example.com/a.png"}, Status: "sold"})
+	invalid, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Expected validation error but got %v", err)
+	}
+	fields := map[string]bool{}
+	for _, fieldError := range invalid.Errors {
+		fields[fieldError.Field] = true
+	}
+	for _, field := range []string{"name", "sku", "category", "price", "stock", "images[0]", "status"} {
+		if !fields[field] {
+			t.Errorf("Expected an error on %s but got %v", field, invalid.Errors)
+		}
+	}
+}
+
+func TestUpdateProduct(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	created, _ := s.CreateProduct(ctx, newProduct("ST-1"))
+	update := newProduct("ST-1")
+	update.Stock = 3
+	update.Status = StatusActive
+	update.Version = created.Version
+	updated, err := s.UpdateProduct(ctx, created.ID, update)
+	if err != nil {
+		t.Fatalf("Update must not return error but got %v", err)
+	}
+	if updated.Stock != 3 || updated.Status != StatusActive || updated.Version != 2 {
+		t.Fatalf("Update must replace the product but got %+v", updated)
+	}
+	if !updated.CreatedAt.Equal(created.CreatedAt) {
+		t.Fatalf("Update must keep the creation time but got %v", updated.CreatedAt)
+	}
+	if _, err = s.UpdateProduct(ctx, created.ID, update); !dbhandler.IsConflict(err) {
+		t.Fatalf("Update of an old version must conflict but got %v", err)
+	}
+	update.Version = 0
+	if _, err = s.UpdateProduct(ctx, created.ID, update); err != nil {
+		t.Fatalf("Update without version must not return error but got %v", err)
+	}
+}
+
+func TestDeleteProduct(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	created, _ := s.CreateProduct(ctx, newProduct("ST-1"))
+	if err := s.DeleteProduct(ctx, created.ID); err != nil {
+		t.Fatalf("Delete must not return error but got %v", err)
+	}
+	if _, err := s.GetProduct(ctx, created.ID); !dbhandler.IsNotFound(err) {
+		t.Fatalf("Expected not found error but got %v", err)
+	}
+}
+
+func TestListProducts(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	for _, sku := range []string{"A-1", "B-1", "C-1"} {
+		p := newProduct(sku)
+		p.Name = sku
+		if sku == "B-1" {
+			p.Category = "drugs"
+		}
+		if _, err := s.CreateProduct(ctx, p); err != nil {
+			t.Fatalf("Create must not return error but got %v", err)
+		}
+	}
+	request, err := listing.Parse(url.Values{"category": {"devices"}, "sort": {"-name"}, "limit": {"1"}}, ListOptions)
+	if err != nil {
+		t.Fatalf("Parse must not return error but got %v", err)
+	}
+	page, err := s.ListProducts(ctx, request)
+	if err != nil {
+		t.Fatalf("List must not return error but got %v", err)
+	}
+	if page.Total != 2 || !page.HasNextPage || len(page.Items) != 1 || page.Items[0].SKU != "C-1" {
+		t.Fatalf("Wrong page: %+v", page)
+	}
+}
+
+func TestListProductsSortedByTwoKeys(t *testing.T) {
+	db := memory.NewMemoryHandler()
+	s := NewService(db)
+	ctx := context.Background()
+	for _, p := range []struct {
+		sku   string
+		price float64
+	}{{"A-1", 10}, {"B-1", 10}, {"C-1", 5}, {"D-1", 10}} {
+		product := newProduct(p.sku)
+		product.Name, product.Price = p.sku, p.price
+		if _, err := s.CreateProduct(ctx, product); err != nil {
+			t.Fatalf("Create must not return error but got %v", err)
+		}
+	}
+	skus := func(page Page) []string {
+		var skus []string
+		for _, p := range page.Items {
+			skus = append(skus, p.SKU)
+		}
+		return skus
+	}
+
+	values := url.Values{"sort": {"price,-name"}, "limit": {"2"}}
+	request, err := listing.Parse(values, ListOptions)
+	if err != nil {
+		t.Fatalf("Parse must not return error but got %v", err)
+	}
+	page, err := s.ListProducts(ctx, request)
+	if err != nil {
+		t.Fatalf("List must not return error but got %v", err)
+	}
+	if got := skus(page); !reflect.DeepEqual(got, []string{"C-1", "D-1"}) || page.Total != 4 {
+		t.Fatalf("List must sort by price then name but got %v", got)
+	}
+
+	first, err := db.ListItemsAfter(ctx, Collection, 2, "", request.ListOptions())
+	if err != nil || first.NextCursor == "" {
+		t.Fatalf("First cursor page must have a next cursor but got %+v, %v", first, err)
+	}
+	values.Set("cursor", first.NextCursor)
+	request, err = listing.Parse(values, ListOptions)
+	if err != nil {
+		t.Fatalf("Parse must not return error but got %v", err)
+	}
+	page, err = s.ListProducts(ctx, request)
+	if err != nil {
+		t.Fatalf("List after a cursor must not return error but got %v", err)
+	}
+	if got := skus(page); !reflect.DeepEqual(got, []string{"B-1", "A-1"}) || page.HasNextPage {
+		t.Fatalf("List must continue after the cursor but got %v, %+v", got, page)
+	}
+
+	values.Set("sort", "price")
+	request, _ = listing.Parse(values, ListOptions)
+	if _, err = s.ListProducts(ctx, request); dbhandler.KindOf(err) != dbhandler.ErrInvalidCursor {
+		t.Fatalf("Cursor of another sort must be rejected but got %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/doctor-services/services/dbhandler"
+	"github.com/doctor-services/services/helper/listing"
+
+	kitlog "github.com/go-kit/kit/log"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// PathPrefix is where MakeHandler expects to be mounted
+const PathPrefix = "/products/"
+
+// maxBodySize bounds the product documents read from requests
+const maxBodySize = 1 << 20
+
+// Routing errors, answered with 404 and 405
+var (
+	errRouteNotFound    = errors.New("route not found")
+	errMethodNotAllowed = errors.New("method not allowed")
+)
+
+// badRequestError is returned when a request body cannot be read
+type badRequestError struct {
+	err error
+}
+
+func (e badRequestError) Error() string {
+	return "bad request: " + e.err.Error()
+}
+
+// errorResponse is the body of every error but validation errors
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// MakeHandler serves the product endpoints under PathPrefix:
+//
+//	GET    /products/      lists products, see listing.Parse for the query parameters
+//	POST   /products/      creates a product
+//	GET    /products/{id}  returns a product
+//	PUT    /products/{id}  replaces a product
+//	DELETE /products/{id}  removes a product
+func MakeHandler(s Service, logger kitlog.Logger) http.Handler {
+	endpoints := MakeEndpoints(s)
+	opts := []kithttp.ServerOption{
+		kithttp.ServerErrorLogger(logger),
+		kithttp.ServerErrorEncoder(encodeError),
+	}
+	create := kithttp.NewServer(endpoints.Create, decodeCreateRequest, encodeResponse, opts...)
+	get := kithttp.NewServer(endpoints.Get, decodeGetRequest, encodeResponse, opts...)
+	update := kithttp.NewServer(endpoints.Update, decodeUpdateRequest, encodeResponse, opts...)
+	remove := kithttp.NewServer(endpoints.Delete, decodeDeleteRequest, encodeResponse, opts...)
+	list := kithttp.NewServer(endpoints.List, decodeListRequest, encodeResponse, opts...)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := productID(r)
+		if !ok {
+			encodeError(r.Context(), errRouteNotFound, w)
+			return
+		}
+		switch {
+		case id == "" && r.Method == http.MethodGet:
+			list.ServeHTTP(w, r)
+		case id == "" && r.Method == http.MethodPost:
+			create.ServeHTTP(w, r)
+		case id != "" && r.Method == http.MethodGet:
+			get.ServeHTTP(w, r)
+		case id != "" && r.Method == http.MethodPut:
+			update.ServeHTTP(w, r)
+		case id != "" && r.Method == http.MethodDelete:
+			remove.ServeHTTP(w, r)
+		default:
+			encodeError(r.Context(), errMethodNotAllowed, w)
+		}
+	})
+}
+
+// productID returns the id in the path, empty for the collection itself
+func productID(r *http.Request) (string, bool) {
+	path := r.URL.Path
+	if path+"/" == PathPrefix {
+		return "", true
+	}
+	if !strings.HasPrefix(path, PathPrefix) {
+		return "", false
+	}
+	id := strings.TrimPrefix(path, PathPrefix)
+	return id, !strings.Contains(id, "/")
+}
+
+func decodeProduct(r *http.Request) (Product, error) {
+	var p Product
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxBodySize))
+	if err := decoder.Decode(&p); err != nil {
+		return p, badRequestError{err: err}
+	}
+	return p, nil
+}
+
+func decodeCreateRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	p, err := decodeProduct(r)
+	if err != nil {
+		return nil, err
+	}
+	return createRequest{Product: p}, nil
+}
+
+func decodeGetRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, _ := productID(r)
+	return getRequest{ID: id}, nil
+}
+
+func decodeUpdateRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, _ := productID(r)
+	p, err := decodeProduct(r)
+	if err != nil {
+		return nil, err
+	}
+	return updateRequest{ID: id, Product: p}, nil
+}
+
+func decodeDeleteRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id, _ := productID(r)
+	return deleteRequest{ID: id}, nil
+}
+
+func decodeListRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	request, err := listing.Parse(r.URL.Query(), ListOptions)
+	if err != nil {
+		return nil, err
+	}
+	return listRequest{Request: request}, nil
+}
+
+func encodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	switch response := response.(type) {
+	case emptyResponse:
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	case createdResponse:
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Location", PathPrefix+response.Product.ID)
+		w.WriteHeader(http.StatusCreated)
+		return json.NewEncoder(w).Encode(response.Product)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(response)
+}
+
+// encodeError answers validation errors with their field errors and any other
+// error with its message, the status follows dbhandler.HTTPStatus. Internal errors
+// may tell about the database, they are only logged by the ServerErrorLogger.
+func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+	status := dbhandler.HTTPStatus(err)
+	var body interface{} = errorResponse{Error: err.Error()}
+	switch e := err.(type) {
+	case *ValidationError:
+		status, body = http.StatusBadRequest, e
+	case *listing.Error:
+		status, body = http.StatusBadRequest, e
+	case badRequestError:
+		status = http.StatusBadRequest
+	}
+	switch err {
+	case errRouteNotFound:
+		status = http.StatusNotFound
+	case errMethodNotAllowed:
+		status = http.StatusMethodNotAllowed
+	}
+	if status == http.StatusInternalServerError {
+		body = errorResponse{Error: http.StatusText(status)}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,105 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/doctor-services/services/helper/listing"
+
+	kitlog "github.com/go-kit/kit/log"
+)
+
+func TestHandler(t *testing.T) {
+	handler := MakeHandler(newTestService(t), kitlog.NewNopLogger())
+	do := func(method string, path string, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return recorder
+	}
+
+	created := do(http.MethodPost, "/products/", `{"name": "Mask", "sku": "MK-1", "category": "supplies", "price": 2, "stock": 100}`)
+	if created.Code != http.StatusCreated {
+		t.Fatalf("Create must answer 201 but got %d: %s", created.Code, created.Body)
+	}
+	var p Product
+	if err := json.NewDecoder(created.Body).Decode(&p); err != nil || p.ID == "" {
+		t.Fatalf("Create must answer the product but got %v", err)
+	}
+	if location := created.Header().Get("Location"); location != "/products/"+p.ID {
+		t.Errorf("Create must answer the location but got %q", location)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		want   string
+	}{
+		{"get", http.MethodGet, "/products/" + p.ID, "", http.StatusOK, `"sku":"MK-1"`},
+		{"list", http.MethodGet, "/products/?category=supplies", "", http.StatusOK, `"total":1`},
+		{"bad list", http.MethodGet, "/products/?color=red", "", http.StatusBadRequest, `"param":"color"`},
+		{"update", http.MethodPut, "/products/" + p.ID, `{"name": "Mask", "sku": "MK-1", "category": "supplies", "stock": 5, "version": 1}`,
+			http.StatusOK, `"stock":5`},
+		{"conflict", http.MethodPut, "/products/" + p.ID, `{"name": "Mask", "sku": "MK-1", "category": "supplies", "version": 1}`,
+			http.StatusConflict, `"error"`},
+		{"invalid", http.MethodPost, "/products/", `{"sku": "MK-2"}`, http.StatusBadRequest, `"field":"name"`},
+		{"bad json", http.MethodPost, "/products/", `{`, http.StatusBadRequest, `"error":"bad request`},
+		{"duplicate sku", http.MethodPost, "/products/", `{"name": "Mask", "sku": "MK-1", "category": "supplies"}`,
+			http.StatusConflict, `"error"`},
+		{"invalid id", http.MethodGet, "/products/nope", "", http.StatusBadRequest, `"error"`},
+		{"method", http.MethodPatch, "/products/" + p.ID, "", http.StatusMethodNotAllowed, `"error"`},
+		{"route", http.MethodGet, "/products/" + p.ID + "/images", "", http.StatusNotFound, `"error"`},
+		{"delete", http.MethodDelete, "/products/" + p.ID, "", http.StatusNoContent, ""},
+		{"deleted", http.MethodGet, "/products/" + p.ID, "", http.StatusNotFound, `"error"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := do(tt.method, tt.path, tt.body)
+			if recorder.Code != tt.status {
+				t.Fatalf("Expected status %d but got %d: %s", tt.status, recorder.Code, recorder.Body)
+			}
+			if !strings.Contains(recorder.Body.String(), tt.want) {
+				t.Fatalf("Expected body with %s but got %s", tt.want, recorder.Body)
+			}
+		})
+	}
+}
+
+// failingService fails every listing with err
+type failingService struct {
+	Service
+	err error
+}
+
+func (s failingService) ListProducts(ctx context.Context, request listing.Request) (Page, error) {
+	return Page{}, s.err
+}
+
+func TestHandlerHidesInternalErrors(t *testing.T) {
+	var logged []string
+	logger := kitlog.LoggerFunc(func(keyvals ...interface{}) error {
+		logged = append(logged, fmt.Sprint(keyvals...))
+		return nil
+	})
+	err := errors.New("products.find: no reachable servers at db-1.internal:27017")
+	handler := MakeHandler(failingService{Service: newTestService(t), err: err}, logger)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/products/", nil))
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status 500 but got %d: %s", recorder.Code, recorder.Body)
+	}
+	if body := recorder.Body.String(); strings.Contains(body, "db-1") || !strings.Contains(body, `"error":"Internal Server Error"`) {
+		t.Fatalf("Internal errors must not be answered but got %s", body)
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0], "db-1") {
+		t.Fatalf("Internal errors must be logged but got %v", logged)
+	}
+}
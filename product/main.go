@@ -1,70 +1,121 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
-	"os/signal"
-	"syscall"
+	"strconv"
+	"time"
+
+	"github.com/doctor-services/services/dbhandler"
+	"github.com/doctor-services/services/dbhandler/mongo"
+	"github.com/doctor-services/services/helper/config"
+	"github.com/doctor-services/services/helper/health"
+	"github.com/doctor-services/services/helper/server"
+	"github.com/doctor-services/services/product/catalog"
 
 	kitlog "github.com/go-kit/kit/log"
 )
 
 const (
-	defaultPort              = "80"
-	defaultApiUser           = "http://172.16.100.243:30000/user/users"
-	defaultPublicKey         = "./auth/test_jwt_keys/public.pem"
-	defaultApiDatachange     = "http://172.16.100.243:30000/queue/datachange"
-	defaultFirebaseServerKey = "AAAAebG27Tw:APA91bE0lgckfj3yQrwtewYym8uZWGSRzvN5BOA0OZ1oUQ0QZbz52Q3wxX27dNizJ7xDDSMPWEYYRKA2hahSlc8ooWXz76yoM7Ei5L_9UIftqxM4v3WkUy_c0-91diA3HirhpzCQJB2s"
-	defaultApiMail           = "http://172.16.100.243:30000/mailer/notification/send"
-	defaultApiOrder          = "http://172.16.100.243:30000/order/"
-	defaultUserName          = "admin"
-	defaultPassWord          = "p@ssword"
-	defaultUrlGraphql        = "http://172.16.100.243:30000/graphql"
+	// minFreeDisk is the free space the disk check asks for
+	minFreeDisk = 10 << 20
+	// startupTimeout bounds ensuring the indexes at startup
+	startupTimeout = 30 * time.Second
 )
 
+// settings are loaded by config.Load from the flags, the environment and the -config file.
+// The service endpoints and credentials are used by the message handlers.
+type settings struct {
+	Port            int           `config:"http.port" env:"PORT" default:"80" usage:"HTTP listen port"`
+	Addr            string        `config:"http.addr" usage:"HTTP listen address, :http.port when empty"`
+	DrainDelay      time.Duration `config:"shutdown.drain-delay" default:"5s" usage:"Time readiness fails before the listener closes"`
+	ShutdownTimeout time.Duration `config:"shutdown.timeout" default:"30s" usage:"Time in-flight requests get to finish"`
+	MongoURI        string        `config:"mongo.uri" required:"true" secret:"true" usage:"mongodb:// connection string of the catalog database"`
+
+	APIUser           *url.URL `config:"api.user" usage:"User service endpoint"`
+	APIDatachange     *url.URL `config:"api.datachange" usage:"Data change queue endpoint"`
+	APIMail           *url.URL `config:"api.mail" usage:"Mail notification endpoint"`
+	APIOrder          *url.URL `config:"api.order" usage:"Order service endpoint"`
+	URLGraphql        *url.URL `config:"api.graphql" usage:"GraphQL endpoint"`
+	PublicKey         string   `config:"auth.public-key" default:"./auth/test_jwt_keys/public.pem" usage:"JWT public key file"`
+	FirebaseServerKey string   `config:"firebase.server-key" secret:"true" usage:"Firebase cloud messaging server key"`
+	UserName          string   `config:"api.username" usage:"User the service calls the other services as"`
+	PassWord          string   `config:"api.password" secret:"true" usage:"Password of api.username"`
+}
+
 func main() {
 	log.Print("Starting")
-	// Get config values
-	var (
-		port     = flag.String("http.port", defaultPort, "HTTP listen port") //helper.GetEnvString("PORT", defaultPort)
-		httpAddr = flag.String("http.addr", ":"+*port, "HTTP listen address")
-	)
-	// Parse predefined config
-	flag.Parse()
 	// Setup logger
 	var logger kitlog.Logger
 	logger = kitlog.NewLogfmtLogger(kitlog.NewSyncWriter(os.Stdout))
 	logger = kitlog.With(logger, "ts", kitlog.DefaultTimestamp)
-	// Handle request
-	http.Handle("/", initHandler(logger))
-	// Keep main process running
-	errs := make(chan error, 2)
-	go func() {
-		logger.Log("transport", "http", "address", *httpAddr, "msg", "listening")
-		errs <- http.ListenAndServe(*httpAddr, nil)
-	}()
-	// Terminate when receive terminate signal
-	go func() {
-		c := make(chan os.Signal)
-		signal.Notify(c, syscall.SIGINT)
-		errs <- fmt.Errorf("%s", <-c)
-	}()
-
-	logger.Log("terminated", <-errs)
-
+	// Get config values
+	var cfg settings
+	values, err := config.Load(&cfg, config.Options{})
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		logger.Log("terminated", err)
+		os.Exit(2)
+	}
+	values.Log(logger)
+	httpAddr := cfg.Addr
+	if httpAddr == "" {
+		httpAddr = ":" + strconv.Itoa(cfg.Port)
+	}
+	// Init database handler, the connection is opened on first use
+	db, err := mongo.NewMongoHandlerFromURI(cfg.MongoURI)
+	if err != nil {
+		logger.Log("terminated", err)
+		os.Exit(2)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), startupTimeout)
+	err = db.EnsureIndexes(ctx, catalog.Indexes)
+	cancel()
+	if err != nil {
+		logger.Log("terminated", err)
+		os.Exit(1)
+	}
+	// Kubernetes probes
+	probes := health.New(health.Options{})
+	probes.AddReadinessCheck("database", health.DatabaseCheck(db))
+	probes.AddReadinessCheck("disk", health.DiskCheck(os.TempDir(), minFreeDisk))
+	// Serve until SIGINT or SIGTERM, then drain in-flight requests
+	runner := server.New(server.Config{
+		Addr:            httpAddr,
+		Handler:         initHandler(logger, probes, db),
+		ShutdownTimeout: cfg.ShutdownTimeout,
+		DrainDelay:      cfg.DrainDelay,
+		Health:          probes,
+		Logger:          logger,
+	})
+	// Close the database once the requests are drained
+	runner.OnShutdown("database", func() error {
+		db.CloseConnection()
+		return nil
+	})
+	if err := runner.Run(context.Background()); err != nil {
+		logger.Log("terminated", err)
+		os.Exit(1)
+	}
+	logger.Log("terminated", "shutdown complete")
 }
 
-func initHandler(logger kitlog.Logger) http.Handler {
-	// Init Database handler
-	// mongoHandler := initDatabaseHandler(logger)
+func initHandler(logger kitlog.Logger, probes *health.Health, db dbhandler.DatabaseHandler) http.Handler {
 	// Init service
+	productService := catalog.NewService(db)
 	// messageService := message.NewNotifyMessageService(mongoHandler)
 	// tempalteService := notifytemplate.NewNotifyTemplateService(mongoHandler)
 	// // Init routing
 	mux := http.NewServeMux()
+	probes.Register(mux)
+	// Handle products
+	mux.Handle(catalog.PathPrefix, catalog.MakeHandler(productService, kitlog.With(logger, "component", "catalog")))
 	// // api datachange
 	// Handle messages
 	// mux.Handle("/messages/", message.MakeNotifyMessageHandler(messageService, logger, apiUser, publicKey, apiDataChange, firebaseServerKey, apiMail, apiOrder, username, password, graphql))
@@ -76,23 +127,3 @@ func initHandler(logger kitlog.Logger) http.Handler {
 	// // Handle access log
 	// return accesslog.NewApacheLoggingHandler(httpHandler, os.Stderr)
 }
-
-// func initDatabaseHandler(logger kitlog.Logger) db.DatabaseHandler {
-// 	// Get config values
-// 	var (
-// 		mongoURL      = helper.GetEnvString("MONGO_HOST", db.DbHost)
-// 		mongoPort     = helper.GetEnvString("MONGO_PORT", strconv.Itoa(db.DbPort))
-// 		mongoUser     = helper.GetEnvString("MONGO_USER", db.DbUser)
-// 		mongoPass     = helper.GetEnvString("MONGO_PASS", db.DbPass)
-// 		mongoDataBase = helper.GetEnvString("MONGO_DB", db.CollectionName)
-// 		authDatabase  = helper.GetEnvString("MONGO_AUTH_DB", db.AuthDb)
-// 	)
-
-// 	// Init db handler
-// 	mongoPortNumber, ok := strconv.Atoi(mongoPort)
-// 	if ok != nil {
-// 		logger.Log("[App.error]: Cannot get db port")
-// 		os.Exit(1)
-// 	}
-// 	return db.NewMongoHandler(mongoURL, mongoPortNumber, mongoDataBase, authDatabase, mongoUser, mongoPass)
-// }